@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAccountAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	user := createRandomUser(t, store)
+	createRandomAccount(t, store, user.Username, util.EUR)
+
+	testCases := []struct {
+		name          string
+		username      string
+		body          any
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			username: user.Username,
+			body:     createAccountRequest{Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				account, err := store.GetAccount(context.Background(), 2)
+				require.NoError(t, err)
+				require.Equal(t, user.Username, account.Owner)
+				require.Zero(t, account.Balance)
+				requireBodyMatch(t, recorder, account)
+				// the token user is the actor of the change
+				logs, err := store.ListAuditLogs(context.Background(), db.ListAuditLogsParams{
+					AccountID: sql.NullInt64{Int64: account.ID, Valid: true},
+					Limit:     10,
+				})
+				require.NoError(t, err)
+				require.Len(t, logs, 1)
+				require.Equal(t, user.Username, logs[0].Actor)
+				require.Equal(t, db.AuditActionCreate, logs[0].Action)
+			},
+		},
+		{
+			// the token is valid but its user was deleted (or never existed)
+			name:     "UnknownOwner",
+			username: util.RandomString(10),
+			body:     createAccountRequest{Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "DuplicateCurrency",
+			username: user.Username,
+			body:     createAccountRequest{Currency: util.EUR},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "InvalidCurrency",
+			username: user.Username,
+			body:     createAccountRequest{Currency: "XYZ"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "NoAuthorization",
+			body: createAccountRequest{Currency: util.CAD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var authorization string
+			if tc.username != "" {
+				authorization = accessToken(t, server, tc.username)
+			}
+			recorder := serve(t, server, http.MethodPost, "/accounts", authorization, tc.body)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestGetAccountAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	user := createRandomUser(t, store)
+	account := createRandomAccount(t, store, user.Username, util.USD)
+
+	testCases := []struct {
+		name          string
+		accountID     int64
+		username      string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:      "OK",
+			accountID: account.ID,
+			username:  user.Username,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, account)
+			},
+		},
+		{
+			name:      "NotOwner",
+			accountID: account.ID,
+			username:  createRandomUser(t, store).Username,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:      "NoAuthorization",
+			accountID: account.ID,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:      "NotFound",
+			accountID: account.ID + 1,
+			username:  user.Username,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:      "InvalidID",
+			accountID: 0,
+			username:  user.Username,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var authorization string
+			if tc.username != "" {
+				authorization = accessToken(t, server, tc.username)
+			}
+			recorder := serve(t, server, http.MethodGet, fmt.Sprintf("/accounts/%d", tc.accountID), authorization, nil)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestListAccountsAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	owner := createRandomUser(t, store).Username
+	var accounts []db.Account
+	for _, currency := range []string{util.USD, util.EUR, util.CAD} {
+		accounts = append(accounts, createRandomAccount(t, store, owner, currency))
+	}
+	// accounts of other users are never listed
+	other := createRandomUser(t, store).Username
+	createRandomAccount(t, store, other, util.USD)
+
+	testCases := []struct {
+		name          string
+		query         string
+		username      string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			query:    "page_id=1&page_size=5",
+			username: owner,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				requireBodyMatch(t, recorder, accounts)
+			},
+		},
+		{
+			name:     "EmptyPage",
+			query:    "page_id=2&page_size=5",
+			username: owner,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.JSONEq(t, "[]", recorder.Body.String())
+			},
+		},
+		{
+			// the owner comes from the token, a query parameter can't override it
+			name:     "OwnerFromToken",
+			query:    fmt.Sprintf("owner=%s&page_id=1&page_size=5", owner),
+			username: other,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var got []db.Account
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				require.Len(t, got, 1)
+				require.Equal(t, other, got[0].Owner)
+			},
+		},
+		{
+			name:     "InvalidPageSize",
+			query:    "page_id=1&page_size=100",
+			username: owner,
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:  "NoAuthorization",
+			query: "page_id=1&page_size=5",
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var authorization string
+			if tc.username != "" {
+				authorization = accessToken(t, server, tc.username)
+			}
+			recorder := serve(t, server, http.MethodGet, "/accounts?"+tc.query, authorization, nil)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
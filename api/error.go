@@ -0,0 +1,81 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/lib/pq"
+)
+
+// ErrorResponse is the body of every failed request
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// postgres error codes the handlers care about
+const (
+	foreignKeyViolation = pq.ErrorCode("23503")
+	uniqueViolation     = pq.ErrorCode("23505")
+)
+
+func errorResponse(err error) ErrorResponse {
+	return ErrorResponse{Error: err.Error()}
+}
+
+// errInternal is all the client learns of an unexpected failure
+var errInternal = errors.New("internal error")
+
+// abortWithError writes the error with the status matching it (errorStatus)
+// a 500 doesn't leak the details of the failure (driver messages, constraint names, ...), the real error is only
+// attached to the request, for the server's log
+func abortWithError(ctx *gin.Context, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		_ = ctx.Error(err)
+		err = errInternal
+	}
+	ctx.AbortWithStatusJSON(status, errorResponse(err))
+}
+
+// errorStatus maps store errors to HTTP statuses, anything unknown is a 500
+func errorStatus(err error) int {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows),
+		errors.Is(err, db.ErrAccountNotFound),
+		errors.Is(err, db.ErrTransferNotFound),
+		errors.Is(err, db.ErrWebhookDeliveryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, db.ErrInvalidCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, db.ErrInvalidAmount),
+		errors.Is(err, db.ErrSameAccount),
+		errors.Is(err, db.ErrCurrencyMismatch),
+		errors.Is(err, db.ErrPasswordTooLong):
+		return http.StatusBadRequest
+	case errors.Is(err, db.ErrAccountFrozen),
+		errors.Is(err, db.ErrAccountClosed):
+		return http.StatusForbidden
+	case errors.Is(err, db.ErrIdempotencyKeyConflict),
+		errors.Is(err, db.ErrWebhookDeliveryNotPending):
+		return http.StatusConflict
+	case errors.Is(err, db.ErrInsufficientFunds):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &pqErr):
+		switch pqErr.Code {
+		case foreignKeyViolation:
+			// a missing referenced row is the client's mistake, a row that is still referenced is a conflict
+			if strings.HasPrefix(pqErr.Message, "update or delete on table") {
+				return http.StatusConflict
+			}
+			return http.StatusBadRequest
+		case uniqueViolation:
+			return http.StatusConflict
+		}
+	}
+	return http.StatusInternalServerError
+}
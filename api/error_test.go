@@ -0,0 +1,63 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorStatus(t *testing.T) {
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{sql.ErrNoRows, http.StatusNotFound},
+		{fmt.Errorf("%w: 1", db.ErrAccountNotFound), http.StatusNotFound},
+		{&db.CurrencyMismatchError{AccountID: 1, Expected: "USD", Actual: "EUR"}, http.StatusBadRequest},
+		{fmt.Errorf("%w: 1", db.ErrAccountClosed), http.StatusForbidden},
+		{fmt.Errorf("%w: 1", db.ErrInsufficientFunds), http.StatusUnprocessableEntity},
+		{fmt.Errorf("%w: 1", db.ErrWebhookDeliveryNotFound), http.StatusNotFound},
+		{fmt.Errorf("%w: 1", db.ErrWebhookDeliveryNotPending), http.StatusConflict},
+		{&pq.Error{Code: "23503", Message: `insert or update on table "accounts" violates foreign key constraint "accounts_owner_fkey"`}, http.StatusBadRequest},
+		{&pq.Error{Code: "23503", Message: `update or delete on table "accounts" violates foreign key constraint "entries_account_id_fkey" on table "entries"`}, http.StatusConflict},
+		{&pq.Error{Code: "23505"}, http.StatusConflict},
+		{&pq.Error{Code: "57014"}, http.StatusInternalServerError},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.status, errorStatus(tc.err), tc.err.Error())
+	}
+}
+
+func TestAbortWithError(t *testing.T) {
+	abort := func(err error) (*httptest.ResponseRecorder, *gin.Context) {
+		recorder := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(recorder)
+		abortWithError(ctx, err)
+		return recorder, ctx
+	}
+
+	recorder, _ := abort(fmt.Errorf("%w: 1", db.ErrAccountNotFound))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	var body ErrorResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, "account not found: 1", body.Error)
+
+	// the details of a 500 stay on the server
+	err := fmt.Errorf("tx err %w", &pq.Error{Code: "57014", Message: `canceling statement due to statement timeout on "entries_pkey"`})
+	recorder, ctx := abort(err)
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, "internal error", body.Error)
+	require.NotContains(t, recorder.Body.String(), "entries_pkey")
+	require.ErrorIs(t, ctx.Errors.Last(), err)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	tokenMaker, err := token.NewJWTMaker(token.Key{ID: "test", Secret: util.RandomString(32)})
+	require.NoError(t, err)
+	return NewServer(store, tokenMaker)
+}
+
+// accessToken returns an "Authorization" header value for username
+func accessToken(t *testing.T, server *Server, username string) string {
+	accessToken, _, err := server.tokenMaker.CreateToken(username, token.TypeAccess, time.Minute)
+	require.NoError(t, err)
+	return "Bearer " + accessToken
+}
+
+func createRandomUser(t *testing.T, store db.Store) db.User {
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func createRandomAccount(t *testing.T, store db.Store, owner string, currency string) db.Account {
+	account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    owner,
+		Balance:  1000 + util.RandomMoney(),
+		Currency: currency,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+// serve sends a request with an optional JSON body and authorization header straight to the router
+func serve(t *testing.T, server *Server, method, url string, authorization string, body any) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	require.NoError(t, err)
+	if authorization != "" {
+		request.Header.Set(authorizationHeaderKey, authorization)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// requireBodyMatch compares JSON documents, decoded times would lose their location
+func requireBodyMatch(t *testing.T, recorder *httptest.ResponseRecorder, expected any) {
+	data, err := json.Marshal(expected)
+	require.NoError(t, err)
+	require.JSONEq(t, string(data), recorder.Body.String())
+}
+
+func requireErrorBody(t *testing.T, recorder *httptest.ResponseRecorder) {
+	var got ErrorResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+	require.NotEmpty(t, got.Error)
+}
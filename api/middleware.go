@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/token"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationPayloadKey = "authorization_payload"
+)
+
+// errors of the authorization checks
+var (
+	errMissingAuthorization = errors.New("authorization header is not provided")
+	errNotAccountOwner      = errors.New("account doesn't belong to the authenticated user")
+	errNotWebhookOwner      = errors.New("webhook doesn't belong to the authenticated user")
+)
+
+// authMiddleware requires a valid access token ("Authorization: Bearer <token>") and stores its payload in the context
+// the user also becomes the actor of the request's writes in the audit log (db.WithActor)
+func authMiddleware(tokenMaker token.Maker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
+		if len(authorizationHeader) == 0 {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(errMissingAuthorization))
+			return
+		}
+
+		fields := strings.Fields(authorizationHeader)
+		if len(fields) != 2 {
+			err := errors.New("invalid authorization header format")
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		if authorizationType := strings.ToLower(fields[0]); authorizationType != authorizationTypeBearer {
+			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+
+		payload, err := tokenMaker.VerifyToken(fields[1])
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+			return
+		}
+		if payload.Type != token.TypeAccess {
+			// refresh tokens are only good for /tokens/refresh
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(token.ErrInvalidToken))
+			return
+		}
+
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Request = ctx.Request.WithContext(db.WithActor(ctx.Request.Context(), payload.Username))
+		ctx.Next()
+	}
+}
+
+// authPayload returns the payload stored by authMiddleware
+func authPayload(ctx *gin.Context) *token.Payload {
+	return ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"github.com/stretchr/testify/require"
+)
+
+func createToken(t *testing.T, tokenMaker token.Maker, username string, tokenType token.Type, duration time.Duration) string {
+	token, _, err := tokenMaker.CreateToken(username, tokenType, duration)
+	require.NoError(t, err)
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	username := util.RandomOwner()
+
+	testCases := []struct {
+		name          string
+		authorization func(t *testing.T, tokenMaker token.Maker) string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			authorization: func(t *testing.T, tokenMaker token.Maker) string {
+				return "Bearer " + createToken(t, tokenMaker, username, token.TypeAccess, time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Equal(t, username, recorder.Body.String())
+			},
+		},
+		{
+			name: "NoAuthorization",
+			authorization: func(t *testing.T, tokenMaker token.Maker) string {
+				return ""
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "UnsupportedAuthorization",
+			authorization: func(t *testing.T, tokenMaker token.Maker) string {
+				return "Basic " + createToken(t, tokenMaker, username, token.TypeAccess, time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "InvalidAuthorizationFormat",
+			authorization: func(t *testing.T, tokenMaker token.Maker) string {
+				return createToken(t, tokenMaker, username, token.TypeAccess, time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "ExpiredToken",
+			authorization: func(t *testing.T, tokenMaker token.Maker) string {
+				return "Bearer " + createToken(t, tokenMaker, username, token.TypeAccess, -time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "RefreshToken",
+			authorization: func(t *testing.T, tokenMaker token.Maker) string {
+				return "Bearer " + createToken(t, tokenMaker, username, token.TypeRefresh, time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+		{
+			name: "UnknownSigningKey",
+			authorization: func(t *testing.T, tokenMaker token.Maker) string {
+				other, err := token.NewJWTMaker(token.Key{ID: "test", Secret: util.RandomString(32)})
+				require.NoError(t, err)
+				return "Bearer " + createToken(t, other, username, token.TypeAccess, time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(t, db.NewMemStore())
+			server.router.GET("/auth", authMiddleware(server.tokenMaker), func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, authPayload(ctx).Username)
+			})
+
+			recorder := serve(t, server, http.MethodGet, "/auth", tc.authorization(t, server.tokenMaker), nil)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
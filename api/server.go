@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/token"
+)
+
+// ShutdownTimeout is how long Serve waits for in-flight requests once its context is cancelled
+const ShutdownTimeout = 10 * time.Second
+
+// lifetimes of the tokens issued by the login and refresh endpoints, unless overridden with WithTokenDurations
+const (
+	DefaultAccessTokenDuration  = 15 * time.Minute
+	DefaultRefreshTokenDuration = 24 * time.Hour
+)
+
+// Server serves HTTP requests for the banking service
+type Server struct {
+	store                db.Store
+	tokenMaker           token.Maker
+	accessTokenDuration  time.Duration
+	refreshTokenDuration time.Duration
+	router               *gin.Engine
+}
+
+// ServerOption customises a server created with NewServer
+type ServerOption func(*Server)
+
+// WithTokenDurations sets the lifetime of access and refresh tokens
+func WithTokenDurations(access, refresh time.Duration) ServerOption {
+	return func(server *Server) {
+		server.accessTokenDuration = access
+		server.refreshTokenDuration = refresh
+	}
+}
+
+// NewServer creates a new HTTP server and sets up routing
+// any Store works: db.NewStore for postgres, db.NewMemStore for tests
+// tokenMaker issues the tokens of the login and refresh endpoints and authenticates every other request
+func NewServer(store db.Store, tokenMaker token.Maker, opts ...ServerOption) *Server {
+	server := &Server{
+		store:                store,
+		tokenMaker:           tokenMaker,
+		accessTokenDuration:  DefaultAccessTokenDuration,
+		refreshTokenDuration: DefaultRefreshTokenDuration,
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("currency", validCurrency)
+		v.RegisterValidation("webhook_event", validWebhookEvent)
+	}
+
+	server.setupRouter()
+	return server
+}
+
+func (server *Server) setupRouter() {
+	router := gin.Default()
+	// the handlers hand their *gin.Context to the store, its values must include the ones of the request context (db.WithActor)
+	router.ContextWithFallback = true
+
+	router.POST("/users", server.createUser)
+	router.POST("/users/login", server.loginUser)
+	router.POST("/tokens/refresh", server.refreshAccessToken)
+
+	// everything else needs an access token, and only ever touches the accounts of its owner
+	authRoutes := router.Group("/").Use(authMiddleware(server.tokenMaker))
+	authRoutes.POST("/accounts", server.createAccount)
+	authRoutes.GET("/accounts/:id", server.getAccount)
+	authRoutes.GET("/accounts", server.listAccounts)
+
+	authRoutes.POST("/transfers", server.createTransfer)
+
+	authRoutes.POST("/webhooks", server.createWebhook)
+	authRoutes.GET("/webhooks", server.listWebhooks)
+	authRoutes.DELETE("/webhooks/:id", server.deleteWebhook)
+	authRoutes.GET("/webhooks/:id/deliveries", server.listWebhookDeliveries)
+	authRoutes.GET("/webhooks/:id/deliveries/:delivery_id/attempts", server.listWebhookAttempts)
+	authRoutes.POST("/webhooks/:id/deliveries/:delivery_id/retry", server.retryWebhookDelivery)
+
+	server.router = router
+}
+
+// ServeHTTP makes the server usable with httptest and any http.Server
+func (server *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	server.router.ServeHTTP(w, req)
+}
+
+// Start listens on address and serves until ctx is cancelled (see Serve)
+func (server *Server) Start(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return server.Serve(ctx, listener)
+}
+
+// Serve accepts connections on listener until ctx is cancelled, then shuts down gracefully:
+// no new connections are accepted and in-flight requests get up to ShutdownTimeout to finish
+// returns nil after a clean shutdown
+func (server *Server) Serve(ctx context.Context, listener net.Listener) error {
+	httpServer := &http.Server{
+		Handler:           server.router,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
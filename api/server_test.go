@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeShutdown(t *testing.T) {
+	server := newTestServer(t, db.NewMemStore())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, listener)
+	}()
+
+	response, err := http.Get("http://" + listener.Addr().String() + "/accounts/1")
+	require.NoError(t, err)
+	response.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+	// a clean shutdown returns nil and closes the listener
+	cancel()
+	require.NoError(t, <-done)
+	_, err = http.Get("http://" + listener.Addr().String() + "/accounts/1")
+	require.Error(t, err)
+}
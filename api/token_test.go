@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshAccessTokenAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	user := createRandomUser(t, store)
+
+	testCases := []struct {
+		name          string
+		refreshToken  func(t *testing.T) string
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			refreshToken: func(t *testing.T) string {
+				return createToken(t, server.tokenMaker, user.Username, token.TypeRefresh, time.Hour)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var response refreshAccessTokenResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				payload, err := server.tokenMaker.VerifyToken(response.AccessToken)
+				require.NoError(t, err)
+				require.Equal(t, user.Username, payload.Username)
+				require.Equal(t, token.TypeAccess, payload.Type)
+			},
+		},
+		{
+			name: "AccessToken",
+			refreshToken: func(t *testing.T) string {
+				return createToken(t, server.tokenMaker, user.Username, token.TypeAccess, time.Hour)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "ExpiredToken",
+			refreshToken: func(t *testing.T) string {
+				return createToken(t, server.tokenMaker, user.Username, token.TypeRefresh, -time.Minute)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "UnknownUser",
+			refreshToken: func(t *testing.T) string {
+				return createToken(t, server.tokenMaker, util.RandomString(10), token.TypeRefresh, time.Hour)
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "InvalidToken",
+			refreshToken: func(t *testing.T) string {
+				return "not-a-token"
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body := refreshAccessTokenRequest{RefreshToken: tc.refreshToken(t)}
+			recorder := serve(t, server, http.MethodPost, "/tokens/refresh", "", body)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
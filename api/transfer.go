@@ -0,0 +1,56 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+type transferRequest struct {
+	FromAccountID  int64  `json:"from_account_id" binding:"required,min=1"`
+	ToAccountID    int64  `json:"to_account_id" binding:"required,min=1,nefield=FromAccountID"`
+	Amount         int64  `json:"amount" binding:"required,gt=0"`
+	Currency       string `json:"currency" binding:"required,currency"`
+	IdempotencyKey string `json:"idempotency_key" binding:"max=255"`
+}
+
+// only the owner of the source account can send money from it
+// the accounts, currencies and funds are checked by TransferTx itself, under lock
+func (server *Server) createTransfer(ctx *gin.Context) {
+	var req transferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	// the owner never changes, so checking it outside of the transaction is safe
+	fromAccount, err := server.store.GetAccount(ctx, req.FromAccountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", db.ErrAccountNotFound, req.FromAccountID)
+		}
+		abortWithError(ctx, err)
+		return
+	}
+	if fromAccount.Owner != authPayload(ctx).Username {
+		ctx.JSON(http.StatusForbidden, errorResponse(errNotAccountOwner))
+		return
+	}
+
+	result, err := server.store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID:  req.FromAccountID,
+		ToAccountID:    req.ToAccountID,
+		Amount:         req.Amount,
+		Currency:       req.Currency,
+		IdempotencyKey: req.IdempotencyKey,
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
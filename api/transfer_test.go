@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTransferAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	user1 := createRandomUser(t, store)
+	account1 := createRandomAccount(t, store, user1.Username, util.USD)
+	account2 := createRandomAccount(t, store, createRandomUser(t, store).Username, util.USD)
+	account3 := createRandomAccount(t, store, user1.Username, util.EUR)
+	frozen := createRandomAccount(t, store, createRandomUser(t, store).Username, util.USD)
+	_, err := store.FreezeAccountTx(context.Background(), db.AccountStatusTxParams{AccountID: frozen.ID, Reason: "dispute"})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		username      string
+		body          transferRequest
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			username: user1.Username,
+			body:     transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var result db.TransferTxResult
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+				require.Equal(t, int64(10), result.Transfer.Amount)
+				require.Equal(t, account1.Balance-10, result.FromAccount.Balance)
+				require.Equal(t, account2.Balance+10, result.ToAccount.Balance)
+				transfer, err := store.GetTransfer(context.Background(), result.Transfer.ID)
+				require.NoError(t, err)
+				require.Equal(t, account1.ID, transfer.FromAccountID)
+			},
+		},
+		{
+			name:     "FromAccountNotFound",
+			username: user1.Username,
+			body:     transferRequest{FromAccountID: 1000, ToAccountID: account2.ID, Amount: 10, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusNotFound, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "NotOwner",
+			username: account2.Owner,
+			body:     transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "NoAuthorization",
+			body: transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "CurrencyMismatch",
+			username: user1.Username,
+			body:     transferRequest{FromAccountID: account3.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "InsufficientFunds",
+			username: account2.Owner,
+			body:     transferRequest{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 1_000_000, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "FrozenAccount",
+			username: frozen.Owner,
+			body:     transferRequest{FromAccountID: frozen.ID, ToAccountID: account1.ID, Amount: 10, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "SameAccount",
+			username: user1.Username,
+			body:     transferRequest{FromAccountID: account1.ID, ToAccountID: account1.ID, Amount: 10, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "NegativeAmount",
+			username: user1.Username,
+			body:     transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: -1, Currency: util.USD},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "InvalidCurrency",
+			username: user1.Username,
+			body:     transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: "XYZ"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var authorization string
+			if tc.username != "" {
+				authorization = accessToken(t, server, tc.username)
+			}
+			recorder := serve(t, server, http.MethodPost, "/transfers", authorization, tc.body)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestCreateTransferAPIIdempotency(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	account1 := createRandomAccount(t, store, createRandomUser(t, store).Username, util.USD)
+	account2 := createRandomAccount(t, store, createRandomUser(t, store).Username, util.USD)
+	authorization := accessToken(t, server, account1.Owner)
+	body := transferRequest{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD, IdempotencyKey: util.RandomString(12)}
+
+	first := serve(t, server, http.MethodPost, "/transfers", authorization, body)
+	require.Equal(t, http.StatusOK, first.Code)
+	replay := serve(t, server, http.MethodPost, "/transfers", authorization, body)
+	require.Equal(t, http.StatusOK, replay.Code)
+	require.JSONEq(t, first.Body.String(), replay.Body.String())
+
+	body.Amount = 20
+	conflict := serve(t, server, http.MethodPost, "/transfers", authorization, body)
+	require.Equal(t, http.StatusConflict, conflict.Code)
+	requireErrorBody(t, conflict)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateUserAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	existing := createRandomUser(t, store)
+
+	testCases := []struct {
+		name          string
+		body          createUserRequest
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: createUserRequest{Username: "alice", Password: "secret123", FullName: "Alice", Email: "alice@email.com"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.NotContains(t, recorder.Body.String(), "hashed_password")
+				user, err := store.GetUser(context.Background(), "alice")
+				require.NoError(t, err)
+				require.NoError(t, util.CheckPassword("secret123", user.HashedPassword))
+				requireBodyMatch(t, recorder, newUserResponse(user))
+			},
+		},
+		{
+			name: "DuplicateUsername",
+			body: createUserRequest{Username: existing.Username, Password: "secret123", FullName: "Bob", Email: "bob@email.com"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "InvalidUsername",
+			body: createUserRequest{Username: "bob#1", Password: "secret123", FullName: "Bob", Email: "bob@email.com"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "InvalidEmail",
+			body: createUserRequest{Username: "bob", Password: "secret123", FullName: "Bob", Email: "bob"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			// 40 characters but 80 bytes
+			name: "TooLongPassword",
+			body: createUserRequest{Username: "bob", Password: strings.Repeat("é", 40), FullName: "Bob", Email: "bob@email.com"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "TooShortPassword",
+			body: createUserRequest{Username: "bob", Password: "123", FullName: "Bob", Email: "bob@email.com"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serve(t, server, http.MethodPost, "/users", "", tc.body)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+func TestLoginUserAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	password := util.RandomString(8)
+	user, err := store.RegisterUser(context.Background(), db.RegisterUserParams{
+		Username: util.RandomOwner(),
+		Password: password,
+		FullName: util.RandomOwner(),
+		Email:    util.RandomEmail(),
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		body          loginUserRequest
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			body: loginUserRequest{Username: user.Username, Password: password},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var response loginUserResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.Equal(t, user.Username, response.User.Username)
+
+				payload, err := server.tokenMaker.VerifyToken(response.AccessToken)
+				require.NoError(t, err)
+				require.Equal(t, user.Username, payload.Username)
+				require.Equal(t, token.TypeAccess, payload.Type)
+				payload, err = server.tokenMaker.VerifyToken(response.RefreshToken)
+				require.NoError(t, err)
+				require.Equal(t, token.TypeRefresh, payload.Type)
+				require.True(t, response.RefreshTokenExpiresAt.After(response.AccessTokenExpiresAt))
+			},
+		},
+		{
+			name: "WrongPassword",
+			body: loginUserRequest{Username: user.Username, Password: password + "x"},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "UnknownUser",
+			body: loginUserRequest{Username: util.RandomString(10), Password: password},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "InvalidUsername",
+			body: loginUserRequest{Username: "bob#1", Password: password},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := serve(t, server, http.MethodPost, "/users/login", "", tc.body)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
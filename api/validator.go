@@ -0,0 +1,23 @@
+package api
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/webhook"
+)
+
+// validCurrency backs the "currency" binding tag
+var validCurrency validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if currency, ok := fieldLevel.Field().Interface().(string); ok {
+		return util.IsSupportedCurrency(currency)
+	}
+	return false
+}
+
+// validWebhookEvent backs the "webhook_event" binding tag
+var validWebhookEvent validator.Func = func(fieldLevel validator.FieldLevel) bool {
+	if eventType, ok := fieldLevel.Field().Interface().(string); ok {
+		return webhook.ValidEventType(eventType)
+	}
+	return false
+}
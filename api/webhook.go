@@ -0,0 +1,223 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/webhook"
+)
+
+var errWebhookDeliveryNotDead = errors.New("only dead webhook deliveries can be retried")
+
+type createWebhookRequest struct {
+	URL                 string   `json:"url" binding:"required,url"` // https, on a public host (webhook.CheckURL)
+	EventTypes          []string `json:"event_types" binding:"required,min=1,dive,webhook_event"`
+	LowBalanceThreshold int64    `json:"low_balance_threshold" binding:"min=0"` // balance.low fires when a debit goes below it
+}
+
+// webhookResponse is an endpoint without its signing secret
+type webhookResponse struct {
+	ID                  int64     `json:"id"`
+	URL                 string    `json:"url"`
+	EventTypes          []string  `json:"event_types"`
+	LowBalanceThreshold int64     `json:"low_balance_threshold"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+func newWebhookResponse(endpoint db.WebhookEndpoint) webhookResponse {
+	return webhookResponse{
+		ID:                  endpoint.ID,
+		URL:                 endpoint.Url,
+		EventTypes:          endpoint.EventTypes,
+		LowBalanceThreshold: endpoint.LowBalanceThreshold,
+		CreatedAt:           endpoint.CreatedAt,
+	}
+}
+
+// createWebhookResponse is the only response that carries the secret, the owner needs it to verify the signatures
+type createWebhookResponse struct {
+	webhookResponse
+	Secret string `json:"secret"`
+}
+
+// new endpoints belong to the authenticated user and only receive the events of their accounts
+func (server *Server) createWebhook(ctx *gin.Context) {
+	var req createWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if err := webhook.CheckURL(ctx, req.URL); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	endpoint, err := server.store.CreateWebhookEndpoint(ctx, db.CreateWebhookEndpointParams{
+		Owner:               authPayload(ctx).Username,
+		Url:                 req.URL,
+		Secret:              secret,
+		EventTypes:          req.EventTypes,
+		LowBalanceThreshold: req.LowBalanceThreshold,
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, createWebhookResponse{webhookResponse: newWebhookResponse(endpoint), Secret: endpoint.Secret})
+}
+
+func (server *Server) listWebhooks(ctx *gin.Context) {
+	endpoints, err := server.store.ListWebhookEndpoints(ctx, authPayload(ctx).Username)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	rsp := make([]webhookResponse, len(endpoints))
+	for i, endpoint := range endpoints {
+		rsp[i] = newWebhookResponse(endpoint)
+	}
+	ctx.JSON(http.StatusOK, rsp)
+}
+
+type webhookRequest struct {
+	ID int64 `uri:"id" binding:"required,min=1"`
+}
+
+// deleting an endpoint also drops its deliveries and their attempt log
+func (server *Server) deleteWebhook(ctx *gin.Context) {
+	endpoint, ok := server.ownWebhook(ctx)
+	if !ok {
+		return
+	}
+	if err := server.store.DeleteWebhookEndpoint(ctx, endpoint.ID); err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+type listWebhookDeliveriesRequest struct {
+	Status   string `form:"status" binding:"omitempty,oneof=pending delivered dead"`
+	PageID   int32  `form:"page_id" binding:"required,min=1"`
+	PageSize int32  `form:"page_size" binding:"required,min=5,max=100"`
+}
+
+func (server *Server) listWebhookDeliveries(ctx *gin.Context) {
+	endpoint, ok := server.ownWebhook(ctx)
+	if !ok {
+		return
+	}
+	var req listWebhookDeliveriesRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	deliveries, err := server.store.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		Status:     sql.NullString{String: req.Status, Valid: req.Status != ""},
+		Limit:      req.PageSize,
+		Offset:     (req.PageID - 1) * req.PageSize,
+	})
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []db.WebhookDelivery{} // [] rather than null
+	}
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+func (server *Server) listWebhookAttempts(ctx *gin.Context) {
+	delivery, ok := server.ownWebhookDelivery(ctx)
+	if !ok {
+		return
+	}
+	attempts, err := server.store.ListWebhookAttempts(ctx, delivery.ID)
+	if err != nil {
+		abortWithError(ctx, err)
+		return
+	}
+	if attempts == nil {
+		attempts = []db.WebhookAttempt{}
+	}
+	ctx.JSON(http.StatusOK, attempts)
+}
+
+// only dead deliveries can be retried, they start over with a fresh retry schedule
+func (server *Server) retryWebhookDelivery(ctx *gin.Context) {
+	delivery, ok := server.ownWebhookDelivery(ctx)
+	if !ok {
+		return
+	}
+	delivery, err := server.store.RequeueWebhookDelivery(ctx, db.RequeueWebhookDeliveryParams{
+		ID:            delivery.ID,
+		NextAttemptAt: time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			ctx.JSON(http.StatusConflict, errorResponse(errWebhookDeliveryNotDead))
+			return
+		}
+		abortWithError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, delivery)
+}
+
+// ownWebhook reads the endpoint of the :id parameter and checks that it belongs to the authenticated user
+// the response is already written when it returns false
+func (server *Server) ownWebhook(ctx *gin.Context) (db.WebhookEndpoint, bool) {
+	var req webhookRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return db.WebhookEndpoint{}, false
+	}
+	endpoint, err := server.store.GetWebhookEndpoint(ctx, req.ID)
+	if err != nil {
+		abortWithError(ctx, err)
+		return db.WebhookEndpoint{}, false
+	}
+	if endpoint.Owner != authPayload(ctx).Username {
+		ctx.JSON(http.StatusForbidden, errorResponse(errNotWebhookOwner))
+		return db.WebhookEndpoint{}, false
+	}
+	return endpoint, true
+}
+
+type webhookDeliveryRequest struct {
+	ID         int64 `uri:"id" binding:"required,min=1"`
+	DeliveryID int64 `uri:"delivery_id" binding:"required,min=1"`
+}
+
+// ownWebhookDelivery reads the delivery of the :delivery_id parameter, it must belong to the endpoint of :id (see ownWebhook)
+func (server *Server) ownWebhookDelivery(ctx *gin.Context) (db.WebhookDelivery, bool) {
+	endpoint, ok := server.ownWebhook(ctx)
+	if !ok {
+		return db.WebhookDelivery{}, false
+	}
+	var req webhookDeliveryRequest
+	if err := ctx.ShouldBindUri(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		return db.WebhookDelivery{}, false
+	}
+	delivery, err := server.store.GetWebhookDelivery(ctx, req.DeliveryID)
+	if err == nil && delivery.EndpointID != endpoint.ID {
+		err = sql.ErrNoRows // other endpoints' deliveries don't exist as far as this one is concerned
+	}
+	if err != nil {
+		abortWithError(ctx, err)
+		return db.WebhookDelivery{}, false
+	}
+	return delivery, true
+}
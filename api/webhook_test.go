@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWebhookAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	user := createRandomUser(t, store)
+
+	testCases := []struct {
+		name          string
+		username      string
+		body          any
+		checkResponse func(t *testing.T, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:     "OK",
+			username: user.Username,
+			body: createWebhookRequest{
+				URL:                 "https://203.0.113.10/hooks",
+				EventTypes:          []string{db.EventTransferCreated, db.EventAccountFrozen, webhook.EventBalanceLow},
+				LowBalanceThreshold: 100,
+			},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var got createWebhookResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+				endpoint, err := store.GetWebhookEndpoint(context.Background(), got.ID)
+				require.NoError(t, err)
+				require.Equal(t, user.Username, endpoint.Owner)
+				require.Equal(t, "https://203.0.113.10/hooks", endpoint.Url)
+				require.EqualValues(t, 100, endpoint.LowBalanceThreshold)
+				// the secret is only ever shown here
+				require.NotEmpty(t, endpoint.Secret)
+				requireBodyMatch(t, recorder, createWebhookResponse{webhookResponse: newWebhookResponse(endpoint), Secret: endpoint.Secret})
+			},
+		},
+		{
+			name:     "InvalidEventType",
+			username: user.Username,
+			body:     createWebhookRequest{URL: "https://203.0.113.10/hooks", EventTypes: []string{"user.created"}},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "NoEventTypes",
+			username: user.Username,
+			body:     createWebhookRequest{URL: "https://203.0.113.10/hooks", EventTypes: []string{}},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "InvalidURL",
+			username: user.Username,
+			body:     createWebhookRequest{URL: "example.com/hooks", EventTypes: []string{db.EventTransferCreated}},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "NotHTTPS",
+			username: user.Username,
+			body:     createWebhookRequest{URL: "http://203.0.113.10/hooks", EventTypes: []string{db.EventTransferCreated}},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "InternalHost",
+			username: user.Username,
+			body:     createWebhookRequest{URL: "https://169.254.169.254/latest/meta-data", EventTypes: []string{db.EventTransferCreated}},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name:     "NegativeThreshold",
+			username: user.Username,
+			body:     createWebhookRequest{URL: "https://203.0.113.10/hooks", EventTypes: []string{webhook.EventBalanceLow}, LowBalanceThreshold: -1},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+		{
+			name: "NoAuthorization",
+			body: createWebhookRequest{URL: "https://203.0.113.10/hooks", EventTypes: []string{db.EventTransferCreated}},
+			checkResponse: func(t *testing.T, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, recorder.Code)
+				requireErrorBody(t, recorder)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var authorization string
+			if tc.username != "" {
+				authorization = accessToken(t, server, tc.username)
+			}
+			recorder := serve(t, server, http.MethodPost, "/webhooks", authorization, tc.body)
+			tc.checkResponse(t, recorder)
+		})
+	}
+}
+
+// createRandomWebhook registers an endpoint of owner with a pending delivery of a transfer.created event
+func createRandomWebhook(t *testing.T, store db.Store, owner string) (db.WebhookEndpoint, db.WebhookDelivery) {
+	ctx := context.Background()
+	endpoint, err := store.CreateWebhookEndpoint(ctx, db.CreateWebhookEndpointParams{
+		Owner:      owner,
+		Url:        "https://example.com/" + util.RandomString(6),
+		Secret:     util.RandomString(32),
+		EventTypes: []string{db.EventTransferCreated},
+	})
+	require.NoError(t, err)
+	event, err := store.CreateOutboxEvent(ctx, db.CreateOutboxEventParams{
+		EventType:     db.EventTransferCreated,
+		AggregateType: db.AggregateTypeTransfer,
+		AggregateID:   1,
+		Payload:       []byte(`{}`),
+	})
+	require.NoError(t, err)
+	_, err = store.CreateWebhookDelivery(ctx, db.CreateWebhookDeliveryParams{
+		EndpointID:    endpoint.ID,
+		EventID:       event.ID,
+		EventType:     db.EventTransferCreated,
+		Payload:       []byte(`{"type":"transfer.created"}`),
+		NextAttemptAt: time.Now(),
+	})
+	require.NoError(t, err)
+	deliveries, err := store.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{EndpointID: endpoint.ID, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	return endpoint, deliveries[0]
+}
+
+func TestListWebhooksAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	user := createRandomUser(t, store)
+	endpoint1, _ := createRandomWebhook(t, store, user.Username)
+	endpoint2, _ := createRandomWebhook(t, store, user.Username)
+	createRandomWebhook(t, store, createRandomUser(t, store).Username)
+
+	recorder := serve(t, server, http.MethodGet, "/webhooks", accessToken(t, server, user.Username), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatch(t, recorder, []webhookResponse{newWebhookResponse(endpoint1), newWebhookResponse(endpoint2)})
+	require.NotContains(t, recorder.Body.String(), endpoint1.Secret)
+
+	recorder = serve(t, server, http.MethodGet, "/webhooks", accessToken(t, server, createRandomUser(t, store).Username), nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, "[]", recorder.Body.String())
+}
+
+func TestWebhookDeliveriesAPI(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	ctx := context.Background()
+	user := createRandomUser(t, store)
+	authorization := accessToken(t, server, user.Username)
+	endpoint, delivery := createRandomWebhook(t, store, user.Username)
+	otherEndpoint, otherDelivery := createRandomWebhook(t, store, createRandomUser(t, store).Username)
+	deliveries := fmt.Sprintf("/webhooks/%d/deliveries", endpoint.ID)
+	attempts := fmt.Sprintf("%s/%d/attempts", deliveries, delivery.ID)
+	retry := fmt.Sprintf("%s/%d/retry", deliveries, delivery.ID)
+
+	recorder := serve(t, server, http.MethodGet, deliveries+"?page_id=1&page_size=5", authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatch(t, recorder, []db.WebhookDelivery{delivery})
+	recorder = serve(t, server, http.MethodGet, deliveries+"?status=dead&page_id=1&page_size=5", authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, "[]", recorder.Body.String())
+	recorder = serve(t, server, http.MethodGet, deliveries+"?status=lost&page_id=1&page_size=5", authorization, nil)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	// pending deliveries can't be retried by hand
+	recorder = serve(t, server, http.MethodPost, retry, authorization, nil)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	requireErrorBody(t, recorder)
+
+	for i := 0; i < 2; i++ {
+		_, err := store.RecordWebhookAttemptTx(ctx, db.RecordWebhookAttemptTxParams{
+			DeliveryID:    delivery.ID,
+			StatusCode:    http.StatusBadGateway,
+			Error:         "unexpected status 502 Bad Gateway",
+			MaxAttempts:   2,
+			NextAttemptAt: time.Now(),
+		})
+		require.NoError(t, err)
+	}
+	log, err := store.ListWebhookAttempts(ctx, delivery.ID)
+	require.NoError(t, err)
+	recorder = serve(t, server, http.MethodGet, attempts, authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	requireBodyMatch(t, recorder, log)
+
+	recorder = serve(t, server, http.MethodPost, retry, authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var requeued db.WebhookDelivery
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &requeued))
+	require.Equal(t, db.WebhookDeliveryPending, requeued.Status)
+	require.Zero(t, requeued.Attempts)
+
+	// other owners' endpoints, and deliveries of other endpoints
+	for _, url := range []string{
+		fmt.Sprintf("/webhooks/%d/deliveries?page_id=1&page_size=5", otherEndpoint.ID),
+		fmt.Sprintf("/webhooks/%d/deliveries/%d/attempts", otherEndpoint.ID, otherDelivery.ID),
+	} {
+		recorder = serve(t, server, http.MethodGet, url, authorization, nil)
+		require.Equal(t, http.StatusForbidden, recorder.Code, url)
+		requireErrorBody(t, recorder)
+	}
+	recorder = serve(t, server, http.MethodGet, fmt.Sprintf("%s/%d/attempts", deliveries, otherDelivery.ID), authorization, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = serve(t, server, http.MethodDelete, fmt.Sprintf("/webhooks/%d", otherEndpoint.ID), authorization, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = serve(t, server, http.MethodDelete, fmt.Sprintf("/webhooks/%d", endpoint.ID), authorization, nil)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	recorder = serve(t, server, http.MethodGet, attempts, authorization, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	requireErrorBody(t, recorder)
+}
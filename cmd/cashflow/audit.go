@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// listAuditLog prints the audit log, oldest first, filtered by actor, account and time
+// the table shows who changed what, -o json adds the rows before and after each change
+func (c *cli) listAuditLog(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	actor := flags.String("actor", "", "only the changes made by this actor")
+	account := flags.Int64("account", 0, "only the changes about this account id")
+	from := flags.String("from", "", "only the changes after this time (RFC 3339)")
+	to := flags.String("to", "", "only the changes up to this time (RFC 3339)")
+	page := flags.Int("page", 1, "page number, starting at 1")
+	pageSize := flags.Int("page-size", 50, "changes per page")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *page < 1 || *pageSize < 1 {
+		return usageError("-page and -page-size must be positive")
+	}
+	if *account < 0 {
+		return usageError("invalid -account %d", *account)
+	}
+
+	arg := db.ListAuditLogsParams{
+		Actor:     sql.NullString{String: *actor, Valid: *actor != ""},
+		AccountID: sql.NullInt64{Int64: *account, Valid: *account != 0},
+		Limit:     int32(*pageSize),
+		Offset:    int32((*page - 1) * *pageSize),
+	}
+	var err error
+	if arg.FromTime, err = parseTime("-from", *from); err != nil {
+		return err
+	}
+	if arg.ToTime, err = parseTime("-to", *to); err != nil {
+		return err
+	}
+	logs, err := c.store.ListAuditLogs(ctx, arg)
+	if err != nil {
+		return fmt.Errorf("cannot list the audit log: %w", err)
+	}
+	if logs == nil {
+		logs = []db.AuditLog{}
+	}
+	t := table{header: auditHeader}
+	for _, change := range logs {
+		t.rows = append(t.rows, auditRow(change))
+	}
+	return c.print(logs, t)
+}
+
+// parseTime parses an optional RFC 3339 flag value
+func parseTime(name, value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return sql.NullTime{}, usageError("invalid %s %q, expected RFC 3339 (2006-01-02T15:04:05Z)", name, value)
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+var auditHeader = []string{"ID", "ACTOR", "ACTION", "TARGET", "ACCOUNTS", "CREATED AT"}
+
+func auditRow(change db.AuditLog) []string {
+	accounts := make([]string, len(change.AccountIds))
+	for i, id := range change.AccountIds {
+		accounts[i] = fmt.Sprint(id)
+	}
+	if len(accounts) == 0 {
+		accounts = []string{"-"}
+	}
+	return []string{
+		fmt.Sprint(change.ID),
+		change.Actor,
+		change.Action,
+		change.TargetType + " " + change.TargetID,
+		strings.Join(accounts, ","),
+		formatTime(change.CreatedAt),
+	}
+}
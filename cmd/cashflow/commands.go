@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+)
+
+// parse parses the flags of a subcommand, they may come before or after its arguments
+// returns exactly want arguments
+func parse(flags *flag.FlagSet, args []string, want int) ([]string, error) {
+	flags.SetOutput(os.Stderr)
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(positional) != want {
+		flags.Usage()
+		return nil, usageError("%s expects %d argument(s), got %d", flags.Name(), want, len(positional))
+	}
+	return positional, nil
+}
+
+func parseID(name, arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id < 1 {
+		return 0, usageError("invalid %s %q", name, arg)
+	}
+	return id, nil
+}
+
+func (c *cli) createAccount(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("account create", flag.ContinueOnError)
+	owner := flags.String("owner", "", "username of the owner (required)")
+	currency := flags.String("currency", "", "currency of the account (required)")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *owner == "" {
+		return usageError("-owner is required")
+	}
+	if !util.IsSupportedCurrency(*currency) {
+		return usageError("unsupported currency %q", *currency)
+	}
+
+	account, err := c.store.CreateAccount(ctx, db.CreateAccountParams{Owner: *owner, Currency: *currency, Balance: 0})
+	if err != nil {
+		return fmt.Errorf("cannot create account: %w", err)
+	}
+	return c.print(account, table{header: accountHeader, rows: [][]string{accountRow(account)}})
+}
+
+func (c *cli) getAccount(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("account get", flag.ContinueOnError)
+	positional, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("account id", positional[0])
+	if err != nil {
+		return err
+	}
+
+	account, err := c.getAccountByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return c.print(account, table{header: accountHeader, rows: [][]string{accountRow(account)}})
+}
+
+func (c *cli) getAccountByID(ctx context.Context, id int64) (db.Account, error) {
+	account, err := c.store.GetAccount(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Account{}, fmt.Errorf("%w: %d", db.ErrAccountNotFound, id)
+	}
+	return account, err
+}
+
+func (c *cli) listAccounts(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("account list", flag.ContinueOnError)
+	owner := flags.String("owner", "", "username of the owner (required)")
+	page := flags.Int("page", 1, "page number, starting at 1")
+	pageSize := flags.Int("page-size", 20, "accounts per page")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *owner == "" {
+		return usageError("-owner is required")
+	}
+	if *page < 1 || *pageSize < 1 {
+		return usageError("-page and -page-size must be positive")
+	}
+
+	accounts, err := c.store.ListAccounts(ctx, db.ListAccountsParams{
+		Owner:  *owner,
+		Limit:  int32(*pageSize),
+		Offset: int32((*page - 1) * *pageSize),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot list accounts: %w", err)
+	}
+	if accounts == nil {
+		accounts = []db.Account{} // [] rather than null
+	}
+	t := table{header: accountHeader}
+	for _, account := range accounts {
+		t.rows = append(t.rows, accountRow(account))
+	}
+	return c.print(accounts, t)
+}
+
+func (c *cli) freezeAccount(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("account freeze", flag.ContinueOnError)
+	reason := flags.String("reason", "", "why the account is frozen (required)")
+	actor := flags.String("actor", db.ActorFromContext(ctx), "who requested the freeze (the global -actor)")
+	positional, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("account id", positional[0])
+	if err != nil {
+		return err
+	}
+
+	result, err := c.store.FreezeAccountTx(ctx, db.AccountStatusTxParams{AccountID: id, Reason: *reason, Actor: *actor})
+	if err != nil {
+		return fmt.Errorf("cannot freeze account %d: %w", id, err)
+	}
+	return c.print(result, table{
+		header: accountHeader,
+		rows:   [][]string{accountRow(result.Account)},
+		footer: fmt.Sprintf("%s -> %s by %q: %s", result.Change.FromStatus, result.Change.ToStatus, result.Change.Actor, result.Change.Reason),
+	})
+}
+
+func (c *cli) transfer(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("transfer", flag.ContinueOnError)
+	from := flags.Int64("from", 0, "id of the account to debit (required)")
+	to := flags.Int64("to", 0, "id of the account to credit (required)")
+	amount := flags.Int64("amount", 0, "amount in minor units (required)")
+	currency := flags.String("currency", "", "currency of both accounts (required)")
+	idempotencyKey := flags.String("idempotency-key", "", "makes a retried transfer return the original result")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+	if *from < 1 || *to < 1 {
+		return usageError("-from and -to are required")
+	}
+
+	// amount, currency and funds are checked by TransferTx
+	result, err := c.store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID:  *from,
+		ToAccountID:    *to,
+		Amount:         *amount,
+		Currency:       *currency,
+		IdempotencyKey: *idempotencyKey,
+	})
+	if err != nil {
+		return fmt.Errorf("transfer failed: %w", err)
+	}
+	return c.print(result, table{
+		header: transferHeader,
+		rows:   [][]string{transferRow(result.Transfer)},
+		footer: fmt.Sprintf("balances: %d = %d, %d = %d", result.FromAccount.ID, result.FromAccount.Balance, result.ToAccount.ID, result.ToAccount.Balance),
+	})
+}
+
+// page is the JSON output of the history commands
+type page[T any] struct {
+	Items         []T    `json:"items"`
+	NextPageToken string `json:"next_page_token"` // pass it to -after for the next page, empty on the last one
+}
+
+func (c *cli) listEntries(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("entries", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "entries per page")
+	after := flags.String("after", "", "next page token printed by the previous page")
+	positional, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("account id", positional[0])
+	if err != nil {
+		return err
+	}
+	if *limit < 1 {
+		return usageError("-limit must be positive")
+	}
+
+	arg := db.ListEntriesParams{
+		AccountID: sql.NullInt64{Int64: id, Valid: true},
+		Limit:     int32(*limit) + 1, // one more row tells whether there is a next page
+	}
+	if *after != "" {
+		cursor, err := db.ParseCursor(*after)
+		if err != nil {
+			return usageError("invalid -after: %v", err)
+		}
+		arg = arg.After(cursor)
+	}
+	entries, err := c.store.ListEntries(ctx, arg)
+	if err != nil {
+		return fmt.Errorf("cannot list entries: %w", err)
+	}
+
+	result := page[db.Entry]{Items: entries}
+	if len(entries) > *limit {
+		result.Items = entries[:*limit]
+		result.NextPageToken = db.EntryCursor(result.Items[*limit-1]).String()
+	}
+	if result.Items == nil {
+		result.Items = []db.Entry{}
+	}
+	t := table{header: entryHeader, footer: nextPage(result.NextPageToken)}
+	for _, entry := range result.Items {
+		t.rows = append(t.rows, entryRow(entry))
+	}
+	return c.print(result, t)
+}
+
+func (c *cli) listTransfers(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("transfers", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "transfers per page")
+	after := flags.String("after", "", "next page token printed by the previous page")
+	positional, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("account id", positional[0])
+	if err != nil {
+		return err
+	}
+	if *limit < 1 {
+		return usageError("-limit must be positive")
+	}
+
+	arg := db.ListTransfersParams{
+		AccountID: sql.NullInt64{Int64: id, Valid: true},
+		Limit:     int32(*limit) + 1, // one more row tells whether there is a next page
+	}
+	if *after != "" {
+		cursor, err := db.ParseCursor(*after)
+		if err != nil {
+			return usageError("invalid -after: %v", err)
+		}
+		arg = arg.After(cursor)
+	}
+	transfers, err := c.store.ListTransfers(ctx, arg)
+	if err != nil {
+		return fmt.Errorf("cannot list transfers: %w", err)
+	}
+
+	result := page[db.Transfer]{Items: transfers}
+	if len(transfers) > *limit {
+		result.Items = transfers[:*limit]
+		result.NextPageToken = db.TransferCursor(result.Items[*limit-1]).String()
+	}
+	if result.Items == nil {
+		result.Items = []db.Transfer{}
+	}
+	t := table{header: transferHeader, footer: nextPage(result.NextPageToken)}
+	for _, transfer := range result.Items {
+		t.rows = append(t.rows, transferRow(transfer))
+	}
+	return c.print(result, t)
+}
+
+func nextPage(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "next page: -after " + token
+}
+
+// balanceCheck is the result of the balance command
+type balanceCheck struct {
+	AccountID        int64  `json:"account_id"`
+	Currency         string `json:"currency"`
+	Balance          int64  `json:"balance"`           // accounts.balance
+	EntriesTotal     int64  `json:"entries_total"`     // SUM(entries.amount), must equal Balance
+	AvailableBalance int64  `json:"available_balance"` // Balance minus the active holds
+	Consistent       bool   `json:"consistent"`
+}
+
+// errBalanceDrift is returned after printing a balance that doesn't match its entries
+var errBalanceDrift = errors.New("balance does not match the sum of its entries, see cmd/reconcile")
+
+func (c *cli) checkBalance(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("balance", flag.ContinueOnError)
+	positional, err := parse(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	id, err := parseID("account id", positional[0])
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.getAccountByID(ctx, id); err != nil {
+		return err
+	}
+	balance, err := c.store.GetAccountBalance(ctx, id)
+	if err != nil {
+		return fmt.Errorf("cannot read balance: %w", err)
+	}
+	total, err := c.store.GetAccountEntriesTotal(ctx, id)
+	if err != nil {
+		return fmt.Errorf("cannot sum entries: %w", err)
+	}
+
+	check := balanceCheck{
+		AccountID:        id,
+		Currency:         balance.Currency,
+		Balance:          balance.LedgerBalance,
+		EntriesTotal:     total,
+		AvailableBalance: balance.AvailableBalance,
+		Consistent:       balance.LedgerBalance == total,
+	}
+	err = c.print(check, table{
+		header: []string{"ACCOUNT", "CURRENCY", "BALANCE", "ENTRIES TOTAL", "AVAILABLE", "CONSISTENT"},
+		rows: [][]string{{
+			fmt.Sprint(check.AccountID),
+			check.Currency,
+			fmt.Sprint(check.Balance),
+			fmt.Sprint(check.EntriesTotal),
+			fmt.Sprint(check.AvailableBalance),
+			strconv.FormatBool(check.Consistent),
+		}},
+	})
+	if err == nil && !check.Consistent {
+		err = fmt.Errorf("%w: account %d", errBalanceDrift, id)
+	}
+	return err
+}
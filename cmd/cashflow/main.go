@@ -0,0 +1,161 @@
+// cashflow is the operator CLI of the ledger, built on db.Store
+// settings come from the config file and the environment (see the config package)
+//
+//	cashflow [-config app.env] [-o table|json] [-dry-run] [-actor name] <command> [flags] [args]
+//
+//	account create -owner name -currency USD
+//	account get <id>
+//	account list -owner name [-page n] [-page-size n]
+//	account freeze -reason text [-actor name] <id>
+//	transfer -from id -to id -amount n -currency USD [-idempotency-key key]
+//	entries [-limit n] [-after token] <account id>
+//	transfers [-limit n] [-after token] <account id>
+//	balance <account id>
+//	audit [-actor name] [-account id] [-from time] [-to time] [-page n] [-page-size n]
+//	migrate [-target version]
+//
+// -dry-run runs the command inside a transaction that is rolled back, so its effect can be checked first
+// -actor is who the changes are recorded as made by in the audit log, $USER by default
+// exit status: 0 success, 1 the command failed (including a balance that doesn't match its entries), 2 bad usage
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/harshaljanjani/cashflow.net/config"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: cashflow [-config app.env] [-o table|json] [-dry-run] [-actor name] <command> [flags] [args]
+
+commands:
+  account create -owner name -currency USD
+  account get <id>
+  account list -owner name [-page n] [-page-size n]
+  account freeze -reason text [-actor name] <id>
+  transfer -from id -to id -amount n -currency USD [-idempotency-key key]
+  entries [-limit n] [-after token] <account id>
+  transfers [-limit n] [-after token] <account id>
+  balance <account id>
+  audit [-actor name] [-account id] [-from time] [-to time] [-page n] [-page-size n]
+  migrate [-target version]
+
+global flags:
+`
+
+// errUsage makes main exit with status 2 instead of 1
+var errUsage = errors.New("usage")
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("cashflow: ")
+
+	flags := flag.NewFlagSet("cashflow", flag.ContinueOnError)
+	configPath := flags.String("config", "app.env", "config file (KEY=VALUE or YAML), empty to only read the environment")
+	format := flags.String("o", formatTable, "output format: table or json")
+	dryRun := flags.Bool("dry-run", false, "run the command in a transaction that is rolled back")
+	actor := flags.String("actor", os.Getenv("USER"), "who the changes are recorded as made by in the audit log")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+	if flags.NArg() == 0 || (*format != formatTable && *format != formatJSON) {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("cannot load config: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(db.WithActor(context.Background(), *actor), os.Interrupt)
+	defer stop()
+
+	conn, err := cfg.OpenDB()
+	if err != nil {
+		log.Fatal("cannot connect to the db: ", err)
+	}
+	defer conn.Close()
+	store := db.NewStore(conn, db.WithTxOptions(db.TxOptions{Isolation: cfg.DBIsolationLevel, Retry: db.DefaultRetryPolicy}))
+
+	if flags.Arg(0) == "migrate" {
+		if *dryRun {
+			log.Print("migrate has no dry run")
+			os.Exit(2)
+		}
+		err = (&cli{store: store, out: os.Stdout, format: *format}).migrate(ctx, conn, flags.Args()[1:])
+	} else {
+		err = execute(ctx, store, os.Stdout, *format, *dryRun, flags.Args())
+	}
+	if *dryRun {
+		log.Print("dry run, nothing was committed")
+	}
+	if err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		log.Fatal(err)
+	}
+}
+
+// execute runs the command in args against store, inside a rolled back transaction when dryRun is set
+func execute(ctx context.Context, store db.Store, out io.Writer, format string, dryRun bool, args []string) error {
+	if !dryRun {
+		return run(ctx, &cli{store: store, out: out, format: format}, args)
+	}
+	return store.DryRun(ctx, func(dry db.Store) error {
+		return run(ctx, &cli{store: dry, out: out, format: format}, args)
+	})
+}
+
+func run(ctx context.Context, c *cli, args []string) error {
+	command, args := args[0], args[1:]
+	switch command {
+	case "account":
+		if len(args) == 0 {
+			return usageError("account needs a subcommand: create, get, list or freeze")
+		}
+		switch sub, args := args[0], args[1:]; sub {
+		case "create":
+			return c.createAccount(ctx, args)
+		case "get":
+			return c.getAccount(ctx, args)
+		case "list":
+			return c.listAccounts(ctx, args)
+		case "freeze":
+			return c.freezeAccount(ctx, args)
+		default:
+			return usageError("unknown account subcommand %q", sub)
+		}
+	case "transfer":
+		return c.transfer(ctx, args)
+	case "entries":
+		return c.listEntries(ctx, args)
+	case "transfers":
+		return c.listTransfers(ctx, args)
+	case "balance":
+		return c.checkBalance(ctx, args)
+	case "audit":
+		return c.listAuditLog(ctx, args)
+	default:
+		return usageError("unknown command %q", command)
+	}
+}
+
+// usageError prints the message on stderr and makes main exit with status 2
+func usageError(format string, args ...any) error {
+	fmt.Fprintf(os.Stderr, "cashflow: "+format+"\n", args...)
+	return errUsage
+}
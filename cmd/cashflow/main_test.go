@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// runCommand executes args against store and returns the output
+func runCommand(t *testing.T, store db.Store, format string, dryRun bool, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := execute(context.Background(), store, &out, format, dryRun, args)
+	return out.String(), err
+}
+
+func createRandomUser(t *testing.T, store db.Store) db.User {
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func TestAccountCommands(t *testing.T) {
+	store := db.NewMemStore()
+	user := createRandomUser(t, store)
+
+	out, err := runCommand(t, store, formatJSON, false, "account", "create", "-owner", user.Username, "-currency", util.USD)
+	require.NoError(t, err)
+	var account db.Account
+	require.NoError(t, json.Unmarshal([]byte(out), &account))
+	require.Equal(t, user.Username, account.Owner)
+	id := fmt.Sprint(account.ID)
+
+	out, err = runCommand(t, store, formatTable, false, "account", "get", id)
+	require.NoError(t, err)
+	require.Contains(t, out, "OWNER")
+	require.Contains(t, out, user.Username)
+
+	out, err = runCommand(t, store, formatJSON, false, "account", "list", "-owner", user.Username)
+	require.NoError(t, err)
+	var accounts []db.Account
+	require.NoError(t, json.Unmarshal([]byte(out), &accounts))
+	require.Len(t, accounts, 1)
+
+	// flags may follow the argument
+	out, err = runCommand(t, store, formatTable, false, "account", "freeze", id, "-reason", "fraud", "-actor", "ops")
+	require.NoError(t, err)
+	require.Contains(t, out, `active -> frozen by "ops": fraud`)
+
+	_, err = runCommand(t, store, formatTable, false, "account", "get", "999999")
+	require.ErrorIs(t, err, db.ErrAccountNotFound)
+	_, err = runCommand(t, store, formatTable, false, "account", "get")
+	require.ErrorIs(t, err, errUsage)
+	_, err = runCommand(t, store, formatTable, false, "account", "rename", id)
+	require.ErrorIs(t, err, errUsage)
+}
+
+func TestTransferDryRun(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	var accounts [2]db.Account
+	for i := range accounts {
+		var err error
+		accounts[i], err = store.CreateAccount(ctx, db.CreateAccountParams{Owner: createRandomUser(t, store).Username, Balance: 100, Currency: util.USD})
+		require.NoError(t, err)
+	}
+	args := []string{"transfer", "-from", fmt.Sprint(accounts[0].ID), "-to", fmt.Sprint(accounts[1].ID), "-amount", "30", "-currency", util.USD}
+
+	out, err := runCommand(t, store, formatJSON, true, args...)
+	require.NoError(t, err)
+	var result db.TransferTxResult
+	require.NoError(t, json.Unmarshal([]byte(out), &result))
+	require.Equal(t, int64(70), result.FromAccount.Balance)
+
+	// rolled back
+	account, err := store.GetAccount(ctx, accounts[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), account.Balance)
+
+	out, err = runCommand(t, store, formatTable, false, args...)
+	require.NoError(t, err)
+	require.Contains(t, out, fmt.Sprintf("balances: %d = 70, %d = 130", accounts[0].ID, accounts[1].ID))
+
+	args[len(args)-3] = "1000"
+	_, err = runCommand(t, store, formatTable, false, args...)
+	require.ErrorIs(t, err, db.ErrInsufficientFunds)
+}
+
+func TestHistoryCommands(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	var accounts [2]db.Account
+	for i := range accounts {
+		var err error
+		accounts[i], err = store.CreateAccount(ctx, db.CreateAccountParams{Owner: createRandomUser(t, store).Username, Balance: 100, Currency: util.USD})
+		require.NoError(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: accounts[0].ID, ToAccountID: accounts[1].ID, Amount: 1, Currency: util.USD})
+		require.NoError(t, err)
+	}
+	id := fmt.Sprint(accounts[0].ID)
+
+	for _, command := range []string{"entries", "transfers"} {
+		out, err := runCommand(t, store, formatJSON, false, command, "-limit", "2", id)
+		require.NoError(t, err, command)
+		var first page[json.RawMessage]
+		require.NoError(t, json.Unmarshal([]byte(out), &first))
+		require.Len(t, first.Items, 2)
+		require.NotEmpty(t, first.NextPageToken)
+
+		out, err = runCommand(t, store, formatJSON, false, command, "-limit", "2", "-after", first.NextPageToken, id)
+		require.NoError(t, err, command)
+		var last page[json.RawMessage]
+		require.NoError(t, json.Unmarshal([]byte(out), &last))
+		require.Len(t, last.Items, 1)
+		require.Empty(t, last.NextPageToken)
+
+		out, err = runCommand(t, store, formatTable, false, command, "-limit", "2", id)
+		require.NoError(t, err, command)
+		require.Contains(t, out, "next page: -after "+first.NextPageToken)
+	}
+
+	_, err := runCommand(t, store, formatTable, false, "entries", "-after", "garbage", id)
+	require.ErrorIs(t, err, errUsage)
+}
+
+func TestBalanceCommand(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	// created with a balance but no entries: it drifts
+	account, err := store.CreateAccount(ctx, db.CreateAccountParams{Owner: createRandomUser(t, store).Username, Balance: 100, Currency: util.USD})
+	require.NoError(t, err)
+
+	out, err := runCommand(t, store, formatJSON, false, "balance", fmt.Sprint(account.ID))
+	require.ErrorIs(t, err, errBalanceDrift)
+	var check balanceCheck
+	require.NoError(t, json.Unmarshal([]byte(out), &check))
+	require.Equal(t, balanceCheck{AccountID: account.ID, Currency: util.USD, Balance: 100, EntriesTotal: 0, AvailableBalance: 100}, check)
+
+	_, err = store.AdjustBalanceTx(ctx, account.ID)
+	require.NoError(t, err)
+	out, err = runCommand(t, store, formatTable, false, "balance", fmt.Sprint(account.ID))
+	require.NoError(t, err)
+	require.Contains(t, out, "true")
+}
+
+func TestAuditCommand(t *testing.T) {
+	store := db.NewMemStore()
+	user := createRandomUser(t, store)
+
+	// the global -actor ends up in the context
+	var out bytes.Buffer
+	ctx := db.WithActor(context.Background(), "ops")
+	require.NoError(t, execute(ctx, store, &out, formatJSON, false, []string{"account", "create", "-owner", user.Username, "-currency", util.USD}))
+	var account db.Account
+	require.NoError(t, json.Unmarshal(out.Bytes(), &account))
+
+	output, err := runCommand(t, store, formatJSON, false, "audit", "-actor", "ops")
+	require.NoError(t, err)
+	var logs []db.AuditLog
+	require.NoError(t, json.Unmarshal([]byte(output), &logs))
+	require.Len(t, logs, 1)
+	require.Equal(t, db.AuditActionCreate, logs[0].Action)
+	require.Equal(t, []int64{account.ID}, logs[0].AccountIds)
+
+	output, err = runCommand(t, store, formatTable, false, "audit", "-account", fmt.Sprint(account.ID))
+	require.NoError(t, err)
+	require.Contains(t, output, fmt.Sprintf("account %d", account.ID))
+
+	// the user was created without an actor
+	output, err = runCommand(t, store, formatJSON, false, "audit", "-actor", db.SystemActor)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(output), &logs))
+	require.Len(t, logs, 1)
+	require.Equal(t, db.AuditTargetUser, logs[0].TargetType)
+
+	output, err = runCommand(t, store, formatJSON, false, "audit", "-to", "2000-01-01T00:00:00Z")
+	require.NoError(t, err)
+	require.JSONEq(t, "[]", output)
+
+	_, err = runCommand(t, store, formatTable, false, "audit", "-from", "yesterday")
+	require.ErrorIs(t, err, errUsage)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+
+	"github.com/harshaljanjani/cashflow.net/db/migration"
+)
+
+// migrateResult is the output of the migrate command
+type migrateResult struct {
+	From int64 `json:"from"` // version before the run
+	To   int64 `json:"to"`   // version after the run
+}
+
+// migrate works on the database itself rather than on a Store, and commits every step: it has no dry run
+func (c *cli) migrate(ctx context.Context, conn *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	target := flags.Int64("target", migration.Latest, "version to migrate up or down to, -1 for the latest, 0 to roll everything back")
+	if _, err := parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	var result migrateResult
+	var err error
+	if result.From, err = migration.Version(ctx, conn); err != nil {
+		return fmt.Errorf("cannot read schema version: %w", err)
+	}
+	if err := migration.Migrate(ctx, conn, *target); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	if result.To, err = migration.Version(ctx, conn); err != nil {
+		return fmt.Errorf("cannot read schema version: %w", err)
+	}
+	return c.print(result, table{
+		header: []string{"FROM", "TO"},
+		rows:   [][]string{{fmt.Sprint(result.From), fmt.Sprint(result.To)}},
+	})
+}
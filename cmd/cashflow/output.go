@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// values of the -o flag
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// cli runs the commands against store and writes their result to out
+type cli struct {
+	store  db.Store
+	out    io.Writer
+	format string
+}
+
+// table is the tabular form of a result, JSON output uses the result itself
+type table struct {
+	header []string
+	rows   [][]string
+	footer string // printed after the rows, e.g. the token of the next page
+}
+
+func (c *cli) print(v any, t table) error {
+	if c.format == formatJSON {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(t.header, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if t.footer != "" {
+		_, err := fmt.Fprintln(c.out, t.footer)
+		return err
+	}
+	return nil
+}
+
+var accountHeader = []string{"ID", "OWNER", "BALANCE", "CURRENCY", "STATUS", "CREATED AT"}
+
+func accountRow(account db.Account) []string {
+	return []string{
+		fmt.Sprint(account.ID),
+		account.Owner,
+		fmt.Sprint(account.Balance),
+		account.Currency,
+		account.Status,
+		formatTime(account.CreatedAt),
+	}
+}
+
+var entryHeader = []string{"ID", "ACCOUNT", "AMOUNT", "TRANSFER", "CREATED AT"}
+
+func entryRow(entry db.Entry) []string {
+	transfer := "-" // adjustment
+	if entry.TransferID.Valid {
+		transfer = fmt.Sprint(entry.TransferID.Int64)
+	}
+	return []string{
+		fmt.Sprint(entry.ID),
+		fmt.Sprint(entry.AccountID),
+		fmt.Sprint(entry.Amount),
+		transfer,
+		formatTime(entry.CreatedAt),
+	}
+}
+
+var transferHeader = []string{"ID", "FROM", "TO", "AMOUNT", "CURRENCY", "REVERSAL OF", "CREATED AT"}
+
+func transferRow(transfer db.Transfer) []string {
+	reversalOf := "-"
+	if transfer.ReversalOf.Valid {
+		reversalOf = fmt.Sprint(transfer.ReversalOf.Int64)
+	}
+	return []string{
+		fmt.Sprint(transfer.ID),
+		fmt.Sprint(transfer.FromAccountID),
+		fmt.Sprint(transfer.ToAccountID),
+		fmt.Sprint(transfer.Amount),
+		transfer.Currency,
+		reversalOf,
+		formatTime(transfer.CreatedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
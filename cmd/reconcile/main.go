@@ -0,0 +1,60 @@
+// reconcile compares accounts.balance with SUM(entries.amount) for every account and prints a JSON report on stdout
+// exit status: 0 every account is consistent, 1 the run failed, 2 at least one drift was found (even when it was adjusted)
+//
+// the database comes from the config file and the environment (see the config package)
+//
+//	go run ./cmd/reconcile [-config app.env] [-adjust] [-page-size n]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/harshaljanjani/cashflow.net/config"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/reconcile"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	configPath := flag.String("config", "app.env", "config file (KEY=VALUE or YAML), empty to only read the environment")
+	adjust := flag.Bool("adjust", false, "write a correcting adjustment entry for every drift")
+	pageSize := flag.Int("page-size", reconcile.DefaultPageSize, "accounts read per query")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("cannot load config: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	conn, err := cfg.OpenDB()
+	if err != nil {
+		log.Fatal("cannot connect to the db: ", err)
+	}
+	defer conn.Close()
+
+	store := db.NewStore(conn, db.WithTxOptions(db.TxOptions{Isolation: cfg.DBIsolationLevel, Retry: db.DefaultRetryPolicy}))
+	report, err := reconcile.Run(ctx, store, reconcile.Options{
+		Adjust:   *adjust,
+		PageSize: int32(*pageSize),
+	})
+	if err != nil {
+		log.Fatal("reconciliation failed: ", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal("cannot write the report: ", err)
+	}
+	if !report.OK() {
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,147 @@
+// server exposes the accounts and transfers of the ledger over HTTP and gRPC
+// (plus its JSON gateway, see gapi)
+// it stops accepting connections on SIGINT/SIGTERM and waits for in-flight requests before exiting
+//
+// settings come from the config file and the environment (see the config package), tokens are signed with
+// the first of TOKEN_KEYS, the other keys are only accepted (key rotation); there is no default key,
+// so the server doesn't start without TOKEN_KEYS
+// the gRPC server and its gateway only run when GRPC_SERVER_ADDRESS or GATEWAY_SERVER_ADDRESS is set
+// an outbox relay turns the ledger events into webhook deliveries (and appends them to OUTBOX_FILE when set),
+// a webhook dispatcher sends the deliveries (see the outbox and webhook packages), and a maintenance worker expires
+// the holds and idempotency keys every MAINTENANCE_INTERVAL (see the maintenance package)
+//
+// -migrate applies the pending migrations before serving (see db/migration)
+//
+//	go run ./cmd/server [-config app.env] [-migrate]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/harshaljanjani/cashflow.net/api"
+	"github.com/harshaljanjani/cashflow.net/config"
+	"github.com/harshaljanjani/cashflow.net/db/migration"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/gapi"
+	"github.com/harshaljanjani/cashflow.net/maintenance"
+	"github.com/harshaljanjani/cashflow.net/outbox"
+	"github.com/harshaljanjani/cashflow.net/webhook"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	configPath := flag.String("config", "app.env", "config file (KEY=VALUE or YAML), empty to only read the environment")
+	migrate := flag.Bool("migrate", false, "apply the pending migrations before serving")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatal("cannot load config: ", err)
+	}
+	log.Printf("config: %v", cfg)
+
+	tokenMaker, err := cfg.NewTokenMaker()
+	if err != nil {
+		log.Fatal("cannot create token maker: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	conn, err := cfg.OpenDB()
+	if err != nil {
+		log.Fatal("cannot connect to the db: ", err)
+	}
+	defer conn.Close()
+
+	if *migrate {
+		if err := migration.Migrate(ctx, conn, migration.Latest); err != nil {
+			log.Fatal("cannot migrate the db: ", err)
+		}
+	}
+
+	store := db.NewStore(conn, db.WithTxOptions(db.TxOptions{Isolation: cfg.DBIsolationLevel, Retry: db.DefaultRetryPolicy}))
+	server := api.NewServer(store, tokenMaker, api.WithTokenDurations(cfg.AccessTokenDuration, cfg.RefreshTokenDuration))
+	grpcServer := gapi.NewServer(store, tokenMaker)
+
+	// the first server to fail stops the others
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 6)
+	servers := 0
+	serve := func(name, address string, serve func(context.Context, net.Listener) error) {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			log.Fatalf("cannot start %s server: %v", name, err)
+		}
+		log.Printf("%s server listening on %s", name, address)
+		servers++
+		go func() {
+			if err := serve(ctx, listener); err != nil {
+				err = fmt.Errorf("%s server: %w", name, err)
+			}
+			errs <- err
+		}()
+	}
+	serve("HTTP", cfg.HTTPServerAddress, server.Serve)
+	if cfg.GRPCServerAddress != "" {
+		serve("gRPC", cfg.GRPCServerAddress, grpcServer.Serve)
+	}
+	if cfg.GatewayServerAddress != "" {
+		serve("gateway", cfg.GatewayServerAddress, grpcServer.ServeGateway)
+	}
+
+	// background workers, they only stop with ctx
+	work := func(run func(context.Context) error) {
+		servers++
+		go func() {
+			errs <- run(ctx)
+		}()
+	}
+	publishers := []outbox.Publisher{webhook.NewPublisher(store)}
+	if cfg.OutboxFile != "" {
+		publisher, err := outbox.NewFilePublisher(cfg.OutboxFile)
+		if err != nil {
+			log.Fatal("cannot open the outbox file: ", err)
+		}
+		defer publisher.Close()
+		publishers = append(publishers, publisher)
+		log.Printf("outbox events appended to %s", cfg.OutboxFile)
+	}
+	work(outbox.NewRelay(store, outbox.MultiPublisher(publishers...), outbox.Options{
+		PollInterval: cfg.OutboxPollInterval,
+		OnError:      func(err error) { log.Print("outbox relay: ", err) },
+	}).Run)
+	work(webhook.NewDispatcher(store, webhook.Options{
+		Schedule: webhook.Schedule{
+			MaxAttempts: int32(cfg.WebhookMaxAttempts),
+			BaseDelay:   webhook.DefaultSchedule.BaseDelay,
+			MaxDelay:    webhook.DefaultSchedule.MaxDelay,
+		},
+		Timeout: cfg.WebhookTimeout,
+		OnError: func(err error) { log.Print("webhook dispatcher: ", err) },
+	}).Run)
+	work(maintenance.NewWorker(store, maintenance.Options{
+		Interval: cfg.MaintenanceInterval,
+		OnError:  func(err error) { log.Print("maintenance: ", err) },
+	}).Run)
+
+	var failed error
+	for ; servers > 0; servers-- {
+		if err := <-errs; err != nil && failed == nil {
+			failed = err
+			cancel()
+		}
+	}
+	if failed != nil {
+		log.Fatal(failed)
+	}
+	log.Print("server stopped")
+}
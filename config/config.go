@@ -0,0 +1,241 @@
+// Package config loads the settings shared by every binary and test harness
+//
+// settings come from, in order of precedence:
+//  1. environment variables (DB_SOURCE, TOKEN_KEYS, ...)
+//  2. the config file, either KEY=VALUE lines (app.env) or YAML with the same keys in lower case (db_source: ...)
+//  3. the defaults of Default
+//
+// Load validates the result, so a binary with a bad setting fails at startup instead of on its first request
+package config
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/harshaljanjani/cashflow.net/token"
+)
+
+// TokenKey is a token signing key, see token.Key
+type TokenKey struct {
+	ID     string
+	Secret Secret
+}
+
+// Config holds every setting, the tag of each field is the name of its environment variable
+type Config struct {
+	DBDriver          string             `env:"DB_DRIVER"`
+	DBSource          Secret             `env:"DB_SOURCE"`            // connection string, it holds the db password
+	DBMaxOpenConns    int                `env:"DB_MAX_OPEN_CONNS"`    // 0 means unlimited
+	DBMaxIdleConns    int                `env:"DB_MAX_IDLE_CONNS"`    // must not exceed DBMaxOpenConns
+	DBConnMaxLifetime time.Duration      `env:"DB_CONN_MAX_LIFETIME"` // 0 means connections are reused forever
+	DBIsolationLevel  sql.IsolationLevel `env:"DB_ISOLATION_LEVEL"`   // of the canned transactions: default, read-committed, repeatable-read or serializable
+
+	HTTPServerAddress    string `env:"HTTP_SERVER_ADDRESS"`
+	GRPCServerAddress    string `env:"GRPC_SERVER_ADDRESS"`    // empty disables the gRPC server
+	GatewayServerAddress string `env:"GATEWAY_SERVER_ADDRESS"` // empty disables the JSON gateway
+
+	// "id:secret,id:secret", the first key signs new tokens, the others are only accepted (key rotation)
+	TokenKeys            []TokenKey    `env:"TOKEN_KEYS"`
+	AccessTokenDuration  time.Duration `env:"ACCESS_TOKEN_DURATION"`
+	RefreshTokenDuration time.Duration `env:"REFRESH_TOKEN_DURATION"`
+
+	OutboxFile         string        `env:"OUTBOX_FILE"`          // JSON lines file the outbox events are also published to, empty disables it
+	OutboxPollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL"` // wait of the relay when the outbox is empty
+
+	WebhookTimeout     time.Duration `env:"WEBHOOK_TIMEOUT"`      // of a single delivery request
+	WebhookMaxAttempts int           `env:"WEBHOOK_MAX_ATTEMPTS"` // a delivery is dead after this many failed attempts
+
+	MaintenanceInterval time.Duration `env:"MAINTENANCE_INTERVAL"` // between two expirations of the holds and idempotency keys
+}
+
+// Default returns the settings used for anything the file and the environment leave out
+// there is no default connection string or token key: those are secrets
+// the gRPC server and its gateway are off unless an address is set
+func Default() Config {
+	return Config{
+		DBDriver:             "postgres",
+		DBMaxOpenConns:       25,
+		DBMaxIdleConns:       25,
+		DBConnMaxLifetime:    5 * time.Minute,
+		DBIsolationLevel:     sql.LevelDefault,
+		HTTPServerAddress:    "0.0.0.0:8080",
+		AccessTokenDuration:  15 * time.Minute,
+		RefreshTokenDuration: 24 * time.Hour,
+		OutboxPollInterval:   time.Second,
+		WebhookTimeout:       10 * time.Second,
+		WebhookMaxAttempts:   12,
+		MaintenanceInterval:  time.Minute,
+	}
+}
+
+// Load reads the config file at path (skipped when path is empty), applies the environment variables
+// on top of it and validates the result
+func Load(path string) (Config, error) {
+	config := Default()
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := config.apply(values); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := config.apply(environ()); err != nil {
+		return Config{}, fmt.Errorf("environment: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// Validate reports every invalid setting at once
+func (config Config) Validate() error {
+	var errs []error
+	invalid := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("invalid %s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if config.DBDriver == "" {
+		invalid("DB_DRIVER", "required")
+	}
+	if config.DBSource == "" {
+		invalid("DB_SOURCE", "required")
+	}
+	if config.DBMaxOpenConns < 0 {
+		invalid("DB_MAX_OPEN_CONNS", "must not be negative")
+	}
+	if config.DBMaxIdleConns < 0 {
+		invalid("DB_MAX_IDLE_CONNS", "must not be negative")
+	}
+	if config.DBMaxOpenConns > 0 && config.DBMaxIdleConns > config.DBMaxOpenConns {
+		invalid("DB_MAX_IDLE_CONNS", "%d exceeds DB_MAX_OPEN_CONNS %d", config.DBMaxIdleConns, config.DBMaxOpenConns)
+	}
+	if config.DBConnMaxLifetime < 0 {
+		invalid("DB_CONN_MAX_LIFETIME", "must not be negative")
+	}
+	switch config.DBIsolationLevel {
+	case sql.LevelDefault, sql.LevelReadCommitted, sql.LevelRepeatableRead, sql.LevelSerializable:
+	default:
+		invalid("DB_ISOLATION_LEVEL", "%v is not supported by postgres", config.DBIsolationLevel)
+	}
+
+	if _, _, err := net.SplitHostPort(config.HTTPServerAddress); err != nil {
+		invalid("HTTP_SERVER_ADDRESS", "%v", err)
+	}
+	if config.GRPCServerAddress != "" {
+		if _, _, err := net.SplitHostPort(config.GRPCServerAddress); err != nil {
+			invalid("GRPC_SERVER_ADDRESS", "%v", err)
+		}
+	}
+	if config.GatewayServerAddress != "" {
+		if _, _, err := net.SplitHostPort(config.GatewayServerAddress); err != nil {
+			invalid("GATEWAY_SERVER_ADDRESS", "%v", err)
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, key := range config.TokenKeys {
+		switch {
+		case key.ID == "":
+			invalid("TOKEN_KEYS", "key without an id")
+		case ids[key.ID]:
+			invalid("TOKEN_KEYS", "duplicate key id %q", key.ID)
+		case len(key.Secret) < token.MinSecretKeySize:
+			// the secret itself must not end up in the error
+			invalid("TOKEN_KEYS", "secret of key %q must be at least %d characters", key.ID, token.MinSecretKeySize)
+		}
+		ids[key.ID] = true
+	}
+	if config.AccessTokenDuration <= 0 {
+		invalid("ACCESS_TOKEN_DURATION", "must be positive")
+	}
+	if config.RefreshTokenDuration <= 0 {
+		invalid("REFRESH_TOKEN_DURATION", "must be positive")
+	}
+	if config.OutboxPollInterval <= 0 {
+		invalid("OUTBOX_POLL_INTERVAL", "must be positive")
+	}
+	if config.WebhookTimeout <= 0 {
+		invalid("WEBHOOK_TIMEOUT", "must be positive")
+	}
+	if config.WebhookMaxAttempts <= 0 {
+		invalid("WEBHOOK_MAX_ATTEMPTS", "must be positive")
+	}
+	if config.MaintenanceInterval <= 0 {
+		invalid("MAINTENANCE_INTERVAL", "must be positive")
+	}
+	return errors.Join(errs...)
+}
+
+// OpenDB opens the database with the pool settings of the config
+func (config Config) OpenDB() (*sql.DB, error) {
+	conn, err := sql.Open(config.DBDriver, config.DBSource.Value())
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(config.DBMaxOpenConns)
+	conn.SetMaxIdleConns(config.DBMaxIdleConns)
+	conn.SetConnMaxLifetime(config.DBConnMaxLifetime)
+	return conn, nil
+}
+
+// NewTokenMaker returns a token maker signing with the first of TokenKeys
+// only the binaries that issue or check tokens need keys, so their absence is reported here rather than by Validate
+func (config Config) NewTokenMaker() (token.Maker, error) {
+	if len(config.TokenKeys) == 0 {
+		return nil, errors.New("no token key, set TOKEN_KEYS")
+	}
+	keys := make([]token.Key, len(config.TokenKeys))
+	for i, key := range config.TokenKeys {
+		keys[i] = token.Key{ID: key.ID, Secret: key.Secret.Value()}
+	}
+	return token.NewJWTMaker(keys[0], keys[1:]...)
+}
+
+// String lists the settings with the secrets redacted, it is safe to log
+func (config Config) String() string {
+	keyIDs := make([]string, len(config.TokenKeys))
+	for i, key := range config.TokenKeys {
+		keyIDs[i] = key.ID + ":" + key.Secret.String()
+	}
+	var b strings.Builder
+	for _, setting := range []struct {
+		key   string
+		value any
+	}{
+		{"DB_DRIVER", config.DBDriver},
+		{"DB_SOURCE", redactDSN(config.DBSource.Value())},
+		{"DB_MAX_OPEN_CONNS", config.DBMaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", config.DBMaxIdleConns},
+		{"DB_CONN_MAX_LIFETIME", config.DBConnMaxLifetime},
+		{"DB_ISOLATION_LEVEL", formatIsolationLevel(config.DBIsolationLevel)},
+		{"HTTP_SERVER_ADDRESS", config.HTTPServerAddress},
+		{"GRPC_SERVER_ADDRESS", config.GRPCServerAddress},
+		{"GATEWAY_SERVER_ADDRESS", config.GatewayServerAddress},
+		{"TOKEN_KEYS", strings.Join(keyIDs, ",")},
+		{"ACCESS_TOKEN_DURATION", config.AccessTokenDuration},
+		{"REFRESH_TOKEN_DURATION", config.RefreshTokenDuration},
+		{"OUTBOX_FILE", config.OutboxFile},
+		{"OUTBOX_POLL_INTERVAL", config.OutboxPollInterval},
+		{"WEBHOOK_TIMEOUT", config.WebhookTimeout},
+		{"WEBHOOK_MAX_ATTEMPTS", config.WebhookMaxAttempts},
+		{"MAINTENANCE_INTERVAL", config.MaintenanceInterval},
+	} {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%v", setting.key, setting.value)
+	}
+	return b.String()
+}
+
+// GoString keeps %#v from printing the secrets
+func (config Config) GoString() string {
+	return "config.Config{" + config.String() + "}"
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keys returns the environment variable of every setting, in field order
+func keys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, t.NumField())
+	for i := range keys {
+		keys[i] = t.Field(i).Tag.Get("env")
+	}
+	return keys
+}
+
+// environ returns the settings found in the environment
+func environ() map[string]string {
+	values := make(map[string]string)
+	for _, key := range keys() {
+		if value, ok := os.LookupEnv(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// readFile returns the settings of a .yaml/.yml file or of a KEY=VALUE file (anything else)
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+	var values map[string]string
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		values, err = parseYAML(data)
+	default:
+		values, err = parseEnv(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// parseEnv reads KEY=VALUE lines, blank lines and lines starting with # are skipped
+// and values may be wrapped in single or double quotes
+func parseEnv(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
+
+// parseYAML reads a flat mapping whose keys are the environment variables in lower case,
+// token_keys may also be a list of "id:secret"
+func parseYAML(data []byte) (map[string]string, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(doc))
+	for key, value := range doc {
+		switch v := value.(type) {
+		case nil:
+			values[strings.ToUpper(key)] = ""
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[strings.ToUpper(key)] = strings.Join(items, ",")
+		case map[string]any:
+			return nil, fmt.Errorf("%s: nested settings are not supported", key)
+		default:
+			values[strings.ToUpper(key)] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// apply sets the fields named by values, unknown keys are rejected so that typos don't go unnoticed
+func (config *Config) apply(values map[string]string) error {
+	fields := make(map[string]reflect.Value)
+	v := reflect.ValueOf(config).Elem()
+	for i, key := range keys() {
+		fields[key] = v.Field(i)
+	}
+
+	names := make([]string, 0, len(values))
+	for key := range values {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+		if err := setField(field, values[key]); err != nil {
+			// values may be secrets, only the key is reported
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Addr().Interface().(type) {
+	case *string:
+		field.SetString(value)
+	case *Secret:
+		field.SetString(value)
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		field.SetInt(int64(n))
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", value)
+		}
+		field.SetInt(int64(d))
+	case *sql.IsolationLevel:
+		level, err := parseIsolationLevel(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(level))
+	case *[]TokenKey:
+		keys, err := parseTokenKeys(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(keys))
+	default:
+		panic(fmt.Sprintf("config: unsupported setting type %s", field.Type()))
+	}
+	return nil
+}
+
+var isolationLevels = map[string]sql.IsolationLevel{
+	"default":         sql.LevelDefault,
+	"read-committed":  sql.LevelReadCommitted,
+	"repeatable-read": sql.LevelRepeatableRead,
+	"serializable":    sql.LevelSerializable,
+}
+
+// parseIsolationLevel accepts "read-committed", "read committed", "READ_COMMITTED", ...
+func parseIsolationLevel(value string) (sql.IsolationLevel, error) {
+	name := strings.NewReplacer(" ", "-", "_", "-").Replace(strings.ToLower(strings.TrimSpace(value)))
+	if name == "" {
+		return sql.LevelDefault, nil
+	}
+	level, ok := isolationLevels[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown isolation level %q, expected default, read-committed, repeatable-read or serializable", value)
+	}
+	return level, nil
+}
+
+func formatIsolationLevel(level sql.IsolationLevel) string {
+	for name, l := range isolationLevels {
+		if l == level {
+			return name
+		}
+	}
+	return level.String()
+}
+
+// parseTokenKeys parses "id:secret,id:secret"
+func parseTokenKeys(value string) ([]TokenKey, error) {
+	var keys []TokenKey
+	for i, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(field, ":")
+		if !ok {
+			return nil, fmt.Errorf("key %d: expected id:secret", i+1)
+		}
+		keys = append(keys, TokenKey{ID: strings.TrimSpace(id), Secret: Secret(secret)})
+	}
+	return keys, nil
+}
@@ -0,0 +1,8 @@
+/* currency of the transferred amount, both accounts of a transfer must hold it */
+ALTER TABLE "transfers" ADD COLUMN "currency" varchar;
+
+UPDATE "transfers" SET "currency" = "accounts"."currency"
+FROM "accounts"
+WHERE "accounts"."id" = "transfers"."from_account_id";
+
+ALTER TABLE "transfers" ALTER COLUMN "currency" SET NOT NULL;
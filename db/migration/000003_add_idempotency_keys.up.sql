@@ -0,0 +1,10 @@
+/* one row per idempotency key sent with TransferTx, response holds the original TransferTxResult */
+CREATE TABLE "idempotency_keys" (
+  "key" varchar PRIMARY KEY,
+  "request_hash" varchar NOT NULL,
+  "response" jsonb NOT NULL DEFAULT '{}',
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "expires_at" timestamptz NOT NULL
+);
+
+CREATE INDEX ON "idempotency_keys" ("expires_at");
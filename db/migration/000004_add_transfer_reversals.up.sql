@@ -0,0 +1,8 @@
+/* a reversal (refund) is a transfer in the opposite direction that points at the transfer it reverses */
+ALTER TABLE "transfers" ADD COLUMN "reversal_of" bigint;
+
+ALTER TABLE "transfers" ADD FOREIGN KEY ("reversal_of") REFERENCES "transfers" ("id");
+
+CREATE INDEX ON "transfers" ("reversal_of");
+
+COMMENT ON COLUMN transfers.reversal_of is 'Transfer reversed by this one, NULL for regular transfers';
@@ -0,0 +1,25 @@
+/* authorization holds: funds reserved on an account until they are captured (turned into a transfer), voided or expire */
+CREATE TABLE "holds" (
+  "id" bigserial PRIMARY KEY,
+  "account_id" bigint NOT NULL,
+  "amount" bigint NOT NULL, /*Must be positive*/
+  "currency" varchar NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'active' CHECK ("status" IN ('active', 'captured', 'voided', 'expired')),
+  "captured_amount" bigint NOT NULL DEFAULT 0,
+  "transfer_id" bigint,
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "updated_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "holds" ("account_id", "status");
+
+CREATE INDEX ON "holds" ("expires_at") WHERE "status" = 'active';
+
+ALTER TABLE "holds" ADD FOREIGN KEY ("account_id") REFERENCES "accounts" ("id");
+
+ALTER TABLE "holds" ADD FOREIGN KEY ("transfer_id") REFERENCES "transfers" ("id");
+
+COMMENT ON COLUMN holds.amount is 'Must be positive';
+
+COMMENT ON COLUMN holds.transfer_id is 'Transfer created by the capture';
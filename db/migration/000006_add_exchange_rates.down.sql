@@ -0,0 +1,7 @@
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "exchange_rate";
+
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "converted_currency";
+
+ALTER TABLE "transfers" DROP COLUMN IF EXISTS "converted_amount";
+
+DROP TABLE IF EXISTS exchange_rates;
@@ -0,0 +1,24 @@
+/* rate to convert an amount of base_currency into quote_currency, effective from effective_at until the next rate of the pair */
+CREATE TABLE "exchange_rates" (
+  "id" bigserial PRIMARY KEY,
+  "base_currency" varchar NOT NULL,
+  "quote_currency" varchar NOT NULL,
+  "rate" numeric(20,10) NOT NULL CHECK ("rate" > 0),
+  "effective_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE UNIQUE INDEX ON "exchange_rates" ("base_currency", "quote_currency", "effective_at");
+
+COMMENT ON COLUMN exchange_rates.rate is 'Units of quote_currency per unit of base_currency';
+
+/* cross-currency transfers: amount/currency is what left the source account, converted_amount/converted_currency what reached the destination */
+ALTER TABLE "transfers" ADD COLUMN "converted_amount" bigint;
+
+ALTER TABLE "transfers" ADD COLUMN "converted_currency" varchar;
+
+ALTER TABLE "transfers" ADD COLUMN "exchange_rate" numeric(20,10);
+
+COMMENT ON COLUMN transfers.converted_amount is 'Amount credited to the destination, NULL for same-currency transfers';
+
+COMMENT ON COLUMN transfers.exchange_rate is 'Rate applied to amount, NULL for same-currency transfers';
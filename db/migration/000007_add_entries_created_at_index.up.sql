@@ -0,0 +1,2 @@
+/* point-in-time balances only sum the entries of an account made after the requested instant */
+CREATE INDEX "entries_account_id_created_at_idx" ON "entries" ("account_id", "created_at");
@@ -0,0 +1,23 @@
+/* the transfer an entry was posted for, NULL for entries that aren't part of a transfer (e.g. reconciliation adjustments) */
+ALTER TABLE "entries" ADD COLUMN "transfer_id" bigint;
+
+ALTER TABLE "entries" ADD FOREIGN KEY ("transfer_id") REFERENCES "transfers" ("id");
+
+CREATE INDEX ON "entries" ("transfer_id");
+
+COMMENT ON COLUMN entries.transfer_id is 'Transfer this entry belongs to, NULL for adjustments';
+
+/* best effort backfill: the entries of a transfer were written in the same transaction, so they share its created_at
+   entries matching more than one transfer are left NULL */
+WITH "matches" AS (
+  SELECT "entries"."id" AS "entry_id", MIN("transfers"."id") AS "transfer_id", COUNT(*) AS "candidates"
+  FROM "entries"
+  JOIN "transfers" ON "transfers"."created_at" = "entries"."created_at" AND (
+    ("entries"."account_id" = "transfers"."from_account_id" AND "entries"."amount" = -"transfers"."amount") OR
+    ("entries"."account_id" = "transfers"."to_account_id" AND "entries"."amount" = COALESCE("transfers"."converted_amount", "transfers"."amount"))
+  )
+  GROUP BY "entries"."id"
+)
+UPDATE "entries" SET "transfer_id" = "matches"."transfer_id"
+FROM "matches"
+WHERE "entries"."id" = "matches"."entry_id" AND "matches"."candidates" = 1;
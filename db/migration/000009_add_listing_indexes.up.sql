@@ -0,0 +1,4 @@
+/* ListEntries and ListTransfers page through rows in (created_at, id) order */
+CREATE INDEX "entries_created_at_id_idx" ON "entries" ("created_at", "id");
+
+CREATE INDEX "transfers_created_at_id_idx" ON "transfers" ("created_at", "id");
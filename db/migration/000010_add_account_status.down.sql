@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS account_status_changes;
+
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "status_changed_at";
+
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "status_reason";
+
+ALTER TABLE "accounts" DROP COLUMN IF EXISTS "status";
@@ -0,0 +1,27 @@
+/* account lifecycle: active -> frozen/dormant -> closed, accounts are never deleted once they have history */
+ALTER TABLE "accounts" ADD COLUMN "status" varchar NOT NULL DEFAULT 'active' CHECK ("status" IN ('active', 'frozen', 'dormant', 'closed'));
+
+ALTER TABLE "accounts" ADD COLUMN "status_reason" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "accounts" ADD COLUMN "status_changed_at" timestamptz NOT NULL DEFAULT (now());
+
+UPDATE "accounts" SET "status_changed_at" = "created_at";
+
+COMMENT ON COLUMN accounts.status_reason is 'Reason given for the last status change';
+
+/* audit trail of every status transition */
+CREATE TABLE "account_status_changes" (
+  "id" bigserial PRIMARY KEY,
+  "account_id" bigint NOT NULL,
+  "from_status" varchar NOT NULL,
+  "to_status" varchar NOT NULL,
+  "reason" varchar NOT NULL,
+  "actor" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "account_status_changes" ("account_id");
+
+ALTER TABLE "account_status_changes" ADD FOREIGN KEY ("account_id") REFERENCES "accounts" ("id");
+
+COMMENT ON COLUMN account_status_changes.actor is 'Who requested the change';
@@ -0,0 +1,20 @@
+/* customer identities, accounts.owner is the username of a user */
+CREATE TABLE "users" (
+  "username" varchar PRIMARY KEY,
+  "hashed_password" varchar NOT NULL,
+  "full_name" varchar NOT NULL,
+  "email" varchar UNIQUE NOT NULL,
+  "password_changed_at" timestamptz NOT NULL DEFAULT '0001-01-01 00:00:00Z',
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN users.hashed_password is 'bcrypt hash, never the password itself';
+
+/* existing owners become users that can't log in (an empty hash never matches) until a password is set */
+INSERT INTO "users" ("username", "hashed_password", "full_name", "email")
+SELECT DISTINCT "owner", '', "owner", "owner" || '@users.invalid' FROM "accounts";
+
+ALTER TABLE "accounts" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+/* one account per currency and owner */
+ALTER TABLE "accounts" ADD CONSTRAINT "owner_currency_key" UNIQUE ("owner", "currency");
@@ -0,0 +1,26 @@
+/* transactional outbox: events are written in the same transaction as the ledger changes they describe,
+   a relay publishes them afterwards (at-least-once) and marks them sent */
+CREATE TABLE "outbox_events" (
+  "id" bigserial PRIMARY KEY,
+  "event_type" varchar NOT NULL,
+  "aggregate_type" varchar NOT NULL,
+  "aggregate_id" bigint NOT NULL,
+  "payload" jsonb NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  "sent_at" timestamptz,
+  "attempts" int NOT NULL DEFAULT 0,
+  "last_error" varchar NOT NULL DEFAULT ''
+);
+
+/* the relay only ever scans unsent events */
+CREATE INDEX ON "outbox_events" ("id") WHERE "sent_at" IS NULL;
+
+CREATE INDEX ON "outbox_events" ("aggregate_type", "aggregate_id");
+
+COMMENT ON COLUMN outbox_events.event_type is 'transfer.created, transfer.reversed, account.frozen, ...';
+
+COMMENT ON COLUMN outbox_events.aggregate_id is 'Id of the transfer or account the event is about';
+
+COMMENT ON COLUMN outbox_events.sent_at is 'NULL until a publisher accepted the event';
+
+COMMENT ON COLUMN outbox_events.last_error is 'Error of the last failed publish attempt';
@@ -0,0 +1,71 @@
+/* outbound webhooks: owners register endpoints, the outbox events they subscribed to become deliveries,
+   every delivery attempt is logged */
+CREATE TABLE "webhook_endpoints" (
+  "id" bigserial PRIMARY KEY,
+  "owner" varchar NOT NULL,
+  "url" varchar NOT NULL,
+  "secret" varchar NOT NULL,
+  "event_types" varchar[] NOT NULL,
+  "low_balance_threshold" bigint NOT NULL DEFAULT 0,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webhook_deliveries" (
+  "id" bigserial PRIMARY KEY,
+  "endpoint_id" bigint NOT NULL,
+  "event_id" bigint NOT NULL,
+  "event_type" varchar NOT NULL,
+  "payload" jsonb NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'pending' CHECK ("status" IN ('pending', 'delivered', 'dead')),
+  "attempts" int NOT NULL DEFAULT 0,
+  "next_attempt_at" timestamptz NOT NULL,
+  "last_error" varchar NOT NULL DEFAULT '',
+  "delivered_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webhook_attempts" (
+  "id" bigserial PRIMARY KEY,
+  "delivery_id" bigint NOT NULL,
+  "attempt" int NOT NULL,
+  "status_code" int NOT NULL,
+  "error" varchar NOT NULL,
+  "duration_ms" bigint NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "webhook_endpoints" ("owner");
+
+/* an outbox event redelivered by the relay doesn't enqueue the same webhook twice */
+ALTER TABLE "webhook_deliveries" ADD CONSTRAINT "endpoint_event_key" UNIQUE ("endpoint_id", "event_id", "event_type");
+
+/* the dispatcher only ever scans pending deliveries */
+CREATE INDEX ON "webhook_deliveries" ("next_attempt_at") WHERE "status" = 'pending';
+
+CREATE INDEX ON "webhook_attempts" ("delivery_id");
+
+ALTER TABLE "webhook_endpoints" ADD FOREIGN KEY ("owner") REFERENCES "users" ("username");
+
+ALTER TABLE "webhook_deliveries" ADD FOREIGN KEY ("endpoint_id") REFERENCES "webhook_endpoints" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "webhook_deliveries" ADD FOREIGN KEY ("event_id") REFERENCES "outbox_events" ("id");
+
+ALTER TABLE "webhook_attempts" ADD FOREIGN KEY ("delivery_id") REFERENCES "webhook_deliveries" ("id") ON DELETE CASCADE;
+
+COMMENT ON COLUMN webhook_endpoints.secret is 'HMAC-SHA256 key of the signature header';
+
+COMMENT ON COLUMN webhook_endpoints.event_types is 'Subscribed event types: transfer.created, account.frozen, balance.low, ...';
+
+COMMENT ON COLUMN webhook_endpoints.low_balance_threshold is 'balance.low fires when a debit takes an account below this balance';
+
+COMMENT ON COLUMN webhook_deliveries.event_type is 'Differs from the outbox event type for derived events (balance.low)';
+
+COMMENT ON COLUMN webhook_deliveries.payload is 'Request body, signed as is';
+
+COMMENT ON COLUMN webhook_deliveries.status is 'pending, delivered or dead (retries exhausted)';
+
+COMMENT ON COLUMN webhook_deliveries.next_attempt_at is 'Pending deliveries are sent once due, claiming one pushes it back by a lease';
+
+COMMENT ON COLUMN webhook_attempts.attempt is 'Position in the retry schedule, starts over at 1 when a dead delivery is requeued';
+
+COMMENT ON COLUMN webhook_attempts.status_code is 'HTTP status of the response, 0 when none was received';
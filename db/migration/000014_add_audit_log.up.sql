@@ -0,0 +1,42 @@
+/* audit trail of the ledger: every write made through the Store records who changed which row, with the row before and after
+   the trail is append-only, rows can't be updated nor deleted */
+CREATE TABLE "audit_log" (
+  "id" bigserial PRIMARY KEY,
+  "actor" varchar NOT NULL,
+  "action" varchar NOT NULL,
+  "target_type" varchar NOT NULL,
+  "target_id" varchar NOT NULL,
+  "account_ids" bigint[] NOT NULL DEFAULT '{}',
+  "before" jsonb NOT NULL,
+  "after" jsonb NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "audit_log" ("created_at");
+
+CREATE INDEX ON "audit_log" ("actor", "created_at");
+
+CREATE INDEX ON "audit_log" USING GIN ("account_ids");
+
+CREATE FUNCTION audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_immutable BEFORE UPDATE OR DELETE OR TRUNCATE ON "audit_log"
+FOR EACH STATEMENT EXECUTE FUNCTION audit_log_immutable();
+
+COMMENT ON COLUMN audit_log.actor is 'Who made the change: a username, an operator, or system for background jobs';
+
+COMMENT ON COLUMN audit_log.action is 'create, update, delete, add_balance, set_status, capture, expire';
+
+COMMENT ON COLUMN audit_log.target_type is 'Table of the changed row: account, transfer, entry, hold, user, exchange_rate';
+
+COMMENT ON COLUMN audit_log.target_id is 'Primary key of the changed row as text (usernames aren''t numbers), * for bulk changes';
+
+COMMENT ON COLUMN audit_log.account_ids is 'Accounts the change is about, for filtering';
+
+COMMENT ON COLUMN audit_log.before is 'Row before the change, null for creations';
+
+COMMENT ON COLUMN audit_log.after is 'Row after the change, null for deletions';
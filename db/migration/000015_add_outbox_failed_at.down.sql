@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "outbox_events_id_idx";
+
+ALTER TABLE "outbox_events" DROP COLUMN IF EXISTS "failed_at";
+
+CREATE INDEX ON "outbox_events" ("id") WHERE "sent_at" IS NULL;
@@ -0,0 +1,9 @@
+/* an event the publisher keeps rejecting is given up after a number of attempts, so it can't hold back the events after it */
+ALTER TABLE "outbox_events" ADD COLUMN "failed_at" timestamptz;
+
+DROP INDEX IF EXISTS "outbox_events_id_idx";
+
+/* the relay only ever scans the events that are neither sent nor failed */
+CREATE INDEX ON "outbox_events" ("id") WHERE "sent_at" IS NULL AND "failed_at" IS NULL;
+
+COMMENT ON COLUMN outbox_events.failed_at is 'Set when the relay gave up on the event, it is not published anymore';
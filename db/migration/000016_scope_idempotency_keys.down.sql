@@ -0,0 +1,9 @@
+ALTER TABLE "idempotency_keys" DROP CONSTRAINT IF EXISTS "idempotency_keys_pkey";
+
+/* keys shared by several accounts can't all stay, the oldest one wins */
+DELETE FROM "idempotency_keys" a USING "idempotency_keys" b
+WHERE a."key" = b."key" AND (a."created_at", a."account_id") > (b."created_at", b."account_id");
+
+ALTER TABLE "idempotency_keys" ADD PRIMARY KEY ("key");
+
+ALTER TABLE "idempotency_keys" DROP COLUMN IF EXISTS "account_id";
@@ -0,0 +1,16 @@
+/* idempotency keys are chosen by the clients, two of them picking the same key must not see each other's transfers:
+   a key is only unique for the source account of the transfer */
+ALTER TABLE "idempotency_keys" ADD COLUMN "account_id" bigint;
+
+/* the stored response is the result of the transfer, it knows its source account */
+UPDATE "idempotency_keys" SET "account_id" = ("response"->'transfer'->>'from_account_id')::bigint;
+
+DELETE FROM "idempotency_keys" WHERE "account_id" IS NULL;
+
+ALTER TABLE "idempotency_keys" ALTER COLUMN "account_id" SET NOT NULL;
+
+ALTER TABLE "idempotency_keys" DROP CONSTRAINT "idempotency_keys_pkey";
+
+ALTER TABLE "idempotency_keys" ADD PRIMARY KEY ("account_id", "key");
+
+COMMENT ON COLUMN idempotency_keys.account_id is 'Source account of the transfer, keys are unique per account';
@@ -0,0 +1,346 @@
+// Package migration applies the schema migrations of this directory, embedded in the binary
+//
+// every migration is a pair of files NNNNNN_name.up.sql / NNNNNN_name.down.sql (the golang-migrate layout, which sqlc
+// reads as well), applied in its own transaction
+// the applied versions are recorded in schema_versions together with the checksum of their files,
+// so a migration edited after it was applied is detected instead of silently diverging from the databases that ran it
+// concurrent runs (several servers starting at once) are serialized with a postgres advisory lock
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Latest is the target of Migrate that applies every migration
+const Latest int64 = -1
+
+// lockID is the key of the advisory lock held while migrating ("cashflow" in ASCII)
+const lockID int64 = 0x63617368666c6f77
+
+var (
+	ErrChecksumMismatch = errors.New("applied migration was modified")
+	ErrUnknownVersion   = errors.New("applied migration is missing from this binary")
+	ErrOutOfOrder       = errors.New("migration is older than the current version but was never applied")
+	ErrInvalidTarget    = errors.New("no migration with this version")
+	ErrInvalidFile      = errors.New("invalid migration file")
+)
+
+// Migration is an up/down pair of files
+type Migration struct {
+	Version      int64
+	Name         string
+	Up           string
+	Down         string
+	UpChecksum   string // hex sha256 of Up
+	DownChecksum string // hex sha256 of Down
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrations returns the embedded migrations ordered by version
+func Migrations() ([]Migration, error) {
+	return load(files)
+}
+
+// load reads the migrations of the root of fsys, every version needs both an up and a down file
+func load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, name := range names {
+		match := fileName.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s, expected NNNNNN_name.up.sql or NNNNNN_name.down.sql", ErrInvalidFile, name)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("%w: %s, invalid version", ErrInvalidFile, name)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("%w: %s, version %d is also named %q", ErrInvalidFile, name, version, m.Name)
+		}
+		if match[3] == "up" {
+			m.Up, m.UpChecksum = string(data), checksum(data)
+		} else {
+			m.Down, m.DownChecksum = string(data), checksum(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpChecksum == "" || m.DownChecksum == "" {
+			return nil, fmt.Errorf("%w: version %d needs both an up and a down file", ErrInvalidFile, m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Migrate applies or rolls back migrations until version target is the last one applied
+// (Latest applies everything, 0 rolls everything back)
+// it refuses to run when an applied migration was modified or is unknown to this binary, or when a migration
+// older than the current version was never applied
+func Migrate(ctx context.Context, db *sql.DB, target int64) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	return migrate(ctx, db, migrations, target)
+}
+
+// Version returns the last applied migration, 0 when none is
+func Version(ctx context.Context, db *sql.DB) (int64, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_versions') IS NOT NULL`).Scan(&exists); err != nil || !exists {
+		return 0, err
+	}
+	var version int64
+	err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_versions`).Scan(&version)
+	return version, err
+}
+
+func migrate(ctx context.Context, db *sql.DB, migrations []Migration, target int64) error {
+	if target == Latest {
+		target = 0
+		if len(migrations) > 0 {
+			target = migrations[len(migrations)-1].Version
+		}
+	}
+	if target < 0 || (target > 0 && find(migrations, target) < 0) {
+		return fmt.Errorf("%w: %d", ErrInvalidTarget, target)
+	}
+
+	// the advisory lock belongs to the session, so everything runs on one connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("cannot lock migrations: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID)
+
+	if err := createVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	if err := adoptGolangMigrate(ctx, conn, migrations); err != nil {
+		return err
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if err := verify(migrations, applied); err != nil {
+		return err
+	}
+
+	// up: every migration not applied yet up to target, down: every applied one above target, newest first
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok && m.Version <= target {
+			if err := step(ctx, conn, m, true); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; ok && m.Version > target {
+			if err := step(ctx, conn, m, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func find(migrations []Migration, version int64) int {
+	for i, m := range migrations {
+		if m.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func createVersionTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_versions (
+  version bigint PRIMARY KEY,
+  name varchar NOT NULL,
+  up_checksum varchar NOT NULL,
+  down_checksum varchar NOT NULL,
+  applied_at timestamptz NOT NULL DEFAULT (now())
+)`)
+	if err != nil {
+		return fmt.Errorf("cannot create schema_versions: %w", err)
+	}
+	return nil
+}
+
+// appliedRow is a row of schema_versions
+type appliedRow struct {
+	upChecksum   string
+	downChecksum string
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]appliedRow, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, up_checksum, down_checksum FROM schema_versions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]appliedRow)
+	for rows.Next() {
+		var version int64
+		var row appliedRow
+		if err := rows.Scan(&version, &row.upChecksum, &row.downChecksum); err != nil {
+			return nil, err
+		}
+		applied[version] = row
+	}
+	return applied, rows.Err()
+}
+
+// verify checks the applied versions against the migrations of the binary before anything runs
+func verify(migrations []Migration, applied map[int64]appliedRow) error {
+	var current int64
+	for version, row := range applied {
+		i := find(migrations, version)
+		if i < 0 {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+		m := migrations[i]
+		if row.upChecksum != m.UpChecksum {
+			return fmt.Errorf("%w: %06d_%s.up.sql", ErrChecksumMismatch, m.Version, m.Name)
+		}
+		if row.downChecksum != m.DownChecksum {
+			return fmt.Errorf("%w: %06d_%s.down.sql", ErrChecksumMismatch, m.Version, m.Name)
+		}
+		if version > current {
+			current = version
+		}
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok && m.Version < current {
+			return fmt.Errorf("%w: version %d (current %d)", ErrOutOfOrder, m.Version, current)
+		}
+	}
+	return nil
+}
+
+// step runs the up or down file of m and records it, in a single transaction
+func step(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, direction := m.Down, "down"
+	if up {
+		script, direction = m.Up, "up"
+	}
+	// without arguments the whole file goes through the simple query protocol, which accepts several statements
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("%06d_%s.%s.sql: %w", m.Version, m.Name, direction, err)
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_versions (version, name, up_checksum, down_checksum) VALUES ($1, $2, $3, $4)`,
+			m.Version, m.Name, m.UpChecksum, m.DownChecksum)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_versions WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// adoptGolangMigrate records the versions applied by the migrate CLI (schema_migrations) the first time
+// a database that was migrated with it is seen, trusting that its files match the embedded ones
+// schema_migrations is dropped in the same transaction, from then on schema_versions is the only record
+func adoptGolangMigrate(ctx context.Context, conn *sql.Conn, migrations []Migration) error {
+	var count int64
+	if err := conn.QueryRowContext(ctx, `SELECT count(*) FROM schema_versions`).Scan(&count); err != nil {
+		return err
+	}
+	var exists bool
+	if err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return err
+	}
+	if count > 0 || !exists {
+		return nil
+	}
+
+	var version int64
+	var dirty bool
+	err := conn.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("schema_migrations is dirty at version %d, fix it with the migrate CLI first", version)
+	}
+	if version > 0 && find(migrations, version) < 0 {
+		return fmt.Errorf("%w: version %d (schema_migrations)", ErrUnknownVersion, version)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		_, err := tx.ExecContext(ctx, `INSERT INTO schema_versions (version, name, up_checksum, down_checksum) VALUES ($1, $2, $3, $4)`,
+			m.Version, m.Name, m.UpChecksum, m.DownChecksum)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE schema_migrations`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
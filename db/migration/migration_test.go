@@ -0,0 +1,168 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/harshaljanjani/cashflow.net/config"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		// versions are sequential, without gaps
+		require.Equal(t, int64(i+1), m.Version)
+		require.NotEmpty(t, m.Up)
+		require.NotEmpty(t, m.Down)
+		require.Len(t, m.UpChecksum, 64)
+	}
+	require.Equal(t, "init_schema", migrations[0].Name)
+}
+
+func TestLoadErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"MissingDown", fstest.MapFS{"000001_init.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"BadName", fstest.MapFS{"init.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"ZeroVersion", fstest.MapFS{"000000_init.up.sql": {}, "000000_init.down.sql": {}}},
+		{"NameMismatch", fstest.MapFS{"000001_init.up.sql": {}, "000001_other.down.sql": {}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := load(tc.files)
+			require.ErrorIs(t, err, ErrInvalidFile)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	migrations, err := load(fstest.MapFS{
+		"000001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"000001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"000002_b.up.sql":   {Data: []byte("CREATE TABLE b (id int);")},
+		"000002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+	})
+	require.NoError(t, err)
+	row := func(m Migration) appliedRow {
+		return appliedRow{upChecksum: m.UpChecksum, downChecksum: m.DownChecksum}
+	}
+
+	require.NoError(t, verify(migrations, map[int64]appliedRow{}))
+	require.NoError(t, verify(migrations, map[int64]appliedRow{1: row(migrations[0])}))
+
+	edited := row(migrations[0])
+	edited.downChecksum = checksum([]byte("DROP TABLE a CASCADE;"))
+	require.ErrorIs(t, verify(migrations, map[int64]appliedRow{1: edited}), ErrChecksumMismatch)
+	require.ErrorIs(t, verify(migrations, map[int64]appliedRow{3: row(migrations[0])}), ErrUnknownVersion)
+	require.ErrorIs(t, verify(migrations, map[int64]appliedRow{2: row(migrations[1])}), ErrOutOfOrder)
+}
+
+// newTestDB returns a connection to an empty schema of the test database, dropped with the test
+func newTestDB(t *testing.T) *sql.DB {
+	cfg, err := config.Load("../../app.env")
+	require.NoError(t, err)
+	admin, err := cfg.OpenDB()
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "migration_test_" + util.RandomString(8)
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	// lib/pq sends unknown parameters of the connection string as run-time settings
+	source, err := url.Parse(cfg.DBSource.Value())
+	require.NoError(t, err)
+	query := source.Query()
+	query.Set("search_path", schema)
+	source.RawQuery = query.Encode()
+	db, err := sql.Open(cfg.DBDriver, source.String())
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+
+	require.NoError(t, Migrate(ctx, db, Latest))
+	version, err := Version(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, latest, version)
+	_, err = db.Exec("SELECT id, owner, status FROM accounts")
+	require.NoError(t, err)
+
+	// running again is a no-op
+	require.NoError(t, Migrate(ctx, db, Latest))
+
+	require.NoError(t, Migrate(ctx, db, 2))
+	version, err = Version(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), version)
+	_, err = db.Exec("SELECT status FROM accounts")
+	require.Error(t, err)
+
+	require.NoError(t, Migrate(ctx, db, 0))
+	_, err = db.Exec("SELECT id FROM accounts")
+	require.Error(t, err)
+	require.NoError(t, Migrate(ctx, db, Latest))
+
+	require.ErrorIs(t, Migrate(ctx, db, latest+1), ErrInvalidTarget)
+}
+
+func TestMigrateRefusesEditedMigration(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	files := fstest.MapFS{
+		"000001_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);")},
+		"000001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	migrations, err := load(files)
+	require.NoError(t, err)
+	require.NoError(t, migrate(ctx, db, migrations, Latest))
+
+	files["000001_a.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE a (id bigint);")}
+	migrations, err = load(files)
+	require.NoError(t, err)
+	err = migrate(ctx, db, migrations, Latest)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	require.ErrorContains(t, err, "000001_a.up.sql")
+}
+
+func TestMigrateAdoptsGolangMigrate(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	// a database migrated to version 3 by the migrate CLI
+	for _, m := range migrations[:3] {
+		_, err := db.Exec(m.Up)
+		require.NoError(t, err)
+	}
+	_, err = db.Exec(`CREATE TABLE schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL);
+INSERT INTO schema_migrations VALUES (3, false);`)
+	require.NoError(t, err)
+
+	require.NoError(t, Migrate(ctx, db, 4))
+	version, err := Version(ctx, db)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), version)
+	var exists bool
+	require.NoError(t, db.QueryRow(`SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists))
+	require.False(t, exists, "schema_migrations is dropped once adopted")
+}
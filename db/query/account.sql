@@ -37,4 +37,51 @@ RETURNING *;
 
 -- name: DeleteAccount :exec
 DELETE FROM accounts
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetAccountEntriesTotal :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS entries_total FROM entries
+WHERE account_id = $1;
+
+-- name: ListAccountEntryTotals :many
+SELECT
+  accounts.id,
+  accounts.currency,
+  accounts.balance,
+  COALESCE(SUM(entries.amount), 0)::bigint AS entries_total
+FROM accounts
+LEFT JOIN entries ON entries.account_id = accounts.id
+WHERE accounts.id > sqlc.arg(after_id)
+GROUP BY accounts.id
+ORDER BY accounts.id
+LIMIT sqlc.arg(limit); /* keyset pagination: pass the last id of the previous page as after_id (0 for the first page) */
+
+-- name: GetAccountBalanceAt :one
+SELECT (CASE
+  WHEN accounts.created_at > sqlc.arg(at) THEN 0
+  ELSE accounts.balance - COALESCE((
+    SELECT SUM(entries.amount) FROM entries
+    WHERE entries.account_id = accounts.id AND entries.created_at > sqlc.arg(at)
+  ), 0)
+END)::bigint AS balance
+FROM accounts
+WHERE accounts.id = sqlc.arg(account_id); /* walks back from the current balance, so only the entries made after at are read */
+
+-- name: ListAccountBalancesAt :many
+SELECT
+  accounts.id,
+  (CASE
+    WHEN accounts.created_at > sqlc.arg(at) THEN 0
+    ELSE accounts.balance - COALESCE(SUM(entries.amount), 0)
+  END)::bigint AS balance
+FROM accounts
+LEFT JOIN entries ON entries.account_id = accounts.id AND entries.created_at > sqlc.arg(at)
+WHERE accounts.id = ANY(sqlc.arg(account_ids)::bigint[])
+GROUP BY accounts.id
+ORDER BY accounts.id;
+
+-- name: UpdateAccountStatus :one
+UPDATE accounts
+SET status = $2, status_reason = $3, status_changed_at = now()
+WHERE id = $1
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,12 @@
+-- the rows are only ever written by the audited Querier (createAuditLog in db/sqlc/audit.go), the insert is not an sqlc
+-- query on purpose: it would be part of Querier, and so of Store, and anybody could write the log
+
+-- name: ListAuditLogs :many
+SELECT * FROM audit_log
+WHERE (sqlc.narg(actor)::varchar IS NULL OR actor = sqlc.narg(actor))
+  AND (sqlc.narg(account_id)::bigint IS NULL OR account_ids @> ARRAY[sqlc.narg(account_id)::bigint]) /* @> can use the GIN index, = ANY can't */
+  AND (sqlc.narg(from_time)::timestamptz IS NULL OR created_at > sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamptz IS NULL OR created_at <= sqlc.narg(to_time))
+ORDER BY id
+LIMIT sqlc.arg('limit')
+OFFSET sqlc.arg('offset');
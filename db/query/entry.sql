@@ -0,0 +1,26 @@
+-- name: CreateEntry :one
+INSERT INTO entries (
+  account_id,
+  amount,
+  transfer_id
+) VALUES (
+  $1, $2, $3
+) RETURNING *;
+
+-- name: GetEntry :one
+SELECT * FROM entries
+WHERE id = $1 LIMIT 1;
+
+-- name: ListEntries :many
+SELECT * FROM entries
+WHERE (sqlc.narg(account_id)::bigint IS NULL OR account_id = sqlc.narg(account_id))
+  AND (sqlc.narg(direction)::varchar IS NULL
+    OR (sqlc.narg(direction) = 'in' AND amount > 0)
+    OR (sqlc.narg(direction) = 'out' AND amount < 0))
+  AND (sqlc.narg(min_amount)::bigint IS NULL OR abs(amount) >= sqlc.narg(min_amount)) /* the amount range applies to the size of the movement, whatever its direction */
+  AND (sqlc.narg(max_amount)::bigint IS NULL OR abs(amount) <= sqlc.narg(max_amount))
+  AND (sqlc.narg(from_time)::timestamptz IS NULL OR created_at > sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamptz IS NULL OR created_at <= sqlc.narg(to_time))
+  AND (sqlc.narg(cursor_created_at)::timestamptz IS NULL OR (created_at, id) > (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::bigint)) /* keyset: continue right after the last row of the previous page */
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
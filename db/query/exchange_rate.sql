@@ -0,0 +1,30 @@
+-- name: CreateExchangeRate :one
+INSERT INTO exchange_rates (
+  base_currency,
+  quote_currency,
+  rate,
+  effective_at
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetExchangeRate :one
+SELECT * FROM exchange_rates
+WHERE id = $1 LIMIT 1;
+
+-- name: GetEffectiveExchangeRate :one
+SELECT * FROM exchange_rates
+WHERE base_currency = $1 AND quote_currency = $2 AND effective_at <= sqlc.arg(at)
+ORDER BY effective_at DESC
+LIMIT 1; /* the latest rate of the pair that was already in effect at the given time */
+
+-- name: ListExchangeRates :many
+SELECT * FROM exchange_rates
+WHERE base_currency = $1 AND quote_currency = $2
+ORDER BY effective_at DESC
+LIMIT $3
+OFFSET $4;
+
+-- name: DeleteExchangeRate :exec
+DELETE FROM exchange_rates
+WHERE id = $1;
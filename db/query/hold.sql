@@ -0,0 +1,64 @@
+-- name: CreateHold :one
+INSERT INTO holds (
+  account_id,
+  amount,
+  currency,
+  expires_at
+) VALUES (
+  sqlc.arg(account_id), sqlc.arg(amount), sqlc.arg(currency), now() + sqlc.arg(expires_in_ms)::bigint * interval '1 millisecond'
+) RETURNING *; /* expiry is always computed and checked with the db clock, like GetHeldAmount and ExpireHolds do */
+
+-- name: GetHold :one
+SELECT * FROM holds
+WHERE id = $1 LIMIT 1;
+
+-- name: GetHoldForUpdate :one
+SELECT * FROM holds
+WHERE id = $1 LIMIT 1
+FOR NO KEY UPDATE;
+
+-- name: GetActiveHoldForUpdate :one
+SELECT * FROM holds
+WHERE id = $1 AND status = 'active' AND expires_at > now() LIMIT 1
+FOR NO KEY UPDATE;
+
+-- name: ListAccountHolds :many
+SELECT * FROM holds
+WHERE account_id = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3;
+
+-- name: GetHeldAmount :one
+SELECT COALESCE(SUM(amount), 0)::bigint AS held_amount FROM holds
+WHERE account_id = $1 AND status = 'active' AND expires_at > now(); /* expired holds stop counting right away, ExpireHolds only tidies their status */
+
+-- name: GetAccountBalance :one
+SELECT
+  accounts.id,
+  accounts.currency,
+  accounts.balance AS ledger_balance,
+  (accounts.balance - COALESCE((
+    SELECT SUM(holds.amount) FROM holds
+    WHERE holds.account_id = accounts.id AND holds.status = 'active' AND holds.expires_at > now()
+  ), 0))::bigint AS available_balance
+FROM accounts
+WHERE accounts.id = $1 LIMIT 1;
+
+-- name: CaptureHold :one
+UPDATE holds
+SET status = 'captured', captured_amount = sqlc.arg(captured_amount), transfer_id = sqlc.arg(transfer_id)::bigint, updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: UpdateHoldStatus :one
+UPDATE holds
+SET status = $2, updated_at = now()
+WHERE id = $1
+RETURNING *;
+
+-- name: ExpireHolds :many
+UPDATE holds
+SET status = 'expired', updated_at = now()
+WHERE status = 'active' AND expires_at <= now()
+RETURNING *;
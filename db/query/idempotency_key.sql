@@ -0,0 +1,31 @@
+-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys (
+  account_id,
+  key,
+  request_hash,
+  expires_at
+) VALUES (
+  $1, $2, $3, $4
+) ON CONFLICT (account_id, key) DO NOTHING
+RETURNING *; /* no row (sql.ErrNoRows) when the key is already taken, waits for the transaction holding it to finish */
+
+-- name: GetIdempotencyKeyForUpdate :one
+SELECT * FROM idempotency_keys
+WHERE account_id = $1 AND key = $2 LIMIT 1
+FOR UPDATE;
+
+-- name: SetIdempotencyKeyResponse :one
+UPDATE idempotency_keys
+SET response = $3
+WHERE account_id = $1 AND key = $2
+RETURNING *;
+
+-- name: ResetIdempotencyKey :one
+UPDATE idempotency_keys /* reuse an expired key for a new request */
+SET request_hash = $3, response = '{}', created_at = now(), expires_at = $4
+WHERE account_id = $1 AND key = $2
+RETURNING *;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at <= sqlc.arg(now);
@@ -0,0 +1,39 @@
+-- name: CreateOutboxEvent :one
+INSERT INTO outbox_events (
+  event_type,
+  aggregate_type,
+  aggregate_id,
+  payload
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetOutboxEvent :one
+SELECT * FROM outbox_events
+WHERE id = $1 LIMIT 1;
+
+-- name: ListOutboxEvents :many
+SELECT * FROM outbox_events
+WHERE aggregate_type = $1 AND aggregate_id = $2
+ORDER BY id;
+
+-- name: ClaimOutboxEvents :many
+SELECT * FROM outbox_events
+WHERE sent_at IS NULL AND failed_at IS NULL
+ORDER BY id
+LIMIT $1
+FOR UPDATE SKIP LOCKED; /* rows claimed by another relay are skipped rather than waited for */
+
+-- name: MarkOutboxEventSent :one
+UPDATE outbox_events
+SET sent_at = now(), attempts = attempts + 1, last_error = ''
+WHERE id = $1
+RETURNING *;
+
+-- name: MarkOutboxEventFailed :one
+UPDATE outbox_events
+SET attempts = attempts + 1,
+    last_error = sqlc.arg(last_error),
+    failed_at = CASE WHEN attempts + 1 >= sqlc.arg(max_attempts)::int THEN now() END
+WHERE id = sqlc.arg(id)
+RETURNING *;
@@ -0,0 +1,14 @@
+-- name: ListStatementEntries :many
+SELECT
+  entries.id,
+  entries.amount,
+  entries.created_at,
+  entries.transfer_id,
+  transfers.from_account_id,
+  transfers.to_account_id
+FROM entries
+LEFT JOIN transfers ON transfers.id = entries.transfer_id
+WHERE entries.account_id = sqlc.arg(account_id)
+  AND entries.created_at > sqlc.arg(from_time)
+  AND entries.created_at <= sqlc.arg(to_time)
+ORDER BY entries.created_at, entries.id; /* same bounds as GetAccountBalanceAt: the opening balance at from_time excludes these entries, the closing balance at to_time includes them */
@@ -0,0 +1,60 @@
+-- name: CreateTransfer :one
+INSERT INTO transfers (
+  from_account_id,
+  to_account_id,
+  amount,
+  currency
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: CreateTransferReversal :one
+INSERT INTO transfers (
+  from_account_id,
+  to_account_id,
+  amount,
+  currency,
+  reversal_of
+) VALUES (
+  $1, $2, $3, $4, $5::bigint
+) RETURNING *;
+
+-- name: CreateFXTransfer :one
+INSERT INTO transfers (
+  from_account_id,
+  to_account_id,
+  amount,
+  currency,
+  converted_amount,
+  converted_currency,
+  exchange_rate
+) VALUES (
+  $1, $2, $3, $4, $5::bigint, $6::varchar, $7::numeric
+) RETURNING *;
+
+-- name: GetTransfer :one
+SELECT * FROM transfers
+WHERE id = $1 LIMIT 1;
+
+-- name: GetTransferForUpdate :one
+SELECT * FROM transfers
+WHERE id = $1 LIMIT 1
+FOR NO KEY UPDATE; /* concurrent reversals of the same transfer run one after the other */
+
+-- name: ListTransferReversals :many
+SELECT * FROM transfers
+WHERE reversal_of = sqlc.arg(transfer_id)::bigint
+ORDER BY id;
+
+-- name: ListTransfers :many
+SELECT * FROM transfers
+WHERE (sqlc.narg(account_id)::bigint IS NULL
+    OR (sqlc.narg(direction)::varchar IS DISTINCT FROM 'in' AND from_account_id = sqlc.narg(account_id))
+    OR (sqlc.narg(direction) IS DISTINCT FROM 'out' AND to_account_id = sqlc.narg(account_id))) /* direction is relative to account_id: out = sent by it, in = received by it */
+  AND (sqlc.narg(min_amount)::bigint IS NULL OR amount >= sqlc.narg(min_amount))
+  AND (sqlc.narg(max_amount)::bigint IS NULL OR amount <= sqlc.narg(max_amount))
+  AND (sqlc.narg(from_time)::timestamptz IS NULL OR created_at > sqlc.narg(from_time))
+  AND (sqlc.narg(to_time)::timestamptz IS NULL OR created_at <= sqlc.narg(to_time))
+  AND (sqlc.narg(cursor_created_at)::timestamptz IS NULL OR (created_at, id) > (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::bigint))
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
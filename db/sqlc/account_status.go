@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// statuses of an account (accounts.status)
+// active: no restriction
+// frozen: money can come in but can't go out (compliance, disputes)
+// dormant: no restriction, flags accounts without recent activity
+// closed: no money in or out, terminal
+const (
+	AccountStatusActive  = "active"
+	AccountStatusFrozen  = "frozen"
+	AccountStatusDormant = "dormant"
+	AccountStatusClosed  = "closed"
+)
+
+// accountStatusTransitions lists the statuses each status can move to, closed accounts stay closed
+var accountStatusTransitions = map[string][]string{
+	AccountStatusActive:  {AccountStatusFrozen, AccountStatusDormant, AccountStatusClosed},
+	AccountStatusFrozen:  {AccountStatusActive, AccountStatusClosed},
+	AccountStatusDormant: {AccountStatusActive, AccountStatusFrozen, AccountStatusClosed},
+}
+
+// CanTransitionAccountStatus reports whether an account can go from one status to the other
+func CanTransitionAccountStatus(from, to string) bool {
+	for _, status := range accountStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// input params of the status transactions (FreezeAccountTx, UnfreezeAccountTx, ...)
+type AccountStatusTxParams struct {
+	AccountID int64  `json:"account_id"`
+	Reason    string `json:"reason"` // required, kept on the account and in the audit trail
+	Actor     string `json:"actor"`  // who requested the change (user, service, compliance officer, ...)
+}
+
+// output params of the status transactions
+type AccountStatusTxResult struct {
+	Account Account             `json:"account"` // the account after the change
+	Change  AccountStatusChange `json:"change"`  // the audit record of the change
+}
+
+// input params of the close transaction
+type CloseAccountTxParams struct {
+	AccountID int64 `json:"account_id"`
+	// receives the remaining balance, must hold the same currency, optional when the balance is already zero
+	DestinationAccountID int64  `json:"destination_account_id,omitempty"`
+	Reason               string `json:"reason"`
+	Actor                string `json:"actor"`
+}
+
+// output params of the close transaction: the closing summary
+type CloseAccountTxResult struct {
+	AccountStatusTxResult
+	SweptAmount int64            `json:"swept_amount"` // balance moved to the destination, 0 when there was nothing to move
+	Sweep       TransferTxResult `json:"sweep"`        // the sweep transfer, zero when SweptAmount is 0
+}
+
+// FreezeAccountTx blocks money from leaving an active or dormant account, credits are still accepted
+func (store *SQLStore) FreezeAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusFrozen, "")
+}
+
+// UnfreezeAccountTx makes a frozen account active again
+func (store *SQLStore) UnfreezeAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusActive, AccountStatusFrozen)
+}
+
+// MarkAccountDormantTx flags an active account as dormant
+func (store *SQLStore) MarkAccountDormantTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusDormant, AccountStatusActive)
+}
+
+// ReactivateAccountTx makes a dormant account active again
+func (store *SQLStore) ReactivateAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusActive, AccountStatusDormant)
+}
+
+// CloseAccountTx closes an account for good within a single canned transaction, the account and its history are kept
+// 1) refuse while holds are pending (ErrHoldsPending) or the balance is negative (ErrNegativeBalance)
+// 2) move the remaining balance to the destination account with a regular transfer and entries
+// (ErrAccountNotEmpty if there is a balance and no destination, ErrAccountFrozen if the account is frozen:
+// a frozen account can only be closed once it is empty)
+// 3) mark the account closed and record the change
+func (store *SQLStore) CloseAccountTx(ctx context.Context, arg CloseAccountTxParams) (CloseAccountTxResult, error) {
+	var result CloseAccountTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = closeAccountTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+func (store *SQLStore) accountStatusTx(ctx context.Context, arg AccountStatusTxParams, to, from string) (AccountStatusTxResult, error) {
+	var result AccountStatusTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = accountStatusTx(ctx, q, arg, to, from)
+		return err
+	})
+	return result, err
+}
+
+// accountStatusTx moves a locked account to status to and writes the audit record of the change
+// from restricts the current status of the account, empty means any status that can move to to
+func accountStatusTx(ctx context.Context, q Querier, arg AccountStatusTxParams, to, from string) (result AccountStatusTxResult, err error) {
+	if strings.TrimSpace(arg.Reason) == "" {
+		return result, ErrReasonRequired
+	}
+	accounts, err := lockAccounts(ctx, q, arg.AccountID)
+	if err != nil {
+		return
+	}
+	account := accounts[arg.AccountID]
+	if (from != "" && account.Status != from) || !CanTransitionAccountStatus(account.Status, to) {
+		return result, fmt.Errorf("%w: account %d is %s, can't become %s", ErrInvalidStatusTransition, account.ID, account.Status, to)
+	}
+	return setAccountStatus(ctx, q, account, to, arg)
+}
+
+func closeAccountTx(ctx context.Context, q Querier, arg CloseAccountTxParams) (result CloseAccountTxResult, err error) {
+	if strings.TrimSpace(arg.Reason) == "" {
+		return result, ErrReasonRequired
+	}
+	if arg.DestinationAccountID == arg.AccountID {
+		return result, fmt.Errorf("%w: %d", ErrSameAccount, arg.AccountID)
+	}
+
+	// 1) lock the account (and the destination if there is something to sweep) and check it can be closed
+	// the balance is peeked before locking so both accounts are locked in ascending order
+	ids := []int64{arg.AccountID}
+	if arg.DestinationAccountID != 0 {
+		var peek Account
+		peek, err = q.GetAccount(ctx, arg.AccountID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = fmt.Errorf("%w: %d", ErrAccountNotFound, arg.AccountID)
+			}
+			return
+		}
+		if peek.Balance > 0 {
+			ids = append(ids, arg.DestinationAccountID)
+		}
+	}
+	accounts, err := lockAccounts(ctx, q, ids...)
+	if err != nil {
+		return
+	}
+	account := accounts[arg.AccountID]
+	if !CanTransitionAccountStatus(account.Status, AccountStatusClosed) {
+		return result, fmt.Errorf("%w: account %d is %s, can't become %s", ErrInvalidStatusTransition, account.ID, account.Status, AccountStatusClosed)
+	}
+	held, err := q.GetHeldAmount(ctx, account.ID)
+	if err != nil {
+		return
+	}
+	if held != 0 {
+		return result, fmt.Errorf("%w: account %d has %d on hold", ErrHoldsPending, account.ID, held)
+	}
+	if account.Balance < 0 {
+		return result, fmt.Errorf("%w: account %d has a balance of %d", ErrNegativeBalance, account.ID, account.Balance)
+	}
+
+	// 2) sweep, a regular debit: not from a frozen account
+	if account.Balance > 0 {
+		if arg.DestinationAccountID == 0 {
+			return result, fmt.Errorf("%w: account %d has a balance of %d and no destination", ErrAccountNotEmpty, account.ID, account.Balance)
+		}
+		if err = checkDebit(account); err != nil {
+			return
+		}
+		destination, ok := accounts[arg.DestinationAccountID]
+		if !ok {
+			// credited since the peek: this lock is out of order, a deadlock is retried like any other
+			var locked map[int64]Account
+			if locked, err = lockAccounts(ctx, q, arg.DestinationAccountID); err != nil {
+				return
+			}
+			destination = locked[arg.DestinationAccountID]
+		}
+		if err = checkCurrency(destination, account.Currency); err != nil {
+			return
+		}
+		if err = checkCredit(destination); err != nil {
+			return
+		}
+		var transfer Transfer
+		transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
+			FromAccountID: account.ID,
+			ToAccountID:   destination.ID,
+			Amount:        account.Balance,
+			Currency:      account.Currency,
+		})
+		if err != nil {
+			return
+		}
+		result.Sweep, err = postTransfer(ctx, q, transfer)
+		if err != nil {
+			return
+		}
+		result.SweptAmount = transfer.Amount
+		account = result.Sweep.FromAccount
+	}
+
+	// 3) closed
+	result.AccountStatusTxResult, err = setAccountStatus(ctx, q, account, AccountStatusClosed, AccountStatusTxParams{
+		AccountID: account.ID,
+		Reason:    arg.Reason,
+		Actor:     arg.Actor,
+	})
+	return
+}
+
+// setAccountStatus updates a locked account and records the change (history and outbox event), the transition must already be validated
+func setAccountStatus(ctx context.Context, q Querier, account Account, to string, arg AccountStatusTxParams) (result AccountStatusTxResult, err error) {
+	result.Account, err = q.UpdateAccountStatus(ctx, UpdateAccountStatusParams{
+		ID:           account.ID,
+		Status:       to,
+		StatusReason: arg.Reason,
+	})
+	if err != nil {
+		return
+	}
+	result.Change, err = q.CreateAccountStatusChange(ctx, CreateAccountStatusChangeParams{
+		AccountID:  account.ID,
+		FromStatus: account.Status,
+		ToStatus:   to,
+		Reason:     arg.Reason,
+		Actor:      arg.Actor,
+	})
+	if err != nil {
+		return
+	}
+	err = createAccountStatusEvent(ctx, q, result.Account, result.Change)
+	return
+}
+
+// checkDebit returns ErrAccountFrozen or ErrAccountClosed if money can't leave the account
+func checkDebit(account Account) error {
+	switch account.Status {
+	case AccountStatusFrozen:
+		return fmt.Errorf("%w: %d", ErrAccountFrozen, account.ID)
+	case AccountStatusClosed:
+		return fmt.Errorf("%w: %d", ErrAccountClosed, account.ID)
+	}
+	return nil
+}
+
+// checkCredit returns ErrAccountClosed if money can't come into the account
+func checkCredit(account Account) error {
+	if account.Status == AccountStatusClosed {
+		return fmt.Errorf("%w: %d", ErrAccountClosed, account.ID)
+	}
+	return nil
+}
@@ -14,8 +14,9 @@ import (
 
 func createRandomAccount(t* testing.T) Account{
 	// generate random values, avoid conflicts between unit tests (helps in the case of unique constraints)
+	user := createRandomUser(t)
 	arg := CreateAccountParams{
-		Owner: util.RandomOwner(),
+		Owner: user.Username,
 		Balance: util.RandomMoney(),
 		Currency: util.RandomCurrency(),
 	}
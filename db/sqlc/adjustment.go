@@ -0,0 +1,47 @@
+package db
+
+import (
+	"context"
+)
+
+// output params of the balance adjustment transaction
+type AdjustBalanceTxResult struct {
+	Account      Account `json:"account"`
+	EntriesTotal int64   `json:"entries_total"` // sum of the entries of the account before the adjustment
+	Drift        int64   `json:"drift"`         // balance minus entries total, 0 when the account was already consistent
+	Entry        Entry   `json:"entry"`         // the adjustment entry, zero when there was no drift
+}
+
+// AdjustBalanceTx makes the entries of an account add up to its balance again
+// the balance is taken as the truth: the difference is written as a single adjustment entry, the balance itself doesn't change
+// the account is locked while its entries are summed, so a concurrent transfer can't slip in between the check and the fix
+func (store *SQLStore) AdjustBalanceTx(ctx context.Context, accountID int64) (AdjustBalanceTxResult, error) {
+	var result AdjustBalanceTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = adjustBalanceTx(ctx, q, accountID)
+		return err
+	})
+	return result, err
+}
+
+func adjustBalanceTx(ctx context.Context, q Querier, accountID int64) (result AdjustBalanceTxResult, err error) {
+	accounts, err := lockAccounts(ctx, q, accountID)
+	if err != nil {
+		return
+	}
+	result.Account = accounts[accountID]
+	result.EntriesTotal, err = q.GetAccountEntriesTotal(ctx, accountID)
+	if err != nil {
+		return
+	}
+	result.Drift = result.Account.Balance - result.EntriesTotal
+	if result.Drift == 0 {
+		return
+	}
+	result.Entry, err = q.CreateEntry(ctx, CreateEntryParams{
+		AccountID: accountID,
+		Amount:    result.Drift,
+	})
+	return
+}
@@ -0,0 +1,397 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// every write a Store makes to the ledger tables (accounts, transfers, entries, holds, users, exchange rates) records an
+// audit_log row in the same transaction: who made it (the actor of the context, see WithActor), what it did to which row,
+// and the row before and after
+// canned transactions get this from execTx, which hands their body an auditQueries, the single writes of a Store run in
+// a transaction of their own for the same reason
+// bookkeeping tables (idempotency keys, status history, outbox, webhooks) are not audited, their rows follow from audited changes
+
+// SystemActor is the actor of writes whose context doesn't carry one (background jobs, unauthenticated requests)
+const SystemActor = "system"
+
+// what happened to the target (audit_log.action)
+const (
+	AuditActionCreate     = "create"
+	AuditActionUpdate     = "update"
+	AuditActionDelete     = "delete"
+	AuditActionAddBalance = "add_balance"
+	AuditActionSetStatus  = "set_status"
+	AuditActionCapture    = "capture"
+	AuditActionExpire     = "expire"
+)
+
+// table of the changed row (audit_log.target_type)
+const (
+	AuditTargetAccount      = "account"
+	AuditTargetTransfer     = "transfer"
+	AuditTargetEntry        = "entry"
+	AuditTargetHold         = "hold"
+	AuditTargetUser         = "user"
+	AuditTargetExchangeRate = "exchange_rate"
+)
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx whose writes are recorded in the audit log as made by actor
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, SystemActor if there is none
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+// auditLogger is a Querier that can also write the audit log, the insert is left out of Querier (and so of Store) on purpose:
+// only auditQueries writes audit_log rows
+type auditLogger interface {
+	Querier
+	createAuditLog(ctx context.Context, arg createAuditLogParams) (AuditLog, error)
+}
+
+// auditQueries is a Querier that records every ledger write made through it, the Querier must be bound to a transaction
+type auditQueries struct {
+	auditLogger
+}
+
+const createAuditLog = `-- name: createAuditLog :one
+INSERT INTO audit_log (
+  actor,
+  action,
+  target_type,
+  target_id,
+  account_ids,
+  before,
+  after
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+) RETURNING id, actor, action, target_type, target_id, account_ids, before, after, created_at
+`
+
+type createAuditLogParams struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	AccountIds []int64
+	Before     json.RawMessage
+	After      json.RawMessage
+}
+
+func (q *Queries) createAuditLog(ctx context.Context, arg createAuditLogParams) (AuditLog, error) {
+	row := q.db.QueryRowContext(ctx, createAuditLog,
+		arg.Actor,
+		arg.Action,
+		arg.TargetType,
+		arg.TargetID,
+		pq.Array(arg.AccountIds),
+		arg.Before,
+		arg.After,
+	)
+	var i AuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.Actor,
+		&i.Action,
+		&i.TargetType,
+		&i.TargetID,
+		pq.Array(&i.AccountIds),
+		&i.Before,
+		&i.After,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+// audit writes the audit_log row of a change, before and after are marshalled to JSON (nil is null)
+func (q auditQueries) audit(ctx context.Context, action, targetType, targetID string, accountIDs []int64, before, after any) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	if accountIDs == nil {
+		accountIDs = []int64{} // the column is NOT NULL
+	}
+	_, err = q.auditLogger.createAuditLog(ctx, createAuditLogParams{
+		Actor:      ActorFromContext(ctx),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		AccountIds: accountIDs,
+		Before:     beforeJSON,
+		After:      afterJSON,
+	})
+	return err
+}
+
+func auditID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// auditUser drops the password hash, the audit log must not become a second copy of the credentials
+func auditUser(user User) User {
+	user.HashedPassword = ""
+	return user
+}
+
+func (q auditQueries) CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error) {
+	account, err := q.auditLogger.CreateAccount(ctx, arg)
+	if err != nil {
+		return account, err
+	}
+	return account, q.audit(ctx, AuditActionCreate, AuditTargetAccount, auditID(account.ID), []int64{account.ID}, nil, account)
+}
+
+func (q auditQueries) UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error) {
+	before, err := q.auditLogger.GetAccountForUpdate(ctx, arg.ID)
+	if err != nil {
+		return Account{}, err
+	}
+	account, err := q.auditLogger.UpdateAccount(ctx, arg)
+	if err != nil {
+		return account, err
+	}
+	return account, q.audit(ctx, AuditActionUpdate, AuditTargetAccount, auditID(account.ID), []int64{account.ID}, before, account)
+}
+
+func (q auditQueries) DeleteAccount(ctx context.Context, id int64) error {
+	before, err := q.auditLogger.GetAccountForUpdate(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return q.auditLogger.DeleteAccount(ctx, id) // deletes nothing, there is nothing to record
+	}
+	if err != nil {
+		return err
+	}
+	if err := q.auditLogger.DeleteAccount(ctx, id); err != nil {
+		return err
+	}
+	return q.audit(ctx, AuditActionDelete, AuditTargetAccount, auditID(id), []int64{id}, before, nil)
+}
+
+// AddAccountBalance doesn't need to read the account first, the balance before is the balance after minus the amount
+func (q auditQueries) AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error) {
+	account, err := q.auditLogger.AddAccountBalance(ctx, arg)
+	if err != nil {
+		return account, err
+	}
+	before := account
+	before.Balance -= arg.Amount
+	return account, q.audit(ctx, AuditActionAddBalance, AuditTargetAccount, auditID(account.ID), []int64{account.ID}, before, account)
+}
+
+func (q auditQueries) UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) (Account, error) {
+	before, err := q.auditLogger.GetAccountForUpdate(ctx, arg.ID)
+	if err != nil {
+		return Account{}, err
+	}
+	account, err := q.auditLogger.UpdateAccountStatus(ctx, arg)
+	if err != nil {
+		return account, err
+	}
+	return account, q.audit(ctx, AuditActionSetStatus, AuditTargetAccount, auditID(account.ID), []int64{account.ID}, before, account)
+}
+
+func (q auditQueries) auditTransfer(ctx context.Context, transfer Transfer, err error) (Transfer, error) {
+	if err != nil {
+		return transfer, err
+	}
+	return transfer, q.audit(ctx, AuditActionCreate, AuditTargetTransfer, auditID(transfer.ID), []int64{transfer.FromAccountID, transfer.ToAccountID}, nil, transfer)
+}
+
+func (q auditQueries) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
+	transfer, err := q.auditLogger.CreateTransfer(ctx, arg)
+	return q.auditTransfer(ctx, transfer, err)
+}
+
+func (q auditQueries) CreateFXTransfer(ctx context.Context, arg CreateFXTransferParams) (Transfer, error) {
+	transfer, err := q.auditLogger.CreateFXTransfer(ctx, arg)
+	return q.auditTransfer(ctx, transfer, err)
+}
+
+func (q auditQueries) CreateTransferReversal(ctx context.Context, arg CreateTransferReversalParams) (Transfer, error) {
+	transfer, err := q.auditLogger.CreateTransferReversal(ctx, arg)
+	return q.auditTransfer(ctx, transfer, err)
+}
+
+func (q auditQueries) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
+	entry, err := q.auditLogger.CreateEntry(ctx, arg)
+	if err != nil {
+		return entry, err
+	}
+	return entry, q.audit(ctx, AuditActionCreate, AuditTargetEntry, auditID(entry.ID), []int64{entry.AccountID}, nil, entry)
+}
+
+func (q auditQueries) CreateHold(ctx context.Context, arg CreateHoldParams) (Hold, error) {
+	hold, err := q.auditLogger.CreateHold(ctx, arg)
+	if err != nil {
+		return hold, err
+	}
+	return hold, q.audit(ctx, AuditActionCreate, AuditTargetHold, auditID(hold.ID), []int64{hold.AccountID}, nil, hold)
+}
+
+func (q auditQueries) CaptureHold(ctx context.Context, arg CaptureHoldParams) (Hold, error) {
+	before, err := q.auditLogger.GetHoldForUpdate(ctx, arg.ID)
+	if err != nil {
+		return Hold{}, err
+	}
+	hold, err := q.auditLogger.CaptureHold(ctx, arg)
+	if err != nil {
+		return hold, err
+	}
+	return hold, q.audit(ctx, AuditActionCapture, AuditTargetHold, auditID(hold.ID), []int64{hold.AccountID}, before, hold)
+}
+
+func (q auditQueries) UpdateHoldStatus(ctx context.Context, arg UpdateHoldStatusParams) (Hold, error) {
+	before, err := q.auditLogger.GetHoldForUpdate(ctx, arg.ID)
+	if err != nil {
+		return Hold{}, err
+	}
+	hold, err := q.auditLogger.UpdateHoldStatus(ctx, arg)
+	if err != nil {
+		return hold, err
+	}
+	return hold, q.audit(ctx, AuditActionSetStatus, AuditTargetHold, auditID(hold.ID), []int64{hold.AccountID}, before, hold)
+}
+
+// ExpireHolds records a row per expired hold
+// a hold is only ever updated when it leaves 'active', so before the update it was the same row, active and unchanged since its creation
+func (q auditQueries) ExpireHolds(ctx context.Context) ([]Hold, error) {
+	holds, err := q.auditLogger.ExpireHolds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, hold := range holds {
+		before := hold
+		before.Status = HoldStatusActive
+		before.UpdatedAt = hold.CreatedAt
+		if err := q.audit(ctx, AuditActionExpire, AuditTargetHold, auditID(hold.ID), []int64{hold.AccountID}, before, hold); err != nil {
+			return nil, err
+		}
+	}
+	return holds, nil
+}
+
+func (q auditQueries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	user, err := q.auditLogger.CreateUser(ctx, arg)
+	if err != nil {
+		return user, err
+	}
+	return user, q.audit(ctx, AuditActionCreate, AuditTargetUser, user.Username, nil, nil, auditUser(user))
+}
+
+func (q auditQueries) CreateExchangeRate(ctx context.Context, arg CreateExchangeRateParams) (ExchangeRate, error) {
+	rate, err := q.auditLogger.CreateExchangeRate(ctx, arg)
+	if err != nil {
+		return rate, err
+	}
+	return rate, q.audit(ctx, AuditActionCreate, AuditTargetExchangeRate, auditID(rate.ID), nil, nil, rate)
+}
+
+func (q auditQueries) DeleteExchangeRate(ctx context.Context, id int64) error {
+	before, err := q.auditLogger.GetExchangeRate(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return q.auditLogger.DeleteExchangeRate(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := q.auditLogger.DeleteExchangeRate(ctx, id); err != nil {
+		return err
+	}
+	return q.audit(ctx, AuditActionDelete, AuditTargetExchangeRate, auditID(id), nil, before, nil)
+}
+
+// auditTx runs a single write of a Store in a transaction of its own, so its audit_log row commits (or not) with it
+func auditTx[T any](ctx context.Context, execTx func(context.Context, func(Querier) error) error, write func(Querier) (T, error)) (T, error) {
+	var result T
+	err := execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = write(q)
+		return err
+	})
+	return result, err
+}
+
+// the ledger writes of SQLStore, the other queries go straight to the embedded queries
+
+func (store *SQLStore) CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.CreateAccount(ctx, arg) })
+}
+
+func (store *SQLStore) UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.UpdateAccount(ctx, arg) })
+}
+
+func (store *SQLStore) DeleteAccount(ctx context.Context, id int64) error {
+	return store.execTx(ctx, func(q Querier) error { return q.DeleteAccount(ctx, id) })
+}
+
+func (store *SQLStore) AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.AddAccountBalance(ctx, arg) })
+}
+
+func (store *SQLStore) UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.UpdateAccountStatus(ctx, arg) })
+}
+
+func (store *SQLStore) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Transfer, error) { return q.CreateTransfer(ctx, arg) })
+}
+
+func (store *SQLStore) CreateFXTransfer(ctx context.Context, arg CreateFXTransferParams) (Transfer, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Transfer, error) { return q.CreateFXTransfer(ctx, arg) })
+}
+
+func (store *SQLStore) CreateTransferReversal(ctx context.Context, arg CreateTransferReversalParams) (Transfer, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Transfer, error) { return q.CreateTransferReversal(ctx, arg) })
+}
+
+func (store *SQLStore) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Entry, error) { return q.CreateEntry(ctx, arg) })
+}
+
+func (store *SQLStore) CreateHold(ctx context.Context, arg CreateHoldParams) (Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Hold, error) { return q.CreateHold(ctx, arg) })
+}
+
+func (store *SQLStore) CaptureHold(ctx context.Context, arg CaptureHoldParams) (Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Hold, error) { return q.CaptureHold(ctx, arg) })
+}
+
+func (store *SQLStore) UpdateHoldStatus(ctx context.Context, arg UpdateHoldStatusParams) (Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Hold, error) { return q.UpdateHoldStatus(ctx, arg) })
+}
+
+func (store *SQLStore) ExpireHolds(ctx context.Context) ([]Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) ([]Hold, error) { return q.ExpireHolds(ctx) })
+}
+
+func (store *SQLStore) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (User, error) { return q.CreateUser(ctx, arg) })
+}
+
+func (store *SQLStore) CreateExchangeRate(ctx context.Context, arg CreateExchangeRateParams) (ExchangeRate, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (ExchangeRate, error) { return q.CreateExchangeRate(ctx, arg) })
+}
+
+func (store *SQLStore) DeleteExchangeRate(ctx context.Context, id int64) error {
+	return store.execTx(ctx, func(q Querier) error { return q.DeleteExchangeRate(ctx, id) })
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// point-in-time balances are computed backwards from the current balance: balance at t = balance - entries made after t
+// so they always agree with accounts.balance, even for accounts whose opening balance has no entry behind it
+// an account didn't exist before its created_at, its balance is 0 then
+
+// GetBalanceAt returns the balance of an account at the given instant (entries made exactly at t are included)
+func (store *SQLStore) GetBalanceAt(ctx context.Context, accountID int64, at time.Time) (int64, error) {
+	return getBalanceAt(ctx, store.sqlQueries, accountID, at)
+}
+
+// GetBalancesAt returns the balances of many accounts at the same instant, computed in a single statement (a consistent snapshot)
+func (store *SQLStore) GetBalancesAt(ctx context.Context, accountIDs []int64, at time.Time) (map[int64]int64, error) {
+	return getBalancesAt(ctx, store.sqlQueries, accountIDs, at)
+}
+
+func getBalanceAt(ctx context.Context, q Querier, accountID int64, at time.Time) (int64, error) {
+	balance, err := q.GetAccountBalanceAt(ctx, GetAccountBalanceAtParams{
+		At:        at,
+		AccountID: accountID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("%w: %d", ErrAccountNotFound, accountID)
+	}
+	return balance, err
+}
+
+// a missing account returns ErrAccountNotFound
+func getBalancesAt(ctx context.Context, q Querier, accountIDs []int64, at time.Time) (map[int64]int64, error) {
+	rows, err := q.ListAccountBalancesAt(ctx, ListAccountBalancesAtParams{
+		At:         at,
+		AccountIds: accountIDs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		balances[row.ID] = row.Balance
+	}
+	for _, id := range accountIDs {
+		if _, ok := balances[id]; !ok {
+			return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+		}
+	}
+	return balances, nil
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// TransferLeg is a single movement of money inside a batch
+type TransferLeg struct {
+	FromAccountID int64 `json:"from_account_id"`
+	ToAccountID   int64 `json:"to_account_id"`
+	Amount        int64 `json:"amount"`
+}
+
+// input params of the batch transfer transaction
+type BatchTransferTxParams struct {
+	Legs     []TransferLeg `json:"legs"`
+	Currency string        `json:"currency"` // every account of the batch must hold this currency
+}
+
+// output params of the batch transfer transaction
+type BatchTransferTxResult struct {
+	Transfers []Transfer `json:"transfers"` // one per leg, in the order of the legs
+	Entries   []Entry    `json:"entries"`   // two per leg (from, to), in the order of the legs
+	Accounts  []Account  `json:"accounts"`  // final state of every affected account, ascending by id
+}
+
+// BatchTransferTx moves money along any number of legs (payroll runs, marketplace splits) in a single canned transaction:
+// every leg is committed or none is
+// 1) validate every leg and lock every affected account in ascending id order, so concurrent batches can't deadlock
+// 2) an account may go through intermediate negative balances inside the batch, only its final balance must be covered
+// 3) write a transfer and two entries per leg, then apply the net change of each account (again in ascending id order)
+func (store *SQLStore) BatchTransferTx(ctx context.Context, arg BatchTransferTxParams) (BatchTransferTxResult, error) {
+	var result BatchTransferTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = batchTransferTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+func batchTransferTx(ctx context.Context, q Querier, arg BatchTransferTxParams) (result BatchTransferTxResult, err error) {
+	if len(arg.Legs) == 0 {
+		return result, ErrEmptyBatch
+	}
+
+	// 0) validate the legs and compute the net change of every account
+	deltas := make(map[int64]int64)
+	debited := make(map[int64]bool) // source of a leg, even if the batch credits it more than that
+	for i, leg := range arg.Legs {
+		if leg.Amount <= 0 {
+			return result, fmt.Errorf("leg %d: %w: %d", i, ErrInvalidAmount, leg.Amount)
+		}
+		if leg.FromAccountID == leg.ToAccountID {
+			return result, fmt.Errorf("leg %d: %w: %d", i, ErrSameAccount, leg.FromAccountID)
+		}
+		deltas[leg.FromAccountID] -= leg.Amount
+		deltas[leg.ToAccountID] += leg.Amount
+		debited[leg.FromAccountID] = true
+	}
+
+	accounts, err := lockAccounts(ctx, q, sortedAccountIDs(deltas)...)
+	if err != nil {
+		return
+	}
+	for _, id := range sortedAccountIDs(deltas) {
+		account := accounts[id]
+		if err = checkCurrency(account, arg.Currency); err != nil {
+			return
+		}
+		if err = checkCredit(account); err != nil {
+			return
+		}
+		if debited[id] {
+			if err = checkDebit(account); err != nil {
+				return
+			}
+		}
+		if deltas[id] < 0 {
+			if err = checkFunds(ctx, q, account, -deltas[id]); err != nil {
+				return
+			}
+		}
+	}
+
+	// 1) transfer records and account entries, leg by leg
+	for _, leg := range arg.Legs {
+		transfer, err := q.CreateTransfer(ctx, CreateTransferParams{
+			FromAccountID: leg.FromAccountID,
+			ToAccountID:   leg.ToAccountID,
+			Amount:        leg.Amount,
+			Currency:      arg.Currency,
+		})
+		if err != nil {
+			return result, err
+		}
+		fromEntry, err := q.CreateEntry(ctx, CreateEntryParams{
+			AccountID:  leg.FromAccountID,
+			Amount:     -leg.Amount,
+			TransferID: sql.NullInt64{Int64: transfer.ID, Valid: true},
+		})
+		if err != nil {
+			return result, err
+		}
+		toEntry, err := q.CreateEntry(ctx, CreateEntryParams{
+			AccountID:  leg.ToAccountID,
+			Amount:     leg.Amount,
+			TransferID: sql.NullInt64{Int64: transfer.ID, Valid: true},
+		})
+		if err != nil {
+			return result, err
+		}
+		result.Transfers = append(result.Transfers, transfer)
+		result.Entries = append(result.Entries, fromEntry, toEntry)
+	}
+
+	// 2) net balance change per account
+	updated, err := addBalances(ctx, q, deltas)
+	if err != nil {
+		return
+	}
+	for _, id := range sortedAccountIDs(deltas) {
+		result.Accounts = append(result.Accounts, updated[id])
+	}
+
+	// 3) one outbox event per leg, with the balances right after the leg like for any other transfer
+	// (consumers derive the balance before it, balance.low needs it), they add up to the final balances
+	balances := make(map[int64]int64, len(accounts))
+	for id, account := range accounts {
+		balances[id] = account.Balance
+	}
+	for _, transfer := range result.Transfers {
+		balances[transfer.FromAccountID] -= transfer.Amount
+		balances[transfer.ToAccountID] += transfer.Amount
+		err = createTransferEvent(ctx, q, transfer, balances[transfer.FromAccountID], balances[transfer.ToAccountID])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
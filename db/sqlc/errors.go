@@ -0,0 +1,64 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/harshaljanjani/cashflow.net/db/util"
+)
+
+// domain errors returned by the canned transactions, match them with errors.Is
+// (they are usually wrapped with the id of the offending account)
+var (
+	ErrInvalidAmount     = errors.New("amount must be positive")
+	ErrSameAccount       = errors.New("cannot transfer to the same account")
+	ErrAccountNotFound   = errors.New("account not found")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrCurrencyMismatch  = errors.New("currency mismatch")
+	ErrEmptyBatch        = errors.New("batch has no legs")
+
+	ErrTransferNotFound      = errors.New("transfer not found")
+	ErrTransferIsReversal    = errors.New("cannot reverse a reversal")
+	ErrReversalExceedsAmount = errors.New("reversal exceeds the amount not yet reversed")
+	ErrFXTransferReversal    = errors.New("cannot reverse a cross-currency transfer")
+
+	ErrHoldNotFound       = errors.New("hold not found")
+	ErrHoldNotActive      = errors.New("hold is no longer active")
+	ErrHoldExpired        = errors.New("hold has expired")
+	ErrCaptureExceedsHold = errors.New("capture exceeds the held amount")
+
+	ErrAccountFrozen           = errors.New("account is frozen")
+	ErrAccountClosed           = errors.New("account is closed")
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+	ErrReasonRequired          = errors.New("a reason is required to change the status of an account")
+	ErrAccountNotEmpty         = errors.New("account still has a balance")
+	ErrNegativeBalance         = errors.New("account has a negative balance")
+	ErrHoldsPending            = errors.New("account has active holds")
+
+	ErrExchangeRateNotFound = errors.New("no exchange rate in effect for currency pair")
+	ErrInvalidExchangeRate  = errors.New("exchange rate must be a positive decimal")
+
+	ErrIdempotencyKeyConflict = errors.New("idempotency key was already used with different parameters")
+
+	ErrWebhookDeliveryNotFound   = errors.New("webhook delivery not found")
+	ErrWebhookDeliveryNotPending = errors.New("webhook delivery is no longer pending")
+
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrPasswordTooLong    = fmt.Errorf("password is longer than %d bytes", util.MaxPasswordBytes)
+)
+
+// CurrencyMismatchError is returned when an account doesn't hold the currency of a transfer
+// errors.Is(err, ErrCurrencyMismatch) matches it, errors.As gives access to the details
+type CurrencyMismatchError struct {
+	AccountID int64
+	Expected  string // currency of the transfer
+	Actual    string // currency of the account
+}
+
+func (e *CurrencyMismatchError) Error() string {
+	return fmt.Sprintf("%v: account %d holds %q, transfer is in %q", ErrCurrencyMismatch, e.AccountID, e.Actual, e.Expected)
+}
+
+func (e *CurrencyMismatchError) Is(target error) bool {
+	return target == ErrCurrencyMismatch
+}
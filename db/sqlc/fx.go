@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// RoundingMode decides what happens to the fraction of a minor unit left over by a currency conversion
+// amounts are converted minor unit to minor unit (every supported currency has 2 decimals)
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest minor unit, exact halves go to the even neighbour (banker's rounding, the default)
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest minor unit, exact halves go away from zero
+	RoundHalfUp
+	// RoundDown drops the fraction: the destination never receives more than the exact conversion
+	RoundDown
+)
+
+func (mode RoundingMode) String() string {
+	switch mode {
+	case RoundHalfEven:
+		return "half_even"
+	case RoundHalfUp:
+		return "half_up"
+	case RoundDown:
+		return "down"
+	}
+	return fmt.Sprintf("RoundingMode(%d)", int(mode))
+}
+
+// ConvertAmount multiplies amount by rate (a decimal string such as "1.0850000000") and rounds the result to a whole minor unit
+func ConvertAmount(amount int64, rate string, mode RoundingMode) (int64, error) {
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidExchangeRate, rate)
+	}
+	exact := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), r)
+
+	// quo is truncated towards zero, rem carries the sign of amount
+	quo, rem := new(big.Int).QuoRem(exact.Num(), exact.Denom(), new(big.Int))
+	twiceRem := new(big.Int).Abs(rem)
+	twiceRem.Lsh(twiceRem, 1)
+	half := twiceRem.Cmp(exact.Denom()) // <0 below half, 0 exactly half, >0 above half
+
+	roundAway := false
+	switch mode {
+	case RoundHalfEven:
+		roundAway = half > 0 || (half == 0 && quo.Bit(0) == 1)
+	case RoundHalfUp:
+		roundAway = half >= 0
+	case RoundDown:
+	default:
+		return 0, fmt.Errorf("unknown rounding mode %v", mode)
+	}
+	if roundAway {
+		quo.Add(quo, big.NewInt(int64(exact.Sign())))
+	}
+	if !quo.IsInt64() {
+		return 0, fmt.Errorf("%w: %d at rate %s overflows", ErrInvalidAmount, amount, rate)
+	}
+	return quo.Int64(), nil
+}
+
+// input params of the cross-currency transfer transaction
+type FXTransferTxParams struct {
+	FromAccountID int64        `json:"from_account_id"`
+	ToAccountID   int64        `json:"to_account_id"`
+	Amount        int64        `json:"amount"`   // debited from the source, in the currency of the source account
+	Rounding      RoundingMode `json:"rounding"` // how the credited amount is rounded (RoundHalfEven)
+	// optional: a repeated call with the same key returns the original result instead of moving the money again
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// output params of the cross-currency transfer transaction
+type FXTransferTxResult struct {
+	// Transfer.Amount/Currency is what left the source, Transfer.ConvertedAmount/ConvertedCurrency what reached the destination
+	TransferTxResult
+	Rate ExchangeRate `json:"rate"` // the rate that was applied, zero when both accounts hold the same currency
+}
+
+// requestHash identifies the parameters of a cross-currency transfer, see TransferTxParams.requestHash
+func (arg FXTransferTxParams) requestHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("fx_transfer:%d:%d:%d:%d", arg.FromAccountID, arg.ToAccountID, arg.Amount, arg.Rounding)))
+	return hex.EncodeToString(sum[:])
+}
+
+// FXTransferTx moves money between accounts holding different currencies within a single canned transaction
+// 1) debit the source in its own currency (the available balance must cover amount)
+// 2) convert amount with the latest exchange rate of the pair (source currency -> destination currency) that is already effective
+// 3) credit the destination with the rounded result, the transfer row records both amounts and the rate
+// only the direct pair is used (a EUR->USD transfer needs a EUR/USD rate), a missing rate returns ErrExchangeRateNotFound
+// accounts holding the same currency get a regular transfer
+func (store *SQLStore) FXTransferTx(ctx context.Context, arg FXTransferTxParams) (FXTransferTxResult, error) {
+	var result FXTransferTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = runIdempotent(ctx, q, arg.FromAccountID, arg.IdempotencyKey, arg.requestHash(), store.config.idempotencyRetention, func() (FXTransferTxResult, error) {
+			return fxTransferTx(ctx, q, arg)
+		})
+		return err
+	})
+	return result, err
+}
+
+func fxTransferTx(ctx context.Context, q Querier, arg FXTransferTxParams) (result FXTransferTxResult, err error) {
+	// 0) validate the transfer before writing anything
+	if arg.Amount <= 0 {
+		return result, fmt.Errorf("%w: %d", ErrInvalidAmount, arg.Amount)
+	}
+	if arg.FromAccountID == arg.ToAccountID {
+		return result, fmt.Errorf("%w: %d", ErrSameAccount, arg.FromAccountID)
+	}
+	accounts, err := lockAccounts(ctx, q, arg.FromAccountID, arg.ToAccountID)
+	if err != nil {
+		return
+	}
+	from, to := accounts[arg.FromAccountID], accounts[arg.ToAccountID]
+	if err = checkDebit(from); err != nil {
+		return
+	}
+	if err = checkCredit(to); err != nil {
+		return
+	}
+	if err = checkFunds(ctx, q, from, arg.Amount); err != nil {
+		return
+	}
+
+	if from.Currency == to.Currency {
+		transfer, err := q.CreateTransfer(ctx, CreateTransferParams{
+			FromAccountID: from.ID,
+			ToAccountID:   to.ID,
+			Amount:        arg.Amount,
+			Currency:      from.Currency,
+		})
+		if err != nil {
+			return result, err
+		}
+		result.TransferTxResult, err = postTransfer(ctx, q, transfer)
+		return result, err
+	}
+
+	// 1) rate and converted amount
+	result.Rate, err = q.GetEffectiveExchangeRate(ctx, GetEffectiveExchangeRateParams{
+		BaseCurrency:  from.Currency,
+		QuoteCurrency: to.Currency,
+		At:            time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %s/%s", ErrExchangeRateNotFound, from.Currency, to.Currency)
+		}
+		return
+	}
+	converted, err := ConvertAmount(arg.Amount, result.Rate.Rate, arg.Rounding)
+	if err != nil {
+		return
+	}
+	if converted <= 0 {
+		return result, fmt.Errorf("%w: %d %s converts to %d %s", ErrInvalidAmount, arg.Amount, from.Currency, converted, to.Currency)
+	}
+
+	// 2) transfer record with both amounts, entries and balances
+	transfer, err := q.CreateFXTransfer(ctx, CreateFXTransferParams{
+		FromAccountID:     from.ID,
+		ToAccountID:       to.ID,
+		Amount:            arg.Amount,
+		Currency:          from.Currency,
+		ConvertedAmount:   converted,
+		ConvertedCurrency: to.Currency,
+		ExchangeRate:      result.Rate.Rate,
+	})
+	if err != nil {
+		return
+	}
+	result.TransferTxResult, err = postTransfer(ctx, q, transfer)
+	return
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAmount(t *testing.T) {
+	testCases := []struct {
+		name   string
+		amount int64
+		rate   string
+		mode   RoundingMode
+		want   int64
+	}{
+		{"Exact", 1000, "1.0850000000", RoundHalfEven, 1085},
+		{"HalfEvenDown", 25, "0.1", RoundHalfEven, 2},  // 2.5
+		{"HalfEvenUp", 35, "0.1", RoundHalfEven, 4},    // 3.5
+		{"HalfEvenAbove", 26, "0.1", RoundHalfEven, 3}, // 2.6
+		{"HalfUp", 25, "0.1", RoundHalfUp, 3},
+		{"HalfUpBelow", 24, "0.1", RoundHalfUp, 2},
+		{"Down", 29, "0.1", RoundDown, 2},
+		{"ManyDecimals", 333, "0.3333333333", RoundHalfEven, 111}, // 110.9999999889
+		{"ManyDecimalsDown", 333, "0.3333333333", RoundDown, 110},
+		{"Negative", -25, "0.1", RoundHalfUp, -3},
+		{"NegativeDown", -29, "0.1", RoundDown, -2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ConvertAmount(tc.amount, tc.rate, tc.mode)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	_, err := ConvertAmount(100, "0", RoundHalfEven)
+	require.ErrorIs(t, err, ErrInvalidExchangeRate)
+	_, err = ConvertAmount(100, "-1.5", RoundHalfEven)
+	require.ErrorIs(t, err, ErrInvalidExchangeRate)
+	_, err = ConvertAmount(100, "abc", RoundHalfEven)
+	require.ErrorIs(t, err, ErrInvalidExchangeRate)
+	_, err = ConvertAmount(1<<62, "4", RoundHalfEven)
+	require.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = ConvertAmount(100, "1", RoundingMode(42))
+	require.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// statuses of a hold (holds.status)
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusVoided   = "voided"
+	HoldStatusExpired  = "expired"
+)
+
+// DefaultHoldExpiration is used when AuthorizeTxParams.ExpiresIn is not set
+const DefaultHoldExpiration = 7 * 24 * time.Hour
+
+// input params of the authorization transaction
+type AuthorizeTxParams struct {
+	AccountID int64         `json:"account_id"`
+	Amount    int64         `json:"amount"`
+	Currency  string        `json:"currency"`
+	ExpiresIn time.Duration `json:"expires_in"` // the hold stops reserving funds after this long (DefaultHoldExpiration)
+}
+
+// input params of the capture transaction
+type CaptureTxParams struct {
+	HoldID      int64 `json:"hold_id"`
+	ToAccountID int64 `json:"to_account_id"`
+	Amount      int64 `json:"amount"` // up to the held amount, the rest of the hold is released
+}
+
+// output params of the capture transaction
+type CaptureTxResult struct {
+	Hold Hold `json:"hold"`
+	// the transfer from the held account to the destination
+	TransferTxResult
+}
+
+// AuthorizeTx reserves amount on an account: the ledger balance stays the same, the available balance goes down
+// fails with ErrInsufficientFunds when the available balance doesn't cover the amount
+func (store *SQLStore) AuthorizeTx(ctx context.Context, arg AuthorizeTxParams) (Hold, error) {
+	var hold Hold
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		hold, err = authorizeTx(ctx, q, arg)
+		return err
+	})
+	return hold, err
+}
+
+// CaptureTx turns all or part of an active hold into a transfer, the hold is captured even if only part of it was used
+func (store *SQLStore) CaptureTx(ctx context.Context, arg CaptureTxParams) (CaptureTxResult, error) {
+	var result CaptureTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = captureTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+// VoidTx releases an active hold without moving any money
+func (store *SQLStore) VoidTx(ctx context.Context, holdID int64) (Hold, error) {
+	var hold Hold
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		hold, err = voidTx(ctx, q, holdID)
+		return err
+	})
+	return hold, err
+}
+
+func authorizeTx(ctx context.Context, q Querier, arg AuthorizeTxParams) (Hold, error) {
+	if arg.Amount <= 0 {
+		return Hold{}, fmt.Errorf("%w: %d", ErrInvalidAmount, arg.Amount)
+	}
+	expiresIn := arg.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = DefaultHoldExpiration
+	}
+
+	accounts, err := lockAccounts(ctx, q, arg.AccountID)
+	if err != nil {
+		return Hold{}, err
+	}
+	account := accounts[arg.AccountID]
+	if err = checkCurrency(account, arg.Currency); err != nil {
+		return Hold{}, err
+	}
+	if err = checkDebit(account); err != nil {
+		return Hold{}, err
+	}
+	if err = checkFunds(ctx, q, account, arg.Amount); err != nil {
+		return Hold{}, err
+	}
+	return q.CreateHold(ctx, CreateHoldParams{
+		AccountID:   account.ID,
+		Amount:      arg.Amount,
+		Currency:    arg.Currency,
+		ExpiresInMs: expiresIn.Milliseconds(),
+	})
+}
+
+func captureTx(ctx context.Context, q Querier, arg CaptureTxParams) (result CaptureTxResult, err error) {
+	// 1) the hold must still be active
+	hold, err := lockActiveHold(ctx, q, arg.HoldID)
+	if err != nil {
+		return
+	}
+	if arg.Amount <= 0 {
+		return result, fmt.Errorf("%w: %d", ErrInvalidAmount, arg.Amount)
+	}
+	if arg.Amount > hold.Amount {
+		return result, fmt.Errorf("%w: hold %d is for %d, requested %d", ErrCaptureExceedsHold, hold.ID, hold.Amount, arg.Amount)
+	}
+	if arg.ToAccountID == hold.AccountID {
+		return result, fmt.Errorf("%w: %d", ErrSameAccount, hold.AccountID)
+	}
+
+	// 2) the held funds are part of the available balance of this capture
+	accounts, err := lockAccounts(ctx, q, hold.AccountID, arg.ToAccountID)
+	if err != nil {
+		return
+	}
+	for _, id := range []int64{hold.AccountID, arg.ToAccountID} {
+		if err = checkCurrency(accounts[id], hold.Currency); err != nil {
+			return
+		}
+	}
+	if err = checkDebit(accounts[hold.AccountID]); err != nil {
+		return
+	}
+	if err = checkCredit(accounts[arg.ToAccountID]); err != nil {
+		return
+	}
+	if err = checkFunds(ctx, q, accounts[hold.AccountID], arg.Amount-hold.Amount); err != nil {
+		return
+	}
+
+	// 3) transfer, entries, balances and the captured hold
+	transfer, err := q.CreateTransfer(ctx, CreateTransferParams{
+		FromAccountID: hold.AccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		Currency:      hold.Currency,
+	})
+	if err != nil {
+		return
+	}
+	result.TransferTxResult, err = postTransfer(ctx, q, transfer)
+	if err != nil {
+		return
+	}
+	result.Hold, err = q.CaptureHold(ctx, CaptureHoldParams{
+		ID:             hold.ID,
+		CapturedAmount: arg.Amount,
+		TransferID:     transfer.ID,
+	})
+	return
+}
+
+func voidTx(ctx context.Context, q Querier, holdID int64) (Hold, error) {
+	hold, err := lockActiveHold(ctx, q, holdID)
+	if err != nil {
+		return Hold{}, err
+	}
+	return q.UpdateHoldStatus(ctx, UpdateHoldStatusParams{
+		ID:     hold.ID,
+		Status: HoldStatusVoided,
+	})
+}
+
+// lockActiveHold locks a hold FOR NO KEY UPDATE if it can still be captured or voided
+// whether it expired is decided by the query, with the clock of the db like everything else about holds
+// (GetHeldAmount, ExpireHolds): the app and db clocks may drift apart
+func lockActiveHold(ctx context.Context, q Querier, holdID int64) (Hold, error) {
+	hold, err := q.GetActiveHoldForUpdate(ctx, holdID)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return hold, err
+	}
+	// only to tell why
+	hold, err = q.GetHold(ctx, holdID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", ErrHoldNotFound, holdID)
+		}
+		return Hold{}, err
+	}
+	if hold.Status != HoldStatusActive {
+		return Hold{}, fmt.Errorf("%w: hold %d is %s", ErrHoldNotActive, hold.ID, hold.Status)
+	}
+	return Hold{}, fmt.Errorf("%w: hold %d expired at %s", ErrHoldExpired, hold.ID, hold.ExpiresAt.Format(time.RFC3339))
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// the clock of the store (the db's now() for SQLStore) decides when holds expire, whatever the clock of the app says
+func TestMemStoreHoldsUseStoreClock(t *testing.T) {
+	store := NewMemStore()
+	store.clock = func() time.Time { return time.Now().Add(time.Hour) } // the db runs an hour ahead of the app
+	ctx := context.Background()
+	account1 := createRandomStoreAccount(t, store, util.USD)
+	account2 := createRandomStoreAccount(t, store, util.USD)
+
+	hold, err := store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 100, Currency: util.USD, ExpiresIn: time.Minute})
+	require.NoError(t, err)
+	require.WithinDuration(t, store.now().Add(time.Minute), hold.ExpiresAt, time.Second)
+
+	// the hold reserves funds and can be captured, both by the same clock
+	balance, err := store.GetAccountBalance(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance-100, balance.AvailableBalance)
+	_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: 100})
+	require.NoError(t, err)
+
+	// and the other way around: expired for the store, even though the app clock says otherwise
+	store.clock = func() time.Time { return time.Now().Add(-time.Hour) }
+	hold, err = store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 100, Currency: util.USD, ExpiresIn: time.Minute})
+	require.NoError(t, err)
+	store.clock = func() time.Time { return time.Now().Add(-time.Hour + 2*time.Minute) }
+	_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: 100})
+	require.ErrorIs(t, err, ErrHoldExpired)
+	balance, err = store.GetAccountBalance(ctx, account1.ID)
+	require.NoError(t, err)
+	require.Equal(t, balance.LedgerBalance, balance.AvailableBalance)
+}
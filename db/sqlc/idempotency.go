@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultIdempotencyRetention is how long an idempotency key is remembered unless overridden with WithIdempotencyRetention
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+// requestHash identifies the parameters of a transfer, a key can only be replayed with the same hash
+func (arg TransferTxParams) requestHash() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("transfer:%d:%d:%d:%s", arg.FromAccountID, arg.ToAccountID, arg.Amount, arg.Currency)))
+	return hex.EncodeToString(sum[:])
+}
+
+// runIdempotent runs fn at most once per idempotency key of accountID (the source account), the same key picked for
+// another account is a different key; q must be bound to the transaction fn writes with
+// 1) claim the key (a concurrent request with the same key waits until the first one commits or rolls back)
+// 2) key already used: replay the stored result, or fail with ErrIdempotencyKeyConflict if the parameters differ
+// 3) expired keys are reused as if they were new
+// 4) store the result of fn next to the key, in the same transaction as the changes made by fn
+// an empty key runs fn without any bookkeeping
+func runIdempotent[T any](ctx context.Context, q Querier, accountID int64, key, requestHash string, retention time.Duration, fn func() (T, error)) (T, error) {
+	var result T
+	if key == "" {
+		return fn()
+	}
+
+	now := time.Now()
+	_, err := q.CreateIdempotencyKey(ctx, CreateIdempotencyKeyParams{
+		AccountID:   accountID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(retention),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err := q.GetIdempotencyKeyForUpdate(ctx, GetIdempotencyKeyForUpdateParams{AccountID: accountID, Key: key})
+		if err != nil {
+			return result, err
+		}
+		if existing.ExpiresAt.After(now) {
+			if existing.RequestHash != requestHash {
+				return result, fmt.Errorf("%w: %q", ErrIdempotencyKeyConflict, key)
+			}
+			err = json.Unmarshal(existing.Response, &result)
+			return result, err
+		}
+		_, err = q.ResetIdempotencyKey(ctx, ResetIdempotencyKeyParams{
+			AccountID:   accountID,
+			Key:         key,
+			RequestHash: requestHash,
+			ExpiresAt:   now.Add(retention),
+		})
+		if err != nil {
+			return result, err
+		}
+	} else if err != nil {
+		return result, err
+	}
+
+	result, err = fn()
+	if err != nil {
+		return result, err
+	}
+	response, err := json.Marshal(result)
+	if err != nil {
+		return result, err
+	}
+	_, err = q.SetIdempotencyKeyResponse(ctx, SetIdempotencyKeyResponseParams{
+		AccountID: accountID,
+		Key:       key,
+		Response:  response,
+	})
+	return result, err
+}
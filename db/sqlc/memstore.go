@@ -0,0 +1,631 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemStore is a thread-safe in-memory Store for unit tests that don't need a database
+// it mirrors the postgres semantics of SQLStore:
+// 1) ids come from sequences that are never rolled back (like bigserial)
+// 2) missing rows return sql.ErrNoRows, foreign key violations return a *pq.Error with code 23503
+// 3) canned transactions are atomic: they run on a copy of the data that only replaces the original on commit
+type MemStore struct {
+	mu     sync.Mutex // held for single queries and for the whole duration of a canned transaction
+	relay  sync.Mutex // serializes RelayOutboxTx, which can't hold mu while publishing
+	data   *memData
+	seq    memSequences
+	clock  func() time.Time
+	config storeConfig
+}
+
+var _ Store = (*MemStore)(nil)
+
+// NewMemStore creates an empty in-memory store
+func NewMemStore(opts ...StoreOption) *MemStore {
+	return &MemStore{
+		data:   newMemData(),
+		clock:  time.Now,
+		config: newStoreConfig(opts),
+	}
+}
+
+// queries returns a Querier over the committed data, the caller must hold store.mu
+func (store *MemStore) queries() *memQueries {
+	return &memQueries{store: store, data: store.data, now: store.now()}
+}
+
+// postgres stores timestamps with microsecond precision
+func (store *MemStore) now() time.Time {
+	return store.clock().Truncate(time.Microsecond)
+}
+
+// execTx runs fn on a copy of the data and swaps it in when fn succeeds (rollback = drop the copy)
+// like now() in postgres, every row written by the transaction gets the same created_at
+func (store *MemStore) execTx(ctx context.Context, fn func(Querier) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data := store.data.clone()
+	if err := fn(auditQueries{&memQueries{store: store, data: data, now: store.now()}}); err != nil {
+		return err
+	}
+	store.data = data
+	return nil
+}
+
+// DryRun runs fn on a copy of the store that is dropped afterwards, writes are blocked meanwhile
+// ids handed out during the dry run are not reused, like sequences in postgres
+func (store *MemStore) DryRun(ctx context.Context, fn func(Store) error) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dry := &MemStore{
+		data:   store.data.clone(),
+		seq:    store.seq,
+		clock:  store.clock,
+		config: store.config,
+	}
+	err := fn(dry)
+	dry.mu.Lock()
+	store.seq = dry.seq
+	dry.mu.Unlock()
+	return err
+}
+
+func (store *MemStore) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
+	var result TransferTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = runIdempotent(ctx, q, arg.FromAccountID, arg.IdempotencyKey, arg.requestHash(), store.config.idempotencyRetention, func() (TransferTxResult, error) {
+			return transferTx(ctx, q, arg)
+		})
+		return err
+	})
+	return result, err
+}
+
+func (store *MemStore) BatchTransferTx(ctx context.Context, arg BatchTransferTxParams) (BatchTransferTxResult, error) {
+	var result BatchTransferTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = batchTransferTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+func (store *MemStore) ReverseTransferTx(ctx context.Context, transferID int64, amount int64) (ReverseTransferTxResult, error) {
+	var result ReverseTransferTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = reverseTransferTx(ctx, q, transferID, amount)
+		return err
+	})
+	return result, err
+}
+
+func (store *MemStore) AuthorizeTx(ctx context.Context, arg AuthorizeTxParams) (Hold, error) {
+	var hold Hold
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		hold, err = authorizeTx(ctx, q, arg)
+		return err
+	})
+	return hold, err
+}
+
+func (store *MemStore) CaptureTx(ctx context.Context, arg CaptureTxParams) (CaptureTxResult, error) {
+	var result CaptureTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = captureTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+func (store *MemStore) VoidTx(ctx context.Context, holdID int64) (Hold, error) {
+	var hold Hold
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		hold, err = voidTx(ctx, q, holdID)
+		return err
+	})
+	return hold, err
+}
+
+func (store *MemStore) FXTransferTx(ctx context.Context, arg FXTransferTxParams) (FXTransferTxResult, error) {
+	var result FXTransferTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = runIdempotent(ctx, q, arg.FromAccountID, arg.IdempotencyKey, arg.requestHash(), store.config.idempotencyRetention, func() (FXTransferTxResult, error) {
+			return fxTransferTx(ctx, q, arg)
+		})
+		return err
+	})
+	return result, err
+}
+
+func (store *MemStore) AdjustBalanceTx(ctx context.Context, accountID int64) (AdjustBalanceTxResult, error) {
+	var result AdjustBalanceTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = adjustBalanceTx(ctx, q, accountID)
+		return err
+	})
+	return result, err
+}
+
+// RelayOutboxTx runs its queries one by one instead of in a transaction: publishers may use the store (the webhook
+// publisher does), holding the store lock while publishing would deadlock them
+// relay serializes the calls so an event is never published by two relays at the same time, like SKIP LOCKED does
+func (store *MemStore) RelayOutboxTx(ctx context.Context, limit int32, publish func(context.Context, OutboxEvent) error) (RelayOutboxTxResult, error) {
+	store.relay.Lock()
+	defer store.relay.Unlock()
+	if err := ctx.Err(); err != nil {
+		return RelayOutboxTxResult{}, err
+	}
+	result, publishErr, err := relayOutboxTx(ctx, store, limit, store.config.outboxMaxAttempts, publish)
+	if err != nil {
+		return result, err
+	}
+	return result, publishErr
+}
+
+func (store *MemStore) RecordWebhookAttemptTx(ctx context.Context, arg RecordWebhookAttemptTxParams) (RecordWebhookAttemptTxResult, error) {
+	var result RecordWebhookAttemptTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = recordWebhookAttemptTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+func (store *MemStore) GetBalanceAt(ctx context.Context, accountID int64, at time.Time) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return getBalanceAt(ctx, store.queries(), accountID, at)
+}
+
+func (store *MemStore) GetBalancesAt(ctx context.Context, accountIDs []int64, at time.Time) (map[int64]int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return getBalancesAt(ctx, store.queries(), accountIDs, at)
+}
+
+func (store *MemStore) FreezeAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusFrozen, "")
+}
+
+func (store *MemStore) UnfreezeAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusActive, AccountStatusFrozen)
+}
+
+func (store *MemStore) MarkAccountDormantTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusDormant, AccountStatusActive)
+}
+
+func (store *MemStore) ReactivateAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error) {
+	return store.accountStatusTx(ctx, arg, AccountStatusActive, AccountStatusDormant)
+}
+
+func (store *MemStore) CloseAccountTx(ctx context.Context, arg CloseAccountTxParams) (CloseAccountTxResult, error) {
+	var result CloseAccountTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = closeAccountTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+func (store *MemStore) accountStatusTx(ctx context.Context, arg AccountStatusTxParams, to, from string) (AccountStatusTxResult, error) {
+	var result AccountStatusTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = accountStatusTx(ctx, q, arg, to, from)
+		return err
+	})
+	return result, err
+}
+
+// the password is hashed before taking the lock, store is used as the Querier so only CreateUser/GetUser hold it
+func (store *MemStore) RegisterUser(ctx context.Context, arg RegisterUserParams) (User, error) {
+	return registerUser(ctx, store, arg)
+}
+
+func (store *MemStore) AuthenticateUser(ctx context.Context, username, password string) (User, error) {
+	return authenticateUser(ctx, store, username, password)
+}
+
+// single queries: each one runs atomically under the store lock
+// the ledger writes run as a transaction instead, which records them in the audit log (see auditQueries)
+
+func (store *MemStore) AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.AddAccountBalance(ctx, arg) })
+}
+
+func (store *MemStore) CaptureHold(ctx context.Context, arg CaptureHoldParams) (Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Hold, error) { return q.CaptureHold(ctx, arg) })
+}
+
+func (store *MemStore) ClaimOutboxEvents(ctx context.Context, limit int32) ([]OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ClaimOutboxEvents(ctx, limit)
+}
+
+func (store *MemStore) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ClaimWebhookDeliveries(ctx, arg)
+}
+
+func (store *MemStore) CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.CreateAccount(ctx, arg) })
+}
+
+func (store *MemStore) CreateAccountStatusChange(ctx context.Context, arg CreateAccountStatusChangeParams) (AccountStatusChange, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().CreateAccountStatusChange(ctx, arg)
+}
+
+func (store *MemStore) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Entry, error) { return q.CreateEntry(ctx, arg) })
+}
+
+func (store *MemStore) CreateExchangeRate(ctx context.Context, arg CreateExchangeRateParams) (ExchangeRate, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (ExchangeRate, error) { return q.CreateExchangeRate(ctx, arg) })
+}
+
+func (store *MemStore) CreateFXTransfer(ctx context.Context, arg CreateFXTransferParams) (Transfer, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Transfer, error) { return q.CreateFXTransfer(ctx, arg) })
+}
+
+func (store *MemStore) CreateHold(ctx context.Context, arg CreateHoldParams) (Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Hold, error) { return q.CreateHold(ctx, arg) })
+}
+
+func (store *MemStore) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().CreateIdempotencyKey(ctx, arg)
+}
+
+func (store *MemStore) CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().CreateOutboxEvent(ctx, arg)
+}
+
+func (store *MemStore) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Transfer, error) { return q.CreateTransfer(ctx, arg) })
+}
+
+func (store *MemStore) CreateTransferReversal(ctx context.Context, arg CreateTransferReversalParams) (Transfer, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Transfer, error) { return q.CreateTransferReversal(ctx, arg) })
+}
+
+func (store *MemStore) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (User, error) { return q.CreateUser(ctx, arg) })
+}
+
+func (store *MemStore) CreateWebhookAttempt(ctx context.Context, arg CreateWebhookAttemptParams) (WebhookAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().CreateWebhookAttempt(ctx, arg)
+}
+
+func (store *MemStore) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().CreateWebhookDelivery(ctx, arg)
+}
+
+func (store *MemStore) CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().CreateWebhookEndpoint(ctx, arg)
+}
+
+func (store *MemStore) DeleteAccount(ctx context.Context, id int64) error {
+	return store.execTx(ctx, func(q Querier) error { return q.DeleteAccount(ctx, id) })
+}
+
+func (store *MemStore) DeleteExchangeRate(ctx context.Context, id int64) error {
+	return store.execTx(ctx, func(q Querier) error { return q.DeleteExchangeRate(ctx, id) })
+}
+
+func (store *MemStore) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().DeleteExpiredIdempotencyKeys(ctx, now)
+}
+
+func (store *MemStore) DeleteWebhookEndpoint(ctx context.Context, id int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().DeleteWebhookEndpoint(ctx, id)
+}
+
+func (store *MemStore) ExpireHolds(ctx context.Context) ([]Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) ([]Hold, error) { return q.ExpireHolds(ctx) })
+}
+
+func (store *MemStore) GetAccount(ctx context.Context, id int64) (Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetAccount(ctx, id)
+}
+
+func (store *MemStore) GetAccountBalance(ctx context.Context, id int64) (GetAccountBalanceRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetAccountBalance(ctx, id)
+}
+
+func (store *MemStore) GetAccountBalanceAt(ctx context.Context, arg GetAccountBalanceAtParams) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetAccountBalanceAt(ctx, arg)
+}
+
+func (store *MemStore) GetAccountEntriesTotal(ctx context.Context, accountID int64) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetAccountEntriesTotal(ctx, accountID)
+}
+
+func (store *MemStore) GetAccountForUpdate(ctx context.Context, id int64) (Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetAccountForUpdate(ctx, id)
+}
+
+func (store *MemStore) GetEffectiveExchangeRate(ctx context.Context, arg GetEffectiveExchangeRateParams) (ExchangeRate, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetEffectiveExchangeRate(ctx, arg)
+}
+
+func (store *MemStore) GetEntry(ctx context.Context, id int64) (Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetEntry(ctx, id)
+}
+
+func (store *MemStore) GetExchangeRate(ctx context.Context, id int64) (ExchangeRate, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetExchangeRate(ctx, id)
+}
+
+func (store *MemStore) GetHeldAmount(ctx context.Context, accountID int64) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetHeldAmount(ctx, accountID)
+}
+
+func (store *MemStore) GetActiveHoldForUpdate(ctx context.Context, id int64) (Hold, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetActiveHoldForUpdate(ctx, id)
+}
+
+func (store *MemStore) GetHold(ctx context.Context, id int64) (Hold, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetHold(ctx, id)
+}
+
+func (store *MemStore) GetHoldForUpdate(ctx context.Context, id int64) (Hold, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetHoldForUpdate(ctx, id)
+}
+
+func (store *MemStore) GetIdempotencyKeyForUpdate(ctx context.Context, arg GetIdempotencyKeyForUpdateParams) (IdempotencyKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetIdempotencyKeyForUpdate(ctx, arg)
+}
+
+func (store *MemStore) GetOutboxEvent(ctx context.Context, id int64) (OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetOutboxEvent(ctx, id)
+}
+
+func (store *MemStore) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetTransfer(ctx, id)
+}
+
+func (store *MemStore) GetTransferForUpdate(ctx context.Context, id int64) (Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetTransferForUpdate(ctx, id)
+}
+
+func (store *MemStore) GetUser(ctx context.Context, username string) (User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetUser(ctx, username)
+}
+
+func (store *MemStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetUserByEmail(ctx, email)
+}
+
+func (store *MemStore) GetWebhookDelivery(ctx context.Context, id int64) (WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetWebhookDelivery(ctx, id)
+}
+
+func (store *MemStore) GetWebhookDeliveryForUpdate(ctx context.Context, id int64) (WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetWebhookDeliveryForUpdate(ctx, id)
+}
+
+func (store *MemStore) GetWebhookEndpoint(ctx context.Context, id int64) (WebhookEndpoint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().GetWebhookEndpoint(ctx, id)
+}
+
+func (store *MemStore) ListAccountBalancesAt(ctx context.Context, arg ListAccountBalancesAtParams) ([]ListAccountBalancesAtRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListAccountBalancesAt(ctx, arg)
+}
+
+func (store *MemStore) ListAccountEntryTotals(ctx context.Context, arg ListAccountEntryTotalsParams) ([]ListAccountEntryTotalsRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListAccountEntryTotals(ctx, arg)
+}
+
+func (store *MemStore) ListAccountHolds(ctx context.Context, arg ListAccountHoldsParams) ([]Hold, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListAccountHolds(ctx, arg)
+}
+
+func (store *MemStore) ListAccountStatusChanges(ctx context.Context, accountID int64) ([]AccountStatusChange, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListAccountStatusChanges(ctx, accountID)
+}
+
+func (store *MemStore) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListAccounts(ctx, arg)
+}
+
+func (store *MemStore) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AuditLog, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListAuditLogs(ctx, arg)
+}
+
+func (store *MemStore) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListEntries(ctx, arg)
+}
+
+func (store *MemStore) ListExchangeRates(ctx context.Context, arg ListExchangeRatesParams) ([]ExchangeRate, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListExchangeRates(ctx, arg)
+}
+
+func (store *MemStore) ListOutboxEvents(ctx context.Context, arg ListOutboxEventsParams) ([]OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListOutboxEvents(ctx, arg)
+}
+
+func (store *MemStore) ListStatementEntries(ctx context.Context, arg ListStatementEntriesParams) ([]ListStatementEntriesRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListStatementEntries(ctx, arg)
+}
+
+func (store *MemStore) ListTransferReversals(ctx context.Context, transferID int64) ([]Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListTransferReversals(ctx, transferID)
+}
+
+func (store *MemStore) ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListTransfers(ctx, arg)
+}
+
+func (store *MemStore) ListWebhookAttempts(ctx context.Context, deliveryID int64) ([]WebhookAttempt, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListWebhookAttempts(ctx, deliveryID)
+}
+
+func (store *MemStore) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListWebhookDeliveries(ctx, arg)
+}
+
+func (store *MemStore) ListWebhookEndpoints(ctx context.Context, owner string) ([]WebhookEndpoint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListWebhookEndpoints(ctx, owner)
+}
+
+func (store *MemStore) ListWebhookEndpointsForEvent(ctx context.Context, arg ListWebhookEndpointsForEventParams) ([]WebhookEndpoint, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ListWebhookEndpointsForEvent(ctx, arg)
+}
+
+func (store *MemStore) MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) (OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().MarkOutboxEventFailed(ctx, arg)
+}
+
+func (store *MemStore) MarkOutboxEventSent(ctx context.Context, id int64) (OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().MarkOutboxEventSent(ctx, id)
+}
+
+func (store *MemStore) RequeueWebhookDelivery(ctx context.Context, arg RequeueWebhookDeliveryParams) (WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().RequeueWebhookDelivery(ctx, arg)
+}
+
+func (store *MemStore) ResetIdempotencyKey(ctx context.Context, arg ResetIdempotencyKeyParams) (IdempotencyKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().ResetIdempotencyKey(ctx, arg)
+}
+
+func (store *MemStore) SetIdempotencyKeyResponse(ctx context.Context, arg SetIdempotencyKeyResponseParams) (IdempotencyKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().SetIdempotencyKeyResponse(ctx, arg)
+}
+
+func (store *MemStore) UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.UpdateAccount(ctx, arg) })
+}
+
+func (store *MemStore) UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) (Account, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Account, error) { return q.UpdateAccountStatus(ctx, arg) })
+}
+
+func (store *MemStore) UpdateHoldStatus(ctx context.Context, arg UpdateHoldStatusParams) (Hold, error) {
+	return auditTx(ctx, store.execTx, func(q Querier) (Hold, error) { return q.UpdateHoldStatus(ctx, arg) })
+}
+
+func (store *MemStore) UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) (WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.queries().UpdateWebhookDelivery(ctx, arg)
+}
@@ -0,0 +1,1192 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// memData holds the tables of a MemStore
+type memData struct {
+	accounts        map[int64]Account
+	entries         map[int64]Entry
+	transfers       map[int64]Transfer
+	idempotencyKeys map[memIdempotencyKey]IdempotencyKey
+	holds           map[int64]Hold
+	exchangeRates   map[int64]ExchangeRate
+	statusChanges   map[int64]AccountStatusChange
+	users           map[string]User
+	outboxEvents    map[int64]OutboxEvent
+	webhooks        map[int64]WebhookEndpoint
+	deliveries      map[int64]WebhookDelivery
+	attempts        map[int64]WebhookAttempt
+	auditLog        []AuditLog // append-only, in id order
+}
+
+// memIdempotencyKey is the primary key of idempotency_keys
+type memIdempotencyKey struct {
+	accountID int64
+	key       string
+}
+
+func newMemData() *memData {
+	return &memData{
+		accounts:        make(map[int64]Account),
+		entries:         make(map[int64]Entry),
+		transfers:       make(map[int64]Transfer),
+		idempotencyKeys: make(map[memIdempotencyKey]IdempotencyKey),
+		holds:           make(map[int64]Hold),
+		exchangeRates:   make(map[int64]ExchangeRate),
+		statusChanges:   make(map[int64]AccountStatusChange),
+		users:           make(map[string]User),
+		outboxEvents:    make(map[int64]OutboxEvent),
+		webhooks:        make(map[int64]WebhookEndpoint),
+		deliveries:      make(map[int64]WebhookDelivery),
+		attempts:        make(map[int64]WebhookAttempt),
+	}
+}
+
+// clone copies every table (rows are plain values, so a shallow copy of each map is enough)
+func (d *memData) clone() *memData {
+	c := newMemData()
+	for id, account := range d.accounts {
+		c.accounts[id] = account
+	}
+	for id, entry := range d.entries {
+		c.entries[id] = entry
+	}
+	for id, transfer := range d.transfers {
+		c.transfers[id] = transfer
+	}
+	for key, idempotencyKey := range d.idempotencyKeys {
+		c.idempotencyKeys[key] = idempotencyKey
+	}
+	for id, hold := range d.holds {
+		c.holds[id] = hold
+	}
+	for id, rate := range d.exchangeRates {
+		c.exchangeRates[id] = rate
+	}
+	for id, change := range d.statusChanges {
+		c.statusChanges[id] = change
+	}
+	for username, user := range d.users {
+		c.users[username] = user
+	}
+	for id, event := range d.outboxEvents {
+		c.outboxEvents[id] = event
+	}
+	for id, endpoint := range d.webhooks {
+		c.webhooks[id] = endpoint
+	}
+	for id, delivery := range d.deliveries {
+		c.deliveries[id] = delivery
+	}
+	for id, attempt := range d.attempts {
+		c.attempts[id] = attempt
+	}
+	// capped at its length, an append on the copy can't write into the backing array of the original
+	c.auditLog = d.auditLog[:len(d.auditLog):len(d.auditLog)]
+	return c
+}
+
+// memSequences are the bigserial sequences of the tables, they live outside memData so a rollback doesn't reuse ids
+type memSequences struct {
+	accounts      int64
+	entries       int64
+	transfers     int64
+	holds         int64
+	exchangeRates int64
+	statusChanges int64
+	outboxEvents  int64
+	webhooks      int64
+	deliveries    int64
+	attempts      int64
+	auditLog      int64
+}
+
+// numeric formats a decimal string the way postgres returns a numeric(20,scale) column
+func numeric(value string, scale int) (string, error) {
+	r, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return "", &pq.Error{
+			Code:    "22P02",
+			Message: fmt.Sprintf("invalid input syntax for type numeric: %q", value),
+		}
+	}
+	return r.FloatString(scale), nil
+}
+
+// memQueries implements Querier on top of memData, the caller must hold the store lock
+type memQueries struct {
+	store *MemStore
+	data  *memData
+	now   time.Time
+}
+
+var _ Querier = (*memQueries)(nil)
+
+// foreignKeyViolation builds the error postgres returns when a row references a missing account
+func foreignKeyViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       "23503",
+		Message:    fmt.Sprintf("insert or update on table %q violates foreign key constraint %q", table, constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+// uniqueViolation builds the error postgres returns when a row duplicates a unique key
+func uniqueViolation(table, constraint string) error {
+	return &pq.Error{
+		Code:       "23505",
+		Message:    fmt.Sprintf("duplicate key value violates unique constraint %q", constraint),
+		Table:      table,
+		Constraint: constraint,
+	}
+}
+
+func (q *memQueries) AddAccountBalance(ctx context.Context, arg AddAccountBalanceParams) (Account, error) {
+	account, ok := q.data.accounts[arg.ID]
+	if !ok {
+		return Account{}, sql.ErrNoRows
+	}
+	account.Balance += arg.Amount
+	q.data.accounts[account.ID] = account
+	return account, nil
+}
+
+func (q *memQueries) CaptureHold(ctx context.Context, arg CaptureHoldParams) (Hold, error) {
+	hold, ok := q.data.holds[arg.ID]
+	if !ok {
+		return Hold{}, sql.ErrNoRows
+	}
+	if _, ok := q.data.transfers[arg.TransferID]; !ok {
+		return Hold{}, foreignKeyViolation("holds", "holds_transfer_id_fkey")
+	}
+	hold.Status = HoldStatusCaptured
+	hold.CapturedAmount = arg.CapturedAmount
+	hold.TransferID = sql.NullInt64{Int64: arg.TransferID, Valid: true}
+	hold.UpdatedAt = q.now
+	q.data.holds[hold.ID] = hold
+	return hold, nil
+}
+
+// ClaimOutboxEvents doesn't need SKIP LOCKED, a canned transaction holds the store lock until it commits
+func (q *memQueries) ClaimOutboxEvents(ctx context.Context, limit int32) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	for _, event := range q.data.outboxEvents {
+		if !event.SentAt.Valid && !event.FailedAt.Valid {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return paginate(events, limit, 0), nil
+}
+
+// ClaimWebhookDeliveries runs under the store lock, which SKIP LOCKED never has to wait for
+func (q *memQueries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	var due []WebhookDelivery
+	for _, delivery := range q.data.deliveries {
+		if delivery.Status == WebhookDeliveryPending && !delivery.NextAttemptAt.After(arg.Now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	due = paginate(due, arg.Limit, 0)
+	for i := range due {
+		due[i].NextAttemptAt = arg.LeaseUntil
+		q.data.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (q *memQueries) CreateAccount(ctx context.Context, arg CreateAccountParams) (Account, error) {
+	q.store.seq.accounts++
+	if _, ok := q.data.users[arg.Owner]; !ok {
+		return Account{}, foreignKeyViolation("accounts", "accounts_owner_fkey")
+	}
+	for _, existing := range q.data.accounts {
+		if existing.Owner == arg.Owner && existing.Currency == arg.Currency {
+			return Account{}, uniqueViolation("accounts", "owner_currency_key")
+		}
+	}
+	account := Account{
+		ID:              q.store.seq.accounts,
+		Owner:           arg.Owner,
+		Balance:         arg.Balance,
+		Currency:        arg.Currency,
+		CreatedAt:       q.now,
+		Status:          AccountStatusActive,
+		StatusChangedAt: q.now,
+	}
+	q.data.accounts[account.ID] = account
+	return account, nil
+}
+
+func (q *memQueries) CreateAccountStatusChange(ctx context.Context, arg CreateAccountStatusChangeParams) (AccountStatusChange, error) {
+	q.store.seq.statusChanges++
+	if _, ok := q.data.accounts[arg.AccountID]; !ok {
+		return AccountStatusChange{}, foreignKeyViolation("account_status_changes", "account_status_changes_account_id_fkey")
+	}
+	change := AccountStatusChange{
+		ID:         q.store.seq.statusChanges,
+		AccountID:  arg.AccountID,
+		FromStatus: arg.FromStatus,
+		ToStatus:   arg.ToStatus,
+		Reason:     arg.Reason,
+		Actor:      arg.Actor,
+		CreatedAt:  q.now,
+	}
+	q.data.statusChanges[change.ID] = change
+	return change, nil
+}
+
+func (q *memQueries) createAuditLog(ctx context.Context, arg createAuditLogParams) (AuditLog, error) {
+	q.store.seq.auditLog++
+	entry := AuditLog{
+		ID:         q.store.seq.auditLog,
+		Actor:      arg.Actor,
+		Action:     arg.Action,
+		TargetType: arg.TargetType,
+		TargetID:   arg.TargetID,
+		AccountIds: append([]int64{}, arg.AccountIds...),
+		Before:     append(json.RawMessage(nil), arg.Before...),
+		After:      append(json.RawMessage(nil), arg.After...),
+		CreatedAt:  q.now,
+	}
+	q.data.auditLog = append(q.data.auditLog, entry)
+	return entry, nil
+}
+
+func (q *memQueries) CreateEntry(ctx context.Context, arg CreateEntryParams) (Entry, error) {
+	q.store.seq.entries++ // nextval() is evaluated before the foreign key check
+	if _, ok := q.data.accounts[arg.AccountID]; !ok {
+		return Entry{}, foreignKeyViolation("entries", "entries_account_id_fkey")
+	}
+	if _, ok := q.data.transfers[arg.TransferID.Int64]; arg.TransferID.Valid && !ok {
+		return Entry{}, foreignKeyViolation("entries", "entries_transfer_id_fkey")
+	}
+	entry := Entry{
+		ID:         q.store.seq.entries,
+		AccountID:  arg.AccountID,
+		Amount:     arg.Amount,
+		CreatedAt:  q.now,
+		TransferID: arg.TransferID,
+	}
+	q.data.entries[entry.ID] = entry
+	return entry, nil
+}
+
+// the store lock serialises transactions, so a taken key is always committed (or rolled back) by the time it is seen
+func (q *memQueries) CreateExchangeRate(ctx context.Context, arg CreateExchangeRateParams) (ExchangeRate, error) {
+	q.store.seq.exchangeRates++
+	rate, err := numeric(arg.Rate, 10)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	if r, _ := new(big.Rat).SetString(rate); r.Sign() <= 0 {
+		return ExchangeRate{}, &pq.Error{
+			Code:       "23514",
+			Message:    `new row for relation "exchange_rates" violates check constraint "exchange_rates_rate_check"`,
+			Table:      "exchange_rates",
+			Constraint: "exchange_rates_rate_check",
+		}
+	}
+	for _, existing := range q.data.exchangeRates {
+		if existing.BaseCurrency == arg.BaseCurrency && existing.QuoteCurrency == arg.QuoteCurrency && existing.EffectiveAt.Equal(arg.EffectiveAt) {
+			return ExchangeRate{}, uniqueViolation("exchange_rates", "exchange_rates_base_currency_quote_currency_effective_at_idx")
+		}
+	}
+	exchangeRate := ExchangeRate{
+		ID:            q.store.seq.exchangeRates,
+		BaseCurrency:  arg.BaseCurrency,
+		QuoteCurrency: arg.QuoteCurrency,
+		Rate:          rate,
+		EffectiveAt:   arg.EffectiveAt,
+		CreatedAt:     q.now,
+	}
+	q.data.exchangeRates[exchangeRate.ID] = exchangeRate
+	return exchangeRate, nil
+}
+
+func (q *memQueries) CreateFXTransfer(ctx context.Context, arg CreateFXTransferParams) (Transfer, error) {
+	rate, err := numeric(arg.ExchangeRate, 10)
+	if err != nil {
+		return Transfer{}, err
+	}
+	transfer, err := q.CreateTransfer(ctx, CreateTransferParams{
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		Currency:      arg.Currency,
+	})
+	if err != nil {
+		return Transfer{}, err
+	}
+	transfer.ConvertedAmount = sql.NullInt64{Int64: arg.ConvertedAmount, Valid: true}
+	transfer.ConvertedCurrency = sql.NullString{String: arg.ConvertedCurrency, Valid: true}
+	transfer.ExchangeRate = sql.NullString{String: rate, Valid: true}
+	q.data.transfers[transfer.ID] = transfer
+	return transfer, nil
+}
+
+func (q *memQueries) CreateHold(ctx context.Context, arg CreateHoldParams) (Hold, error) {
+	q.store.seq.holds++
+	if _, ok := q.data.accounts[arg.AccountID]; !ok {
+		return Hold{}, foreignKeyViolation("holds", "holds_account_id_fkey")
+	}
+	hold := Hold{
+		ID:        q.store.seq.holds,
+		AccountID: arg.AccountID,
+		Amount:    arg.Amount,
+		Currency:  arg.Currency,
+		Status:    HoldStatusActive,
+		ExpiresAt: q.now.Add(time.Duration(arg.ExpiresInMs) * time.Millisecond),
+		CreatedAt: q.now,
+		UpdatedAt: q.now,
+	}
+	q.data.holds[hold.ID] = hold
+	return hold, nil
+}
+
+func (q *memQueries) CreateIdempotencyKey(ctx context.Context, arg CreateIdempotencyKeyParams) (IdempotencyKey, error) {
+	if _, ok := q.data.idempotencyKeys[memIdempotencyKey{arg.AccountID, arg.Key}]; ok {
+		return IdempotencyKey{}, sql.ErrNoRows // ON CONFLICT DO NOTHING
+	}
+	idempotencyKey := IdempotencyKey{
+		Key:         arg.Key,
+		RequestHash: arg.RequestHash,
+		Response:    json.RawMessage("{}"),
+		CreatedAt:   q.now,
+		ExpiresAt:   arg.ExpiresAt,
+		AccountID:   arg.AccountID,
+	}
+	q.data.idempotencyKeys[memIdempotencyKey{arg.AccountID, arg.Key}] = idempotencyKey
+	return idempotencyKey, nil
+}
+
+func (q *memQueries) CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) (OutboxEvent, error) {
+	q.store.seq.outboxEvents++
+	event := OutboxEvent{
+		ID:            q.store.seq.outboxEvents,
+		EventType:     arg.EventType,
+		AggregateType: arg.AggregateType,
+		AggregateID:   arg.AggregateID,
+		Payload:       append(json.RawMessage(nil), arg.Payload...),
+		CreatedAt:     q.now,
+	}
+	q.data.outboxEvents[event.ID] = event
+	return event, nil
+}
+
+func (q *memQueries) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
+	q.store.seq.transfers++
+	if _, ok := q.data.accounts[arg.FromAccountID]; !ok {
+		return Transfer{}, foreignKeyViolation("transfers", "transfers_from_account_id_fkey")
+	}
+	if _, ok := q.data.accounts[arg.ToAccountID]; !ok {
+		return Transfer{}, foreignKeyViolation("transfers", "transfers_to_account_id_fkey")
+	}
+	transfer := Transfer{
+		ID:            q.store.seq.transfers,
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		CreatedAt:     q.now,
+		Currency:      arg.Currency,
+	}
+	q.data.transfers[transfer.ID] = transfer
+	return transfer, nil
+}
+
+func (q *memQueries) CreateTransferReversal(ctx context.Context, arg CreateTransferReversalParams) (Transfer, error) {
+	if _, ok := q.data.transfers[arg.ReversalOf]; !ok {
+		q.store.seq.transfers++
+		return Transfer{}, foreignKeyViolation("transfers", "transfers_reversal_of_fkey")
+	}
+	transfer, err := q.CreateTransfer(ctx, CreateTransferParams{
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		Currency:      arg.Currency,
+	})
+	if err != nil {
+		return Transfer{}, err
+	}
+	transfer.ReversalOf = sql.NullInt64{Int64: arg.ReversalOf, Valid: true}
+	q.data.transfers[transfer.ID] = transfer
+	return transfer, nil
+}
+
+func (q *memQueries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	if _, ok := q.data.users[arg.Username]; ok {
+		return User{}, uniqueViolation("users", "users_pkey")
+	}
+	for _, existing := range q.data.users {
+		if existing.Email == arg.Email {
+			return User{}, uniqueViolation("users", "users_email_key")
+		}
+	}
+	user := User{
+		Username:       arg.Username,
+		HashedPassword: arg.HashedPassword,
+		FullName:       arg.FullName,
+		Email:          arg.Email,
+		CreatedAt:      q.now,
+	}
+	q.data.users[user.Username] = user
+	return user, nil
+}
+
+func (q *memQueries) CreateWebhookAttempt(ctx context.Context, arg CreateWebhookAttemptParams) (WebhookAttempt, error) {
+	q.store.seq.attempts++
+	if _, ok := q.data.deliveries[arg.DeliveryID]; !ok {
+		return WebhookAttempt{}, foreignKeyViolation("webhook_attempts", "webhook_attempts_delivery_id_fkey")
+	}
+	attempt := WebhookAttempt{
+		ID:         q.store.seq.attempts,
+		DeliveryID: arg.DeliveryID,
+		Attempt:    arg.Attempt,
+		StatusCode: arg.StatusCode,
+		Error:      arg.Error,
+		DurationMs: arg.DurationMs,
+		CreatedAt:  q.now,
+	}
+	q.data.attempts[attempt.ID] = attempt
+	return attempt, nil
+}
+
+// CreateWebhookDelivery returns 0 rows when the delivery already exists (ON CONFLICT DO NOTHING)
+func (q *memQueries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (int64, error) {
+	q.store.seq.deliveries++ // nextval() is evaluated even when the insert turns into a no-op
+	if _, ok := q.data.webhooks[arg.EndpointID]; !ok {
+		return 0, foreignKeyViolation("webhook_deliveries", "webhook_deliveries_endpoint_id_fkey")
+	}
+	if _, ok := q.data.outboxEvents[arg.EventID]; !ok {
+		return 0, foreignKeyViolation("webhook_deliveries", "webhook_deliveries_event_id_fkey")
+	}
+	for _, existing := range q.data.deliveries {
+		if existing.EndpointID == arg.EndpointID && existing.EventID == arg.EventID && existing.EventType == arg.EventType {
+			return 0, nil
+		}
+	}
+	delivery := WebhookDelivery{
+		ID:            q.store.seq.deliveries,
+		EndpointID:    arg.EndpointID,
+		EventID:       arg.EventID,
+		EventType:     arg.EventType,
+		Payload:       append(json.RawMessage(nil), arg.Payload...),
+		Status:        WebhookDeliveryPending,
+		NextAttemptAt: arg.NextAttemptAt,
+		CreatedAt:     q.now,
+	}
+	q.data.deliveries[delivery.ID] = delivery
+	return 1, nil
+}
+
+func (q *memQueries) CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error) {
+	q.store.seq.webhooks++
+	if _, ok := q.data.users[arg.Owner]; !ok {
+		return WebhookEndpoint{}, foreignKeyViolation("webhook_endpoints", "webhook_endpoints_owner_fkey")
+	}
+	endpoint := WebhookEndpoint{
+		ID:                  q.store.seq.webhooks,
+		Owner:               arg.Owner,
+		Url:                 arg.Url,
+		Secret:              arg.Secret,
+		EventTypes:          append([]string{}, arg.EventTypes...),
+		LowBalanceThreshold: arg.LowBalanceThreshold,
+		CreatedAt:           q.now,
+	}
+	q.data.webhooks[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+func (q *memQueries) DeleteAccount(ctx context.Context, id int64) error {
+	for _, entry := range q.data.entries {
+		if entry.AccountID == id {
+			return &pq.Error{
+				Code:       "23503",
+				Message:    `update or delete on table "accounts" violates foreign key constraint "entries_account_id_fkey" on table "entries"`,
+				Table:      "entries",
+				Constraint: "entries_account_id_fkey",
+			}
+		}
+	}
+	for _, transfer := range q.data.transfers {
+		if transfer.FromAccountID == id || transfer.ToAccountID == id {
+			return &pq.Error{
+				Code:       "23503",
+				Message:    `update or delete on table "accounts" violates foreign key constraint "transfers_from_account_id_fkey" on table "transfers"`,
+				Table:      "transfers",
+				Constraint: "transfers_from_account_id_fkey",
+			}
+		}
+	}
+	for _, hold := range q.data.holds {
+		if hold.AccountID == id {
+			return &pq.Error{
+				Code:       "23503",
+				Message:    `update or delete on table "accounts" violates foreign key constraint "holds_account_id_fkey" on table "holds"`,
+				Table:      "holds",
+				Constraint: "holds_account_id_fkey",
+			}
+		}
+	}
+	for _, change := range q.data.statusChanges {
+		if change.AccountID == id {
+			return &pq.Error{
+				Code:       "23503",
+				Message:    `update or delete on table "accounts" violates foreign key constraint "account_status_changes_account_id_fkey" on table "account_status_changes"`,
+				Table:      "account_status_changes",
+				Constraint: "account_status_changes_account_id_fkey",
+			}
+		}
+	}
+	delete(q.data.accounts, id) // deleting a missing row is not an error (:exec)
+	return nil
+}
+
+func (q *memQueries) DeleteExchangeRate(ctx context.Context, id int64) error {
+	delete(q.data.exchangeRates, id)
+	return nil
+}
+
+func (q *memQueries) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	var deleted int64
+	for key, idempotencyKey := range q.data.idempotencyKeys {
+		if !idempotencyKey.ExpiresAt.After(now) {
+			delete(q.data.idempotencyKeys, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteWebhookEndpoint cascades to the deliveries of the endpoint and their attempts
+func (q *memQueries) DeleteWebhookEndpoint(ctx context.Context, id int64) error {
+	for _, delivery := range q.data.deliveries {
+		if delivery.EndpointID != id {
+			continue
+		}
+		for _, attempt := range q.data.attempts {
+			if attempt.DeliveryID == delivery.ID {
+				delete(q.data.attempts, attempt.ID)
+			}
+		}
+		delete(q.data.deliveries, delivery.ID)
+	}
+	delete(q.data.webhooks, id)
+	return nil
+}
+
+func (q *memQueries) ExpireHolds(ctx context.Context) ([]Hold, error) {
+	var expired []Hold
+	for id, hold := range q.data.holds {
+		if hold.Status == HoldStatusActive && !hold.ExpiresAt.After(q.now) {
+			hold.Status = HoldStatusExpired
+			hold.UpdatedAt = q.now
+			q.data.holds[id] = hold
+			expired = append(expired, hold)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ID < expired[j].ID })
+	return expired, nil
+}
+
+func (q *memQueries) GetAccount(ctx context.Context, id int64) (Account, error) {
+	account, ok := q.data.accounts[id]
+	if !ok {
+		return Account{}, sql.ErrNoRows
+	}
+	return account, nil
+}
+
+func (q *memQueries) GetAccountBalance(ctx context.Context, id int64) (GetAccountBalanceRow, error) {
+	account, ok := q.data.accounts[id]
+	if !ok {
+		return GetAccountBalanceRow{}, sql.ErrNoRows
+	}
+	held, _ := q.GetHeldAmount(ctx, id)
+	return GetAccountBalanceRow{
+		ID:               account.ID,
+		Currency:         account.Currency,
+		LedgerBalance:    account.Balance,
+		AvailableBalance: account.Balance - held,
+	}, nil
+}
+
+func (q *memQueries) GetAccountBalanceAt(ctx context.Context, arg GetAccountBalanceAtParams) (int64, error) {
+	account, ok := q.data.accounts[arg.AccountID]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return q.balanceAt(account, arg.At), nil
+}
+
+// balanceAt walks back from the current balance of account to at
+func (q *memQueries) balanceAt(account Account, at time.Time) int64 {
+	if account.CreatedAt.After(at) {
+		return 0
+	}
+	balance := account.Balance
+	for _, entry := range q.data.entries {
+		if entry.AccountID == account.ID && entry.CreatedAt.After(at) {
+			balance -= entry.Amount
+		}
+	}
+	return balance
+}
+
+func (q *memQueries) GetAccountEntriesTotal(ctx context.Context, accountID int64) (int64, error) {
+	var total int64
+	for _, entry := range q.data.entries {
+		if entry.AccountID == accountID {
+			total += entry.Amount
+		}
+	}
+	return total, nil
+}
+
+// the store lock already serialises transactions, so no row lock is needed
+func (q *memQueries) GetAccountForUpdate(ctx context.Context, id int64) (Account, error) {
+	return q.GetAccount(ctx, id)
+}
+
+func (q *memQueries) GetEffectiveExchangeRate(ctx context.Context, arg GetEffectiveExchangeRateParams) (ExchangeRate, error) {
+	var latest *ExchangeRate
+	for _, rate := range q.data.exchangeRates {
+		if rate.BaseCurrency != arg.BaseCurrency || rate.QuoteCurrency != arg.QuoteCurrency || rate.EffectiveAt.After(arg.At) {
+			continue
+		}
+		if latest == nil || rate.EffectiveAt.After(latest.EffectiveAt) {
+			rate := rate
+			latest = &rate
+		}
+	}
+	if latest == nil {
+		return ExchangeRate{}, sql.ErrNoRows
+	}
+	return *latest, nil
+}
+
+func (q *memQueries) GetEntry(ctx context.Context, id int64) (Entry, error) {
+	entry, ok := q.data.entries[id]
+	if !ok {
+		return Entry{}, sql.ErrNoRows
+	}
+	return entry, nil
+}
+
+func (q *memQueries) GetExchangeRate(ctx context.Context, id int64) (ExchangeRate, error) {
+	rate, ok := q.data.exchangeRates[id]
+	if !ok {
+		return ExchangeRate{}, sql.ErrNoRows
+	}
+	return rate, nil
+}
+
+// expired holds stop counting right away, ExpireHolds only tidies their status
+func (q *memQueries) GetHeldAmount(ctx context.Context, accountID int64) (int64, error) {
+	var held int64
+	for _, hold := range q.data.holds {
+		if hold.AccountID == accountID && hold.Status == HoldStatusActive && hold.ExpiresAt.After(q.now) {
+			held += hold.Amount
+		}
+	}
+	return held, nil
+}
+
+func (q *memQueries) GetHold(ctx context.Context, id int64) (Hold, error) {
+	hold, ok := q.data.holds[id]
+	if !ok {
+		return Hold{}, sql.ErrNoRows
+	}
+	return hold, nil
+}
+
+// the store lock already serialises transactions, so no row lock is needed
+func (q *memQueries) GetActiveHoldForUpdate(ctx context.Context, id int64) (Hold, error) {
+	hold, ok := q.data.holds[id]
+	if !ok || hold.Status != HoldStatusActive || !hold.ExpiresAt.After(q.now) {
+		return Hold{}, sql.ErrNoRows
+	}
+	return hold, nil
+}
+
+// the store lock already serialises transactions, so no row lock is needed
+func (q *memQueries) GetHoldForUpdate(ctx context.Context, id int64) (Hold, error) {
+	return q.GetHold(ctx, id)
+}
+
+func (q *memQueries) GetIdempotencyKeyForUpdate(ctx context.Context, arg GetIdempotencyKeyForUpdateParams) (IdempotencyKey, error) {
+	idempotencyKey, ok := q.data.idempotencyKeys[memIdempotencyKey{arg.AccountID, arg.Key}]
+	if !ok {
+		return IdempotencyKey{}, sql.ErrNoRows
+	}
+	return idempotencyKey, nil
+}
+
+func (q *memQueries) GetOutboxEvent(ctx context.Context, id int64) (OutboxEvent, error) {
+	event, ok := q.data.outboxEvents[id]
+	if !ok {
+		return OutboxEvent{}, sql.ErrNoRows
+	}
+	return event, nil
+}
+
+func (q *memQueries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
+	transfer, ok := q.data.transfers[id]
+	if !ok {
+		return Transfer{}, sql.ErrNoRows
+	}
+	return transfer, nil
+}
+
+// the store lock already serialises transactions, so no row lock is needed
+func (q *memQueries) GetTransferForUpdate(ctx context.Context, id int64) (Transfer, error) {
+	return q.GetTransfer(ctx, id)
+}
+
+func (q *memQueries) GetUser(ctx context.Context, username string) (User, error) {
+	user, ok := q.data.users[username]
+	if !ok {
+		return User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (q *memQueries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	for _, user := range q.data.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return User{}, sql.ErrNoRows
+}
+
+func (q *memQueries) GetWebhookDelivery(ctx context.Context, id int64) (WebhookDelivery, error) {
+	delivery, ok := q.data.deliveries[id]
+	if !ok {
+		return WebhookDelivery{}, sql.ErrNoRows
+	}
+	return delivery, nil
+}
+
+// GetWebhookDeliveryForUpdate doesn't need a row lock, a canned transaction holds the store lock until it commits
+func (q *memQueries) GetWebhookDeliveryForUpdate(ctx context.Context, id int64) (WebhookDelivery, error) {
+	return q.GetWebhookDelivery(ctx, id)
+}
+
+func (q *memQueries) GetWebhookEndpoint(ctx context.Context, id int64) (WebhookEndpoint, error) {
+	endpoint, ok := q.data.webhooks[id]
+	if !ok {
+		return WebhookEndpoint{}, sql.ErrNoRows
+	}
+	return endpoint, nil
+}
+
+func (q *memQueries) ListAccountBalancesAt(ctx context.Context, arg ListAccountBalancesAtParams) ([]ListAccountBalancesAtRow, error) {
+	var rows []ListAccountBalancesAtRow
+	for _, account := range q.data.accounts {
+		for _, id := range arg.AccountIds {
+			if account.ID == id {
+				rows = append(rows, ListAccountBalancesAtRow{ID: account.ID, Balance: q.balanceAt(account, arg.At)})
+				break
+			}
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	return rows, nil
+}
+
+func (q *memQueries) ListAccountEntryTotals(ctx context.Context, arg ListAccountEntryTotalsParams) ([]ListAccountEntryTotalsRow, error) {
+	var rows []ListAccountEntryTotalsRow
+	for _, account := range q.data.accounts {
+		if account.ID > arg.AfterID {
+			rows = append(rows, ListAccountEntryTotalsRow{
+				ID:       account.ID,
+				Currency: account.Currency,
+				Balance:  account.Balance,
+			})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	rows = paginate(rows, arg.Limit, 0)
+	for i := range rows {
+		rows[i].EntriesTotal, _ = q.GetAccountEntriesTotal(ctx, rows[i].ID)
+	}
+	return rows, nil
+}
+
+func (q *memQueries) ListAccountHolds(ctx context.Context, arg ListAccountHoldsParams) ([]Hold, error) {
+	var matches []Hold
+	for _, hold := range q.data.holds {
+		if hold.AccountID == arg.AccountID {
+			matches = append(matches, hold)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return paginate(matches, arg.Limit, arg.Offset), nil
+}
+
+func (q *memQueries) ListAccountStatusChanges(ctx context.Context, accountID int64) ([]AccountStatusChange, error) {
+	var changes []AccountStatusChange
+	for _, change := range q.data.statusChanges {
+		if change.AccountID == accountID {
+			changes = append(changes, change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return changes, nil
+}
+
+func (q *memQueries) ListAccounts(ctx context.Context, arg ListAccountsParams) ([]Account, error) {
+	var matches []Account
+	for _, account := range q.data.accounts {
+		if account.Owner == arg.Owner {
+			matches = append(matches, account)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return paginate(matches, arg.Limit, arg.Offset), nil
+}
+
+func (q *memQueries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AuditLog, error) {
+	var matches []AuditLog
+	for _, entry := range q.data.auditLog {
+		if arg.Actor.Valid && entry.Actor != arg.Actor.String {
+			continue
+		}
+		if arg.AccountID.Valid && !containsID(entry.AccountIds, arg.AccountID.Int64) {
+			continue
+		}
+		if arg.FromTime.Valid && !entry.CreatedAt.After(arg.FromTime.Time) || arg.ToTime.Valid && entry.CreatedAt.After(arg.ToTime.Time) {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+	return paginate(matches, arg.Limit, arg.Offset), nil
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *memQueries) ListEntries(ctx context.Context, arg ListEntriesParams) ([]Entry, error) {
+	var matches []Entry
+	for _, entry := range q.data.entries {
+		if arg.AccountID.Valid && entry.AccountID != arg.AccountID.Int64 {
+			continue
+		}
+		if arg.Direction.Valid && !(arg.Direction.String == DirectionIn && entry.Amount > 0 || arg.Direction.String == DirectionOut && entry.Amount < 0) {
+			continue
+		}
+		size := entry.Amount
+		if size < 0 {
+			size = -size
+		}
+		if !inPage(size, entry.CreatedAt, entry.ID, arg.MinAmount, arg.MaxAmount, arg.FromTime, arg.ToTime, arg.CursorCreatedAt, arg.CursorID) {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return keysetLess(matches[i].CreatedAt, matches[i].ID, matches[j].CreatedAt, matches[j].ID)
+	})
+	return paginate(matches, arg.Limit, 0), nil
+}
+
+func (q *memQueries) ListExchangeRates(ctx context.Context, arg ListExchangeRatesParams) ([]ExchangeRate, error) {
+	var matches []ExchangeRate
+	for _, rate := range q.data.exchangeRates {
+		if rate.BaseCurrency == arg.BaseCurrency && rate.QuoteCurrency == arg.QuoteCurrency {
+			matches = append(matches, rate)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].EffectiveAt.After(matches[j].EffectiveAt) })
+	return paginate(matches, arg.Limit, arg.Offset), nil
+}
+
+func (q *memQueries) ListOutboxEvents(ctx context.Context, arg ListOutboxEventsParams) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	for _, event := range q.data.outboxEvents {
+		if event.AggregateType == arg.AggregateType && event.AggregateID == arg.AggregateID {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	return events, nil
+}
+
+func (q *memQueries) ListStatementEntries(ctx context.Context, arg ListStatementEntriesParams) ([]ListStatementEntriesRow, error) {
+	var entries []Entry
+	for _, entry := range q.data.entries {
+		if entry.AccountID == arg.AccountID && entry.CreatedAt.After(arg.FromTime) && !entry.CreatedAt.After(arg.ToTime) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return keysetLess(entries[i].CreatedAt, entries[i].ID, entries[j].CreatedAt, entries[j].ID)
+	})
+	var rows []ListStatementEntriesRow
+	for _, entry := range entries {
+		row := ListStatementEntriesRow{
+			ID:         entry.ID,
+			Amount:     entry.Amount,
+			CreatedAt:  entry.CreatedAt,
+			TransferID: entry.TransferID,
+		}
+		if transfer, ok := q.data.transfers[entry.TransferID.Int64]; entry.TransferID.Valid && ok {
+			row.FromAccountID = sql.NullInt64{Int64: transfer.FromAccountID, Valid: true}
+			row.ToAccountID = sql.NullInt64{Int64: transfer.ToAccountID, Valid: true}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (q *memQueries) ListTransferReversals(ctx context.Context, transferID int64) ([]Transfer, error) {
+	var reversals []Transfer
+	for _, transfer := range q.data.transfers {
+		if transfer.ReversalOf.Valid && transfer.ReversalOf.Int64 == transferID {
+			reversals = append(reversals, transfer)
+		}
+	}
+	sort.Slice(reversals, func(i, j int) bool { return reversals[i].ID < reversals[j].ID })
+	return reversals, nil
+}
+
+// paginate applies LIMIT/OFFSET to rows that are already ordered
+func paginate[T any](rows []T, limit, offset int32) []T {
+	if offset < 0 || limit < 0 || int(offset) >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if int(limit) < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func (q *memQueries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error) {
+	var matches []Transfer
+	for _, transfer := range q.data.transfers {
+		if arg.AccountID.Valid {
+			sent := transfer.FromAccountID == arg.AccountID.Int64 && !(arg.Direction.Valid && arg.Direction.String == DirectionIn)
+			received := transfer.ToAccountID == arg.AccountID.Int64 && !(arg.Direction.Valid && arg.Direction.String == DirectionOut)
+			if !sent && !received {
+				continue
+			}
+		}
+		if !inPage(transfer.Amount, transfer.CreatedAt, transfer.ID, arg.MinAmount, arg.MaxAmount, arg.FromTime, arg.ToTime, arg.CursorCreatedAt, arg.CursorID) {
+			continue
+		}
+		matches = append(matches, transfer)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return keysetLess(matches[i].CreatedAt, matches[i].ID, matches[j].CreatedAt, matches[j].ID)
+	})
+	return paginate(matches, arg.Limit, 0), nil
+}
+
+// inPage applies the amount range, time window and keyset cursor filters shared by ListEntries and ListTransfers
+func inPage(amount int64, createdAt time.Time, id int64, minAmount, maxAmount sql.NullInt64, fromTime, toTime, cursorCreatedAt sql.NullTime, cursorID sql.NullInt64) bool {
+	switch {
+	case minAmount.Valid && amount < minAmount.Int64,
+		maxAmount.Valid && amount > maxAmount.Int64,
+		fromTime.Valid && !createdAt.After(fromTime.Time),
+		toTime.Valid && createdAt.After(toTime.Time):
+		return false
+	case cursorCreatedAt.Valid:
+		// a NULL cursor_id makes the row comparison NULL in postgres
+		return cursorID.Valid && keysetLess(cursorCreatedAt.Time, cursorID.Int64, createdAt, id)
+	}
+	return true
+}
+
+// keysetLess orders rows by (created_at, id)
+func keysetLess(createdAt1 time.Time, id1 int64, createdAt2 time.Time, id2 int64) bool {
+	if !createdAt1.Equal(createdAt2) {
+		return createdAt1.Before(createdAt2)
+	}
+	return id1 < id2
+}
+
+func (q *memQueries) ListWebhookAttempts(ctx context.Context, deliveryID int64) ([]WebhookAttempt, error) {
+	var attempts []WebhookAttempt
+	for _, attempt := range q.data.attempts {
+		if attempt.DeliveryID == deliveryID {
+			attempts = append(attempts, attempt)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool { return attempts[i].ID < attempts[j].ID })
+	return attempts, nil
+}
+
+func (q *memQueries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	var matches []WebhookDelivery
+	for _, delivery := range q.data.deliveries {
+		if delivery.EndpointID == arg.EndpointID && (!arg.Status.Valid || delivery.Status == arg.Status.String) {
+			matches = append(matches, delivery)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return paginate(matches, arg.Limit, arg.Offset), nil
+}
+
+func (q *memQueries) ListWebhookEndpoints(ctx context.Context, owner string) ([]WebhookEndpoint, error) {
+	var matches []WebhookEndpoint
+	for _, endpoint := range q.data.webhooks {
+		if endpoint.Owner == owner {
+			matches = append(matches, endpoint)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return matches, nil
+}
+
+func (q *memQueries) ListWebhookEndpointsForEvent(ctx context.Context, arg ListWebhookEndpointsForEventParams) ([]WebhookEndpoint, error) {
+	var matches []WebhookEndpoint
+	for _, endpoint := range q.data.webhooks {
+		if endpoint.Owner != arg.Owner {
+			continue
+		}
+		for _, eventType := range endpoint.EventTypes {
+			if eventType == arg.EventType {
+				matches = append(matches, endpoint)
+				break
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+	return matches, nil
+}
+
+func (q *memQueries) MarkOutboxEventFailed(ctx context.Context, arg MarkOutboxEventFailedParams) (OutboxEvent, error) {
+	event, ok := q.data.outboxEvents[arg.ID]
+	if !ok {
+		return OutboxEvent{}, sql.ErrNoRows
+	}
+	event.Attempts++
+	event.LastError = arg.LastError
+	if event.Attempts >= arg.MaxAttempts {
+		event.FailedAt = sql.NullTime{Time: q.now, Valid: true}
+	}
+	q.data.outboxEvents[event.ID] = event
+	return event, nil
+}
+
+func (q *memQueries) MarkOutboxEventSent(ctx context.Context, id int64) (OutboxEvent, error) {
+	event, ok := q.data.outboxEvents[id]
+	if !ok {
+		return OutboxEvent{}, sql.ErrNoRows
+	}
+	event.SentAt = sql.NullTime{Time: q.now, Valid: true}
+	event.Attempts++
+	event.LastError = ""
+	q.data.outboxEvents[event.ID] = event
+	return event, nil
+}
+
+func (q *memQueries) RequeueWebhookDelivery(ctx context.Context, arg RequeueWebhookDeliveryParams) (WebhookDelivery, error) {
+	delivery, ok := q.data.deliveries[arg.ID]
+	if !ok || delivery.Status != WebhookDeliveryDead {
+		return WebhookDelivery{}, sql.ErrNoRows
+	}
+	delivery.Status = WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = arg.NextAttemptAt
+	q.data.deliveries[delivery.ID] = delivery
+	return delivery, nil
+}
+
+func (q *memQueries) ResetIdempotencyKey(ctx context.Context, arg ResetIdempotencyKeyParams) (IdempotencyKey, error) {
+	idempotencyKey, ok := q.data.idempotencyKeys[memIdempotencyKey{arg.AccountID, arg.Key}]
+	if !ok {
+		return IdempotencyKey{}, sql.ErrNoRows
+	}
+	idempotencyKey.RequestHash = arg.RequestHash
+	idempotencyKey.Response = json.RawMessage("{}")
+	idempotencyKey.CreatedAt = q.now
+	idempotencyKey.ExpiresAt = arg.ExpiresAt
+	q.data.idempotencyKeys[memIdempotencyKey{arg.AccountID, arg.Key}] = idempotencyKey
+	return idempotencyKey, nil
+}
+
+func (q *memQueries) SetIdempotencyKeyResponse(ctx context.Context, arg SetIdempotencyKeyResponseParams) (IdempotencyKey, error) {
+	idempotencyKey, ok := q.data.idempotencyKeys[memIdempotencyKey{arg.AccountID, arg.Key}]
+	if !ok {
+		return IdempotencyKey{}, sql.ErrNoRows
+	}
+	idempotencyKey.Response = arg.Response
+	q.data.idempotencyKeys[memIdempotencyKey{arg.AccountID, arg.Key}] = idempotencyKey
+	return idempotencyKey, nil
+}
+
+func (q *memQueries) UpdateAccount(ctx context.Context, arg UpdateAccountParams) (Account, error) {
+	account, ok := q.data.accounts[arg.ID]
+	if !ok {
+		return Account{}, sql.ErrNoRows
+	}
+	account.Balance = arg.Balance
+	q.data.accounts[account.ID] = account
+	return account, nil
+}
+
+func (q *memQueries) UpdateAccountStatus(ctx context.Context, arg UpdateAccountStatusParams) (Account, error) {
+	account, ok := q.data.accounts[arg.ID]
+	if !ok {
+		return Account{}, sql.ErrNoRows
+	}
+	account.Status = arg.Status
+	account.StatusReason = arg.StatusReason
+	account.StatusChangedAt = q.now
+	q.data.accounts[account.ID] = account
+	return account, nil
+}
+
+func (q *memQueries) UpdateHoldStatus(ctx context.Context, arg UpdateHoldStatusParams) (Hold, error) {
+	hold, ok := q.data.holds[arg.ID]
+	if !ok {
+		return Hold{}, sql.ErrNoRows
+	}
+	hold.Status = arg.Status
+	hold.UpdatedAt = q.now
+	q.data.holds[hold.ID] = hold
+	return hold, nil
+}
+
+func (q *memQueries) UpdateWebhookDelivery(ctx context.Context, arg UpdateWebhookDeliveryParams) (WebhookDelivery, error) {
+	delivery, ok := q.data.deliveries[arg.ID]
+	if !ok {
+		return WebhookDelivery{}, sql.ErrNoRows
+	}
+	delivery.Status = arg.Status
+	delivery.Attempts = arg.Attempts
+	delivery.NextAttemptAt = arg.NextAttemptAt
+	delivery.LastError = arg.LastError
+	delivery.DeliveredAt = sql.NullTime{}
+	if arg.Status == WebhookDeliveryDelivered {
+		delivery.DeliveredAt = sql.NullTime{Time: q.now, Valid: true}
+	}
+	q.data.deliveries[delivery.ID] = delivery
+	return delivery, nil
+}
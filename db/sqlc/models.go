@@ -5,6 +5,8 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
 )
 
@@ -14,6 +16,40 @@ type Account struct {
 	Balance   int64     `json:"balance"`
 	Currency  string    `json:"currency"`
 	CreatedAt time.Time `json:"created_at"`
+	Status    string    `json:"status"`
+	// Reason given for the last status change
+	StatusReason    string    `json:"status_reason"`
+	StatusChangedAt time.Time `json:"status_changed_at"`
+}
+
+type AccountStatusChange struct {
+	ID         int64  `json:"id"`
+	AccountID  int64  `json:"account_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Reason     string `json:"reason"`
+	// Who requested the change
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AuditLog struct {
+	ID int64 `json:"id"`
+	// Who made the change: a username, an operator, or system for background jobs
+	Actor string `json:"actor"`
+	// create, update, delete, add_balance, set_status, capture, expire
+	Action string `json:"action"`
+	// Table of the changed row: account, transfer, entry, hold, user, exchange_rate
+	TargetType string `json:"target_type"`
+	// Primary key of the changed row as text (usernames aren't numbers), * for bulk changes
+	TargetID string `json:"target_id"`
+	// Accounts the change is about, for filtering
+	AccountIds []int64 `json:"account_ids"`
+	// Row before the change, null for creations
+	Before json.RawMessage `json:"before"`
+	// Row after the change, null for deletions
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
 }
 
 type Entry struct {
@@ -22,6 +58,61 @@ type Entry struct {
 	// Can be negative or positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	// Transfer this entry belongs to, NULL for adjustments
+	TransferID sql.NullInt64 `json:"transfer_id"`
+}
+
+type ExchangeRate struct {
+	ID            int64  `json:"id"`
+	BaseCurrency  string `json:"base_currency"`
+	QuoteCurrency string `json:"quote_currency"`
+	// Units of quote_currency per unit of base_currency
+	Rate        string    `json:"rate"`
+	EffectiveAt time.Time `json:"effective_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type Hold struct {
+	ID        int64 `json:"id"`
+	AccountID int64 `json:"account_id"`
+	// Must be positive
+	Amount         int64  `json:"amount"`
+	Currency       string `json:"currency"`
+	Status         string `json:"status"`
+	CapturedAmount int64  `json:"captured_amount"`
+	// Transfer created by the capture
+	TransferID sql.NullInt64 `json:"transfer_id"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+type IdempotencyKey struct {
+	Key         string          `json:"key"`
+	RequestHash string          `json:"request_hash"`
+	Response    json.RawMessage `json:"response"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ExpiresAt   time.Time       `json:"expires_at"`
+	// Source account of the transfer, keys are unique per account
+	AccountID int64 `json:"account_id"`
+}
+
+type OutboxEvent struct {
+	ID int64 `json:"id"`
+	// transfer.created, transfer.reversed, account.frozen, ...
+	EventType     string `json:"event_type"`
+	AggregateType string `json:"aggregate_type"`
+	// Id of the transfer or account the event is about
+	AggregateID int64           `json:"aggregate_id"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	// NULL until a publisher accepted the event
+	SentAt   sql.NullTime `json:"sent_at"`
+	Attempts int32        `json:"attempts"`
+	// Error of the last failed publish attempt
+	LastError string `json:"last_error"`
+	// Set when the relay gave up on the event, it is not published anymore
+	FailedAt sql.NullTime `json:"failed_at"`
 }
 
 type Transfer struct {
@@ -31,4 +122,65 @@ type Transfer struct {
 	// Must be positive
 	Amount    int64     `json:"amount"`
 	CreatedAt time.Time `json:"created_at"`
+	Currency  string    `json:"currency"`
+	// Transfer reversed by this one, NULL for regular transfers
+	ReversalOf sql.NullInt64 `json:"reversal_of"`
+	// Amount credited to the destination, NULL for same-currency transfers
+	ConvertedAmount   sql.NullInt64  `json:"converted_amount"`
+	ConvertedCurrency sql.NullString `json:"converted_currency"`
+	// Rate applied to amount, NULL for same-currency transfers
+	ExchangeRate sql.NullString `json:"exchange_rate"`
+}
+
+type User struct {
+	Username string `json:"username"`
+	// bcrypt hash, never the password itself
+	HashedPassword    string    `json:"hashed_password"`
+	FullName          string    `json:"full_name"`
+	Email             string    `json:"email"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type WebhookAttempt struct {
+	ID         int64 `json:"id"`
+	DeliveryID int64 `json:"delivery_id"`
+	// Position in the retry schedule, starts over at 1 when a dead delivery is requeued
+	Attempt int32 `json:"attempt"`
+	// HTTP status of the response, 0 when none was received
+	StatusCode int32     `json:"status_code"`
+	Error      string    `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID         int64 `json:"id"`
+	EndpointID int64 `json:"endpoint_id"`
+	EventID    int64 `json:"event_id"`
+	// Differs from the outbox event type for derived events (balance.low)
+	EventType string `json:"event_type"`
+	// Request body, signed as is
+	Payload json.RawMessage `json:"payload"`
+	// pending, delivered or dead (retries exhausted)
+	Status   string `json:"status"`
+	Attempts int32  `json:"attempts"`
+	// Pending deliveries are sent once due, claiming one pushes it back by a lease
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	LastError     string       `json:"last_error"`
+	DeliveredAt   sql.NullTime `json:"delivered_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+type WebhookEndpoint struct {
+	ID    int64  `json:"id"`
+	Owner string `json:"owner"`
+	Url   string `json:"url"`
+	// HMAC-SHA256 key of the signature header
+	Secret string `json:"secret"`
+	// Subscribed event types: transfer.created, account.frozen, balance.low, ...
+	EventTypes []string `json:"event_types"`
+	// balance.low fires when a debit takes an account below this balance
+	LowBalanceThreshold int64     `json:"low_balance_threshold"`
+	CreatedAt           time.Time `json:"created_at"`
 }
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// the ledger writes an outbox event (outbox_events) in the same transaction as every change other services may care about,
+// a relay (see the outbox package) then hands the unsent events to a publisher: an event is published if and only if
+// its transaction committed, at least once, in id order
+
+// types of outbox events (outbox_events.event_type)
+const (
+	EventTransferCreated    = "transfer.created"  // transfers, batch legs, FX transfers, captured holds, close sweeps
+	EventTransferReversed   = "transfer.reversed" // full or partial reversals
+	EventAccountFrozen      = "account.frozen"
+	EventAccountUnfrozen    = "account.unfrozen"
+	EventAccountDormant     = "account.dormant"
+	EventAccountReactivated = "account.reactivated"
+	EventAccountClosed      = "account.closed"
+)
+
+// what outbox_events.aggregate_id refers to (outbox_events.aggregate_type)
+const (
+	AggregateTypeTransfer = "transfer"
+	AggregateTypeAccount  = "account"
+)
+
+// DefaultOutboxRelayLimit is the number of events claimed by RelayOutboxTx when the limit is not set
+const DefaultOutboxRelayLimit = 100
+
+// DefaultOutboxMaxAttempts is how many times an event is offered to the publisher before the relay gives up on it,
+// unless overridden with WithOutboxMaxAttempts
+const DefaultOutboxMaxAttempts = 10
+
+// ErrPublishFailed is returned by RelayOutboxTx when the publisher rejected an event
+var ErrPublishFailed = errors.New("outbox event not published")
+
+// TransferEvent is the payload of the transfer.* events
+// the balances are the ones right after the transfer (after its leg, in a batch), so consumers don't need to read them back
+type TransferEvent struct {
+	TransferID        int64  `json:"transfer_id"`
+	FromAccountID     int64  `json:"from_account_id"`
+	ToAccountID       int64  `json:"to_account_id"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	ConvertedAmount   int64  `json:"converted_amount,omitempty"` // FX transfers only: amount credited, in ConvertedCurrency
+	ConvertedCurrency string `json:"converted_currency,omitempty"`
+	ReversalOf        int64  `json:"reversal_of,omitempty"` // transfer.reversed only
+	FromBalance       int64  `json:"from_balance"`
+	ToBalance         int64  `json:"to_balance"`
+}
+
+// AccountStatusEvent is the payload of the account.* events
+type AccountStatusEvent struct {
+	AccountID  int64  `json:"account_id"`
+	Owner      string `json:"owner"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Reason     string `json:"reason"`
+	Actor      string `json:"actor"`
+	Balance    int64  `json:"balance"`
+	Currency   string `json:"currency"`
+}
+
+// writeOutboxEvent writes an event with payload marshalled to JSON, q must be bound to the transaction of the change
+func writeOutboxEvent(ctx context.Context, q Querier, eventType, aggregateType string, aggregateID int64, payload any) (OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+	return q.CreateOutboxEvent(ctx, CreateOutboxEventParams{
+		EventType:     eventType,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Payload:       data,
+	})
+}
+
+// createTransferEvent records a transfer that was just posted, fromBalance and toBalance are the balances after it
+func createTransferEvent(ctx context.Context, q Querier, transfer Transfer, fromBalance, toBalance int64) error {
+	eventType := EventTransferCreated
+	if transfer.ReversalOf.Valid {
+		eventType = EventTransferReversed
+	}
+	_, err := writeOutboxEvent(ctx, q, eventType, AggregateTypeTransfer, transfer.ID, TransferEvent{
+		TransferID:        transfer.ID,
+		FromAccountID:     transfer.FromAccountID,
+		ToAccountID:       transfer.ToAccountID,
+		Amount:            transfer.Amount,
+		Currency:          transfer.Currency,
+		ConvertedAmount:   transfer.ConvertedAmount.Int64,
+		ConvertedCurrency: transfer.ConvertedCurrency.String,
+		ReversalOf:        transfer.ReversalOf.Int64,
+		FromBalance:       fromBalance,
+		ToBalance:         toBalance,
+	})
+	return err
+}
+
+// accountStatusEventType names the event of a status transition, going back to active depends on where the account comes from
+func accountStatusEventType(from, to string) string {
+	switch to {
+	case AccountStatusFrozen:
+		return EventAccountFrozen
+	case AccountStatusDormant:
+		return EventAccountDormant
+	case AccountStatusClosed:
+		return EventAccountClosed
+	}
+	if from == AccountStatusDormant {
+		return EventAccountReactivated
+	}
+	return EventAccountUnfrozen
+}
+
+// createAccountStatusEvent records a status change, account is the account after the change
+func createAccountStatusEvent(ctx context.Context, q Querier, account Account, change AccountStatusChange) error {
+	_, err := writeOutboxEvent(ctx, q, accountStatusEventType(change.FromStatus, change.ToStatus), AggregateTypeAccount, account.ID, AccountStatusEvent{
+		AccountID:  account.ID,
+		Owner:      account.Owner,
+		FromStatus: change.FromStatus,
+		ToStatus:   change.ToStatus,
+		Reason:     change.Reason,
+		Actor:      change.Actor,
+		Balance:    account.Balance,
+		Currency:   account.Currency,
+	})
+	return err
+}
+
+// RelayOutboxTx claims up to limit unsent events (DefaultOutboxRelayLimit when limit <= 0) and hands them to publish in id order
+// with SQLStore the events are locked FOR UPDATE SKIP LOCKED, so concurrent relays never publish the same event at the same time
+// every published event is marked sent, the first rejected one gets its attempt and error recorded and ends the batch
+// (the events after it stay unsent, so consumers see them in order), the error is then returned wrapped in ErrPublishFailed
+// an event rejected for the last time (see WithOutboxMaxAttempts) is marked failed instead: it is never published again,
+// and the batch carries on without it, so a single poison event can't hold back the outbox forever
+// if the transaction fails after publish accepted an event, the event is published again by the next call (at-least-once delivery)
+
+// output params of the relay transaction
+type RelayOutboxTxResult struct {
+	Sent   []OutboxEvent `json:"sent"`             // published events, in id order, after being marked sent
+	Dead   []OutboxEvent `json:"dead,omitempty"`   // events given up on by this call, in id order, after being marked failed
+	Failed *OutboxEvent  `json:"failed,omitempty"` // the rejected event after recording the attempt
+}
+
+func relayOutboxTx(ctx context.Context, q Querier, limit, maxAttempts int32, publish func(context.Context, OutboxEvent) error) (result RelayOutboxTxResult, publishErr error, err error) {
+	if limit <= 0 {
+		limit = DefaultOutboxRelayLimit
+	}
+	events, err := q.ClaimOutboxEvents(ctx, limit)
+	if err != nil {
+		return
+	}
+	for _, event := range events {
+		if publishErr = publish(ctx, event); publishErr != nil {
+			failed, err := q.MarkOutboxEventFailed(ctx, MarkOutboxEventFailedParams{
+				LastError:   publishErr.Error(),
+				MaxAttempts: maxAttempts,
+				ID:          event.ID,
+			})
+			if err != nil {
+				return result, nil, err
+			}
+			if failed.FailedAt.Valid {
+				result.Dead = append(result.Dead, failed)
+				publishErr = nil
+				continue
+			}
+			result.Failed = &failed
+			return result, fmt.Errorf("%w: %d: %w", ErrPublishFailed, event.ID, publishErr), nil
+		}
+		sent, err := q.MarkOutboxEventSent(ctx, event.ID)
+		if err != nil {
+			return result, nil, err
+		}
+		result.Sent = append(result.Sent, sent)
+	}
+	return
+}
+
+func (store *SQLStore) RelayOutboxTx(ctx context.Context, limit int32, publish func(context.Context, OutboxEvent) error) (RelayOutboxTxResult, error) {
+	var result RelayOutboxTxResult
+	var publishErr error
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, publishErr, err = relayOutboxTx(ctx, q, limit, store.config.outboxMaxAttempts, publish)
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+	return result, publishErr
+}
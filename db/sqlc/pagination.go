@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// values of ListEntriesParams.Direction and ListTransfersParams.Direction
+// entries: in = positive amount, out = negative amount
+// transfers: relative to AccountID, in = received by the account, out = sent by it
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// ErrInvalidCursor is returned by ParseCursor for a token that wasn't made by Cursor.String
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a page of ListEntries or ListTransfers, the next page starts right after it
+// rows are ordered by (created_at, id), so rows inserted while paging never shift a page the way OFFSET does
+// the cursor is only stable for settled history: created_at (the start of the writing transaction) and id are both
+// taken before the row commits, a transfer committing late can land behind a cursor already handed out and is then
+// never listed by the following pages. Clients following the live tail should page up to a time a little in the past
+// (ToTime) or re-read the last pages
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// EntryCursor returns the cursor of the page that ends with entry
+func EntryCursor(entry Entry) Cursor {
+	return Cursor{CreatedAt: entry.CreatedAt, ID: entry.ID}
+}
+
+// TransferCursor returns the cursor of the page that ends with transfer
+func TransferCursor(transfer Transfer) Cursor {
+	return Cursor{CreatedAt: transfer.CreatedAt, ID: transfer.ID}
+}
+
+// String encodes the cursor as an opaque token that can be handed to API clients
+func (c Cursor) String() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token made by Cursor.String
+func ParseCursor(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return Cursor{}, fmt.Errorf("%w: %q", ErrInvalidCursor, token)
+	}
+	var c Cursor
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return Cursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if c.ID, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return Cursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return c, nil
+}
+
+// After returns a copy of arg that lists the entries following the cursor
+func (arg ListEntriesParams) After(c Cursor) ListEntriesParams {
+	arg.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+	arg.CursorID = sql.NullInt64{Int64: c.ID, Valid: true}
+	return arg
+}
+
+// After returns a copy of arg that lists the transfers following the cursor
+func (arg ListTransfersParams) After(c Cursor) ListTransfersParams {
+	arg.CursorCreatedAt = sql.NullTime{Time: c.CreatedAt, Valid: true}
+	arg.CursorID = sql.NullInt64{Int64: c.ID, Valid: true}
+	return arg
+}
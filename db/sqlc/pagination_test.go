@@ -0,0 +1,21 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := Cursor{CreatedAt: time.Date(2023, time.March, 31, 23, 59, 59, 123456000, time.UTC), ID: 42}
+	parsed, err := ParseCursor(cursor.String())
+	require.NoError(t, err)
+	require.True(t, cursor.CreatedAt.Equal(parsed.CreatedAt))
+	require.Equal(t, cursor.ID, parsed.ID)
+
+	for _, token := range []string{"", "not base64!", "bm8gY29tbWE", "eCwx"} { // "no comma", "x,1"
+		_, err := ParseCursor(token)
+		require.ErrorIs(t, err, ErrInvalidCursor, token)
+	}
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// output params of the reversal transaction
+type ReverseTransferTxResult struct {
+	// the compensating transfer: money moves from the original destination back to the original source
+	TransferTxResult
+	OriginalTransfer Transfer `json:"original_transfer"`
+	ReversedAmount   int64    `json:"reversed_amount"`  // total reversed so far, including this reversal
+	RemainingAmount  int64    `json:"remaining_amount"` // amount of the original transfer that can still be reversed
+}
+
+// ReverseTransferTx refunds all (amount == original amount) or part of a transfer within a single canned transaction
+// 1) lock the original transfer so concurrent refunds of the same transfer run one after the other
+// 2) refuse refunds of a reversal (ErrTransferIsReversal), of a cross-currency transfer (ErrFXTransferReversal) and refunds above the amount not yet reversed (ErrReversalExceedsAmount)
+// 3) write a new transfer linked to the original (reversal_of) with compensating entries and update both balances
+// the reversal history of a transfer is available with ListTransferReversals
+func (store *SQLStore) ReverseTransferTx(ctx context.Context, transferID int64, amount int64) (ReverseTransferTxResult, error) {
+	var result ReverseTransferTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = reverseTransferTx(ctx, q, transferID, amount)
+		return err
+	})
+	return result, err
+}
+
+func reverseTransferTx(ctx context.Context, q Querier, transferID int64, amount int64) (result ReverseTransferTxResult, err error) {
+	if amount <= 0 {
+		return result, fmt.Errorf("%w: %d", ErrInvalidAmount, amount)
+	}
+
+	// 1) original transfer and what was already reversed
+	original, err := q.GetTransferForUpdate(ctx, transferID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", ErrTransferNotFound, transferID)
+		}
+		return
+	}
+	if original.ReversalOf.Valid {
+		return result, fmt.Errorf("%w: transfer %d reverses transfer %d", ErrTransferIsReversal, original.ID, original.ReversalOf.Int64)
+	}
+	if original.ConvertedAmount.Valid {
+		// the refund would need a rate of its own, move the money back with FXTransferTx instead
+		return result, fmt.Errorf("%w: %d", ErrFXTransferReversal, original.ID)
+	}
+	reversals, err := q.ListTransferReversals(ctx, original.ID)
+	if err != nil {
+		return
+	}
+	var reversed int64
+	for _, reversal := range reversals {
+		reversed += reversal.Amount
+	}
+	if remaining := original.Amount - reversed; amount > remaining {
+		return result, fmt.Errorf("%w: transfer %d has %d left to reverse, requested %d", ErrReversalExceedsAmount, original.ID, remaining, amount)
+	}
+
+	// 2) the money goes back the way it came
+	accounts, err := lockAccounts(ctx, q, original.FromAccountID, original.ToAccountID)
+	if err != nil {
+		return
+	}
+	if err = checkDebit(accounts[original.ToAccountID]); err != nil {
+		return
+	}
+	if err = checkCredit(accounts[original.FromAccountID]); err != nil {
+		return
+	}
+	if err = checkFunds(ctx, q, accounts[original.ToAccountID], amount); err != nil {
+		return
+	}
+
+	// 3) compensating transfer, entries and balances
+	reversal, err := q.CreateTransferReversal(ctx, CreateTransferReversalParams{
+		FromAccountID: original.ToAccountID,
+		ToAccountID:   original.FromAccountID,
+		Amount:        amount,
+		Currency:      original.Currency,
+		ReversalOf:    original.ID,
+	})
+	if err != nil {
+		return
+	}
+	result.TransferTxResult, err = postTransfer(ctx, q, reversal)
+	if err != nil {
+		return
+	}
+	result.OriginalTransfer = original
+	result.ReversedAmount = reversed + amount
+	result.RemainingAmount = original.Amount - result.ReversedAmount
+	return
+}
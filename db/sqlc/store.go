@@ -3,58 +3,130 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
+	"time"
 )
 
-// store provides all functions to execute db operations (individually) and transactions (combination of individual db operations)
+// Store provides all functions to execute db operations (individually) and transactions (combination of individual db operations)
+// implemented by SQLStore (postgres) and MemStore (in-memory, for unit tests without a database)
+type Store interface {
+	Querier
+	TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	BatchTransferTx(ctx context.Context, arg BatchTransferTxParams) (BatchTransferTxResult, error)
+	ReverseTransferTx(ctx context.Context, transferID int64, amount int64) (ReverseTransferTxResult, error)
+	AuthorizeTx(ctx context.Context, arg AuthorizeTxParams) (Hold, error)
+	CaptureTx(ctx context.Context, arg CaptureTxParams) (CaptureTxResult, error)
+	VoidTx(ctx context.Context, holdID int64) (Hold, error)
+	FXTransferTx(ctx context.Context, arg FXTransferTxParams) (FXTransferTxResult, error)
+	AdjustBalanceTx(ctx context.Context, accountID int64) (AdjustBalanceTxResult, error)
+	GetBalanceAt(ctx context.Context, accountID int64, at time.Time) (int64, error)
+	GetBalancesAt(ctx context.Context, accountIDs []int64, at time.Time) (map[int64]int64, error)
+	FreezeAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error)
+	UnfreezeAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error)
+	MarkAccountDormantTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error)
+	ReactivateAccountTx(ctx context.Context, arg AccountStatusTxParams) (AccountStatusTxResult, error)
+	CloseAccountTx(ctx context.Context, arg CloseAccountTxParams) (CloseAccountTxResult, error)
+	RegisterUser(ctx context.Context, arg RegisterUserParams) (User, error)
+	AuthenticateUser(ctx context.Context, username, password string) (User, error)
+	RelayOutboxTx(ctx context.Context, limit int32, publish func(context.Context, OutboxEvent) error) (RelayOutboxTxResult, error)
+	RecordWebhookAttemptTx(ctx context.Context, arg RecordWebhookAttemptTxParams) (RecordWebhookAttemptTxResult, error)
+	DryRun(ctx context.Context, fn func(Store) error) error
+}
+
+// SQLStore provides all functions to execute SQL queries and transactions
 // extend the functionality of Queries struct (only supports single transaction)
-type Store struct{
-	// embed/composition instead of inheritance
-	*Queries
-	db *sql.DB
+type SQLStore struct {
+	// embed/composition instead of inheritance, the field is unexported so the unaudited queries don't leak out
+	*sqlQueries
+	db     *sql.DB
+	tx     *sql.Tx // set on the store handed out by DryRun, every transaction then runs inside it
+	config storeConfig
 }
 
-// creates a new store
-func NewStore(db *sql.DB) *Store{
-	return &Store{
-		db:db,
-		Queries: New(db), 
+// sqlQueries names the embedded Queries of SQLStore
+type sqlQueries = Queries
+
+// storeConfig holds the settings shared by every Store implementation
+type storeConfig struct {
+	txOptions            TxOptions     // isolation level and retry policy used by the canned transactions (TransferTx, ...), ignored by MemStore
+	idempotencyRetention time.Duration // how long an idempotency key is remembered
+	outboxMaxAttempts    int32         // publish attempts of an outbox event before the relay gives up on it
+}
+
+func newStoreConfig(opts []StoreOption) storeConfig {
+	config := storeConfig{
+		txOptions:            TxOptions{Retry: DefaultRetryPolicy},
+		idempotencyRetention: DefaultIdempotencyRetention,
+		outboxMaxAttempts:    DefaultOutboxMaxAttempts,
 	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
 }
 
-// implemented the following
-// executes a function within the database transaction (TODO: implement rollback)
-// 1) takes a context and a callback function as an input
-// 2) start new db transaction
-// 3) create a new Queries object with that transaction
-// 4) call the callback function with the created queries
-// 5) commit or rollback based on error returned
+// StoreOption customises a store created with NewStore or NewMemStore
+type StoreOption func(*storeConfig)
 
-// don't want external package to call it directly : execTx
-func (store *Store) execTx(ctx context.Context, fn func(*Queries) error) error{
-	tx, err := store.db.BeginTx(ctx, nil) // set custom isolation level with &sql.TxOptions{}
-	if err != nil {
-		return err
+// WithTxOptions sets the isolation level and retry policy used by the store's canned transactions
+func WithTxOptions(opts TxOptions) StoreOption {
+	return func(config *storeConfig) {
+		config.txOptions = opts
 	}
-	q := New(tx)
-	err = fn(q)
-	if err != nil{
-		if rbErr := tx.Rollback(); rbErr != nil{
-			return fmt.Errorf("tx err %v, rb err: %v", err, rbErr)
-		}
-		return err
-	}	
-	return tx.Commit()
+}
+
+// WithIdempotencyRetention sets how long idempotency keys are remembered (DefaultIdempotencyRetention)
+func WithIdempotencyRetention(retention time.Duration) StoreOption {
+	return func(config *storeConfig) {
+		config.idempotencyRetention = retention
+	}
+}
+
+// WithOutboxMaxAttempts sets how many times RelayOutboxTx tries to publish an event before giving up on it (DefaultOutboxMaxAttempts)
+func WithOutboxMaxAttempts(maxAttempts int32) StoreOption {
+	return func(config *storeConfig) {
+		config.outboxMaxAttempts = maxAttempts
+	}
+}
+
+// creates a new store
+// canned transactions run at the server default isolation level and retry on serialization failures/deadlocks (DefaultRetryPolicy)
+func NewStore(db *sql.DB, opts ...StoreOption) Store {
+	return NewSQLStore(db, opts...)
+}
+
+// NewSQLStore is NewStore returning the concrete type, for callers that need ExecTx
+func NewSQLStore(db *sql.DB, opts ...StoreOption) *SQLStore {
+	return &SQLStore{
+		db:         db,
+		sqlQueries: New(db),
+		config:     newStoreConfig(opts),
+	}
+}
+
+// don't want external package to call it directly : execTx
+// executes a function within a database transaction using the store's TxOptions (see ExecTx)
+// the ledger writes of fn are recorded in the audit log (see auditQueries)
+func (store *SQLStore) execTx(ctx context.Context, fn func(Querier) error) error {
+	_, err := store.ExecTx(ctx, store.config.txOptions, fn)
+	return err
 }
 
 // money transfer function: TransferTx performs a money transfer from one account to another
 // It creates a transfer record, add account entries, and update account's balance within a single canned transaction
+// rejected transfers (ErrInvalidAmount, ErrSameAccount, ErrAccountNotFound, ErrCurrencyMismatch, ErrAccountFrozen, ErrAccountClosed, ErrInsufficientFunds) don't write anything
+// reusing an IdempotencyKey with different parameters returns ErrIdempotencyKeyConflict, keys are scoped to FromAccountID
 
 // input params of the transfer transaction
 type TransferTxParams struct {
-	FromAccountID int64 `json:"from_account_id"`
-	ToAccountID   int64 `json:"to_account_id"`
-	Amount        int64 `json:"amount"`
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"` // both accounts must hold this currency
+	// optional: a repeated call with the same key returns the original result instead of moving the money again
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 // output params of the transfer transaction
@@ -66,104 +138,179 @@ type TransferTxResult struct {
 	ToEntry     Entry    `json:"to_entry"`
 }
 
-// unused variable: var txKey = struct{}{}
-
-func (store *Store) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error){
+func (store *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
 	var result TransferTxResult
-
-	err := store.execTx(ctx, func(q *Queries) error{
+	err := store.execTx(ctx, func(q Querier) error {
 		// accessing variable result from outside the scope of this function (callback becomes closure (no generics in Go))
-		
-		// 1) create transfer record
 		var err error
-
-		// txName := ctx.Value(txKey)
-		// write locks
-		// logs: fmt.Println(txName, "create transfer")
-		result.Transfer, err = q.CreateTransfer(ctx, TransferTxParams{
-			FromAccountID:arg.FromAccountID,
-			ToAccountID:arg.ToAccountID,
-			Amount:arg.Amount,
+		result, err = runIdempotent(ctx, q, arg.FromAccountID, arg.IdempotencyKey, arg.requestHash(), store.config.idempotencyRetention, func() (TransferTxResult, error) {
+			return transferTx(ctx, q, arg)
 		})
-		if err != nil{
-			return err
-		}
-
-		// 2) account entries creation
-		// logs: fmt.Println(txName, "create entry 1")
-		result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.FromAccountID,
-			Amount: -arg.Amount, // money is moving out
-		})
-		if err != nil{
-			return err
-		}
+		return err
+	})
+	return result, err
+}
 
-		// logs: fmt.Println(txName, "create entry 2")
-		result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
-			AccountID: arg.ToAccountID,
-			Amount: arg.Amount, // money is moving in
-		})
-		if err != nil{
-			return err
+// transferTx is the body of TransferTx, shared by every Store implementation
+// q must be bound to an open transaction
+func transferTx(ctx context.Context, q Querier, arg TransferTxParams) (result TransferTxResult, err error) {
+	// 0) validate the transfer before writing anything
+	if arg.Amount <= 0 {
+		return result, fmt.Errorf("%w: %d", ErrInvalidAmount, arg.Amount)
+	}
+	if arg.FromAccountID == arg.ToAccountID {
+		return result, fmt.Errorf("%w: %d", ErrSameAccount, arg.FromAccountID)
+	}
+	// lock both accounts (smaller AccountID first) so the balance can't change between the check and the update
+	accounts, err := lockAccounts(ctx, q, arg.FromAccountID, arg.ToAccountID)
+	if err != nil {
+		return
+	}
+	for _, id := range []int64{arg.FromAccountID, arg.ToAccountID} {
+		if err = checkCurrency(accounts[id], arg.Currency); err != nil {
+			return
 		}
+	}
+	if err = checkDebit(accounts[arg.FromAccountID]); err != nil {
+		return
+	}
+	if err = checkCredit(accounts[arg.ToAccountID]); err != nil {
+		return
+	}
+	if err = checkFunds(ctx, q, accounts[arg.FromAccountID], arg.Amount); err != nil {
+		return
+	}
 
-		// old: 3) get account => update balance
-		// moving money out of the fromAccount
-		// logs: fmt.Println(txName, "get account 1 for update")
-		// account1, err := q.GetAccountForUpdate(ctx, arg.FromAccountID)
-		// if err != nil{
-		// 	return err
-		// }
-
-		// new: better way of implementing the UpdateBalance operation with a single handler
-		// logs: fmt.Println(txName, "update balance of account 1")
-		// added deadlock avoidance mechanism:
-		// always update account with smaller AccountID first
-		if(arg.FromAccountID < arg.ToAccountID){
-			// old: moving money into the toAccount
-			// fmt.Println(txName, "get account 2 for update")
-			// account2, err := q.GetAccountForUpdate(ctx, arg.ToAccountID)
-			// if err != nil{
-			// 	return err
-			// }
-			// new: better way of implementing the UpdateBalance operation with a single handler
-			// fmt.Println(txName, "update balance of account 2")
-			result.FromAccount, result.ToAccount, err = addMoney(ctx,q,arg.FromAccountID,-arg.Amount,arg.ToAccountID,arg.Amount)
-			if err != nil{
-				return err
-			}
-			
-		} else {
-			// update ToAccount first (arg.ToAccountID < arg.FromAccountID)
-			result.ToAccount, result.FromAccount, err = addMoney(ctx,q,arg.ToAccountID,arg.Amount,arg.FromAccountID,-arg.Amount)
-			if err != nil{
-				return err
-			}
-		}
-		return nil
+	// 1) create transfer record
+	// write locks
+	result.Transfer, err = q.CreateTransfer(ctx, CreateTransferParams{
+		FromAccountID: arg.FromAccountID,
+		ToAccountID:   arg.ToAccountID,
+		Amount:        arg.Amount,
+		Currency:      arg.Currency,
 	})
-	return result, err
+	if err != nil {
+		return
+	}
+
+	// 2) + 3) entries and balances
+	return postTransfer(ctx, q, result.Transfer)
 }
 
-func addMoney(
-	ctx context.Context,
-	q *Queries,
-	accountID1 int64,
-	amount1 int64,
-	accountID2 int64,
-	amount2 int64,
-) (account1 Account, account2 Account, err error){
-	account1, err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
-		ID: accountID1,
-		Amount: amount1,
+// postTransfer writes the two entries of a transfer that was just created, updates both balances and records the outbox event
+// the accounts must already be locked and validated by the caller
+func postTransfer(ctx context.Context, q Querier, transfer Transfer) (result TransferTxResult, err error) {
+	result.Transfer = transfer
+
+	// 2) account entries creation
+	result.FromEntry, err = q.CreateEntry(ctx, CreateEntryParams{
+		AccountID:  transfer.FromAccountID,
+		Amount:     -transfer.Amount, // money is moving out
+		TransferID: sql.NullInt64{Int64: transfer.ID, Valid: true},
 	})
-	if err != nil{
-		return // return account1, account2, err
+	if err != nil {
+		return
 	}
-	account2, err = q.AddAccountBalance(ctx, AddAccountBalanceParams{
-		ID: accountID2,
-		Amount: amount2,
+
+	// cross-currency transfers credit the converted amount
+	credit := transfer.Amount
+	if transfer.ConvertedAmount.Valid {
+		credit = transfer.ConvertedAmount.Int64
+	}
+	result.ToEntry, err = q.CreateEntry(ctx, CreateEntryParams{
+		AccountID:  transfer.ToAccountID,
+		Amount:     credit, // money is moving in
+		TransferID: sql.NullInt64{Int64: transfer.ID, Valid: true},
+	})
+	if err != nil {
+		return
+	}
+
+	// 3) update balances with a single handler (AddAccountBalance) instead of get account for update => update balance
+	// added deadlock avoidance mechanism: always update account with smaller AccountID first
+	accounts, err := addBalances(ctx, q, map[int64]int64{
+		transfer.FromAccountID: -transfer.Amount,
+		transfer.ToAccountID:   credit,
 	})
-	return // return account1, account2, err
-}
\ No newline at end of file
+	if err != nil {
+		return
+	}
+	result.FromAccount = accounts[transfer.FromAccountID]
+	result.ToAccount = accounts[transfer.ToAccountID]
+
+	// 4) outbox event, published by the relay once the transaction committed
+	err = createTransferEvent(ctx, q, transfer, result.FromAccount.Balance, result.ToAccount.Balance)
+	return
+}
+
+// lockAccounts reads the given accounts FOR NO KEY UPDATE in ascending id order (deadlock avoidance)
+// a missing account returns ErrAccountNotFound
+func lockAccounts(ctx context.Context, q Querier, accountIDs ...int64) (map[int64]Account, error) {
+	ids := append([]int64(nil), accountIDs...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	accounts := make(map[int64]Account, len(ids))
+	for _, id := range ids {
+		if _, ok := accounts[id]; ok {
+			continue
+		}
+		account, err := q.GetAccountForUpdate(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%w: %d", ErrAccountNotFound, id)
+			}
+			return nil, err
+		}
+		accounts[id] = account
+	}
+	return accounts, nil
+}
+
+// checkFunds returns ErrInsufficientFunds unless the available balance of the (locked) account covers amount
+// the available balance is the ledger balance minus the active holds of the account
+func checkFunds(ctx context.Context, q Querier, account Account, amount int64) error {
+	held, err := q.GetHeldAmount(ctx, account.ID)
+	if err != nil {
+		return err
+	}
+	if available := account.Balance - held; available < amount {
+		return fmt.Errorf("%w: account %d has %d available, needs %d", ErrInsufficientFunds, account.ID, available, amount)
+	}
+	return nil
+}
+
+// checkCurrency returns a *CurrencyMismatchError if the account doesn't hold the given currency
+func checkCurrency(account Account, currency string) error {
+	if account.Currency != currency {
+		return &CurrencyMismatchError{AccountID: account.ID, Expected: currency, Actual: account.Currency}
+	}
+	return nil
+}
+
+// addBalances adds each delta to the balance of its account, in ascending account id order so that
+// concurrent transactions touching overlapping accounts always lock them in the same order (no deadlock)
+// returns the updated accounts
+func addBalances(ctx context.Context, q Querier, deltas map[int64]int64) (map[int64]Account, error) {
+	accounts := make(map[int64]Account, len(deltas))
+	for _, id := range sortedAccountIDs(deltas) {
+		account, err := q.AddAccountBalance(ctx, AddAccountBalanceParams{
+			ID:     id,
+			Amount: deltas[id],
+		})
+		if err != nil {
+			return nil, err
+		}
+		accounts[id] = account
+	}
+	return accounts, nil
+}
+
+// sortedAccountIDs returns the keys of m in ascending order
+func sortedAccountIDs[V any](m map[int64]V) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
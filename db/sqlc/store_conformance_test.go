@@ -0,0 +1,1947 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// the same suite runs against every Store implementation, so the in-memory fake can't drift from postgres
+
+func TestSQLStoreConformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T, opts ...StoreOption) Store {
+		return NewStore(testDB, opts...)
+	})
+}
+
+func TestMemStoreConformance(t *testing.T) {
+	testStoreConformance(t, func(t *testing.T, opts ...StoreOption) Store {
+		return NewMemStore(opts...)
+	})
+}
+
+func testStoreConformance(t *testing.T, newStore func(t *testing.T, opts ...StoreOption) Store) {
+	t.Run("CreateGetAccount", func(t *testing.T) {
+		store := newStore(t)
+		account1 := createRandomStoreAccount(t, store, util.RandomCurrency())
+		account2, err := store.GetAccount(context.Background(), account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1, account2)
+	})
+
+	t.Run("AccountIDsAreSequential", func(t *testing.T) {
+		store := newStore(t)
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		require.Greater(t, account2.ID, account1.ID)
+	})
+
+	t.Run("MissingRowsReturnErrNoRows", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		_, err := store.GetAccount(ctx, -1)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.GetAccountForUpdate(ctx, -1)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.UpdateAccount(ctx, UpdateAccountParams{ID: -1, Balance: 10})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.AddAccountBalance(ctx, AddAccountBalanceParams{ID: -1, Amount: 10})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.GetEntry(ctx, -1)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.GetTransfer(ctx, -1)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.GetHold(ctx, -1)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		require.NoError(t, store.DeleteAccount(ctx, -1))
+	})
+
+	t.Run("UpdateAndAddBalance", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account := createRandomStoreAccount(t, store, util.RandomCurrency())
+
+		updated, err := store.UpdateAccount(ctx, UpdateAccountParams{ID: account.ID, Balance: 100})
+		require.NoError(t, err)
+		require.Equal(t, int64(100), updated.Balance)
+
+		updated, err = store.AddAccountBalance(ctx, AddAccountBalanceParams{ID: account.ID, Amount: -30})
+		require.NoError(t, err)
+		require.Equal(t, int64(70), updated.Balance)
+		require.Equal(t, account.Owner, updated.Owner)
+	})
+
+	t.Run("ListAccounts", func(t *testing.T) {
+		store := newStore(t)
+		owner := createRandomStoreUser(t, store).Username
+		var created []Account
+		// one account per currency and owner
+		for _, currency := range []string{util.USD, util.EUR, util.CAD} {
+			account, err := store.CreateAccount(context.Background(), CreateAccountParams{
+				Owner:    owner,
+				Balance:  util.RandomMoney(),
+				Currency: currency,
+			})
+			require.NoError(t, err)
+			created = append(created, account)
+		}
+
+		accounts, err := store.ListAccounts(context.Background(), ListAccountsParams{Owner: owner, Limit: 4, Offset: 1})
+		require.NoError(t, err)
+		require.Equal(t, created[1:], accounts)
+	})
+
+	t.Run("DeleteAccount", func(t *testing.T) {
+		store := newStore(t)
+		account := createRandomStoreAccount(t, store, util.RandomCurrency())
+		require.NoError(t, store.DeleteAccount(context.Background(), account.ID))
+		_, err := store.GetAccount(context.Background(), account.ID)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("DeleteAccountWithEntriesViolatesForeignKey", func(t *testing.T) {
+		store := newStore(t)
+		account := createRandomStoreAccount(t, store, util.RandomCurrency())
+		_, err := store.CreateEntry(context.Background(), CreateEntryParams{AccountID: account.ID, Amount: 10})
+		require.NoError(t, err)
+
+		err = store.DeleteAccount(context.Background(), account.ID)
+		requireForeignKeyViolation(t, err)
+	})
+
+	t.Run("TransferTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+
+		result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance-10, result.FromAccount.Balance)
+		require.Equal(t, account2.Balance+10, result.ToAccount.Balance)
+		require.Equal(t, int64(-10), result.FromEntry.Amount)
+		require.Equal(t, int64(10), result.ToEntry.Amount)
+		require.Equal(t, util.USD, result.Transfer.Currency)
+
+		transfer, err := store.GetTransfer(ctx, result.Transfer.ID)
+		require.NoError(t, err)
+		require.Equal(t, result.Transfer, transfer)
+		entry, err := store.GetEntry(ctx, result.FromEntry.ID)
+		require.NoError(t, err)
+		require.Equal(t, result.FromEntry, entry)
+	})
+
+	t.Run("ConcurrentTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+
+		n := 10
+		errs := make(chan error)
+		for i := 0; i < n; i++ {
+			fromAccountID, toAccountID := account1.ID, account2.ID
+			if i%2 == 1 {
+				fromAccountID, toAccountID = account2.ID, account1.ID
+			}
+			go func() {
+				_, err := store.TransferTx(context.Background(), TransferTxParams{FromAccountID: fromAccountID, ToAccountID: toAccountID, Amount: 10, Currency: util.USD})
+				errs <- err
+			}()
+		}
+		for i := 0; i < n; i++ {
+			require.NoError(t, <-errs)
+		}
+
+		updated1, err := store.GetAccount(context.Background(), account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, updated1.Balance)
+	})
+
+	t.Run("FailedTransferTxRollsBack", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		account3 := createRandomStoreAccount(t, store, util.EUR)
+
+		testCases := []struct {
+			name    string
+			arg     TransferTxParams
+			wantErr error
+		}{
+			{"ZeroAmount", TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 0, Currency: util.USD}, ErrInvalidAmount},
+			{"NegativeAmount", TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: -10, Currency: util.USD}, ErrInvalidAmount},
+			{"SameAccount", TransferTxParams{FromAccountID: account1.ID, ToAccountID: account1.ID, Amount: 10, Currency: util.USD}, ErrSameAccount},
+			{"MissingToAccount", TransferTxParams{FromAccountID: account1.ID, ToAccountID: -1, Amount: 10, Currency: util.USD}, ErrAccountNotFound},
+			{"MissingFromAccount", TransferTxParams{FromAccountID: -1, ToAccountID: account2.ID, Amount: 10, Currency: util.USD}, ErrAccountNotFound},
+			{"MismatchedFromCurrency", TransferTxParams{FromAccountID: account3.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD}, ErrCurrencyMismatch},
+			{"MismatchedToCurrency", TransferTxParams{FromAccountID: account1.ID, ToAccountID: account3.ID, Amount: 10, Currency: util.USD}, ErrCurrencyMismatch},
+			{"MismatchedTransferCurrency", TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.CAD}, ErrCurrencyMismatch},
+			{"MissingCurrency", TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10}, ErrCurrencyMismatch},
+			{"InsufficientFunds", TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance + 1, Currency: util.USD}, ErrInsufficientFunds},
+		}
+		for _, tc := range testCases {
+			_, err := store.TransferTx(ctx, tc.arg)
+			require.ErrorIs(t, err, tc.wantErr, tc.name)
+		}
+
+		for _, account := range []Account{account1, account2, account3} {
+			unchanged, err := store.GetAccount(ctx, account.ID)
+			require.NoError(t, err)
+			require.Equal(t, account.Balance, unchanged.Balance)
+			// no transfer or entry was left behind, so the account can still be deleted
+			require.NoError(t, store.DeleteAccount(ctx, account.ID))
+		}
+	})
+
+	t.Run("CurrencyMismatchErrorDetails", func(t *testing.T) {
+		store := newStore(t)
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.EUR)
+
+		_, err := store.TransferTx(context.Background(), TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+		var mismatch *CurrencyMismatchError
+		require.True(t, errors.As(err, &mismatch))
+		require.Equal(t, account2.ID, mismatch.AccountID)
+		require.Equal(t, util.USD, mismatch.Expected)
+		require.Equal(t, util.EUR, mismatch.Actual)
+	})
+
+	t.Run("IdempotentTransferTxReplaysResult", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		arg := TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD, IdempotencyKey: util.RandomString(16)}
+
+		result1, err := store.TransferTx(ctx, arg)
+		require.NoError(t, err)
+		result2, err := store.TransferTx(ctx, arg)
+		require.NoError(t, err)
+		require.Equal(t, result1.Transfer.ID, result2.Transfer.ID)
+		require.Equal(t, result1.FromEntry.ID, result2.FromEntry.ID)
+		require.Equal(t, result1.FromAccount.Balance, result2.FromAccount.Balance)
+		require.True(t, result1.Transfer.CreatedAt.Equal(result2.Transfer.CreatedAt))
+
+		// the money only moved once
+		updated1, err := store.GetAccount(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance-10, updated1.Balance)
+
+		// same key, different parameters
+		arg.Amount = 20
+		_, err = store.TransferTx(ctx, arg)
+		require.ErrorIs(t, err, ErrIdempotencyKeyConflict)
+	})
+
+	t.Run("IdempotencyKeyIsScopedToSourceAccount", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		account3 := createRandomStoreAccount(t, store, util.USD)
+		key := util.RandomString(16)
+
+		result1, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account3.ID, Amount: 10, Currency: util.USD, IdempotencyKey: key})
+		require.NoError(t, err)
+		// another account picking the same key neither conflicts nor gets the first result back
+		result2, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account2.ID, ToAccountID: account3.ID, Amount: 20, Currency: util.USD, IdempotencyKey: key})
+		require.NoError(t, err)
+		require.NotEqual(t, result1.Transfer.ID, result2.Transfer.ID)
+		require.Equal(t, account2.ID, result2.Transfer.FromAccountID)
+		require.Equal(t, int64(20), result2.Transfer.Amount)
+
+		updated2, err := store.GetAccount(ctx, account2.ID)
+		require.NoError(t, err)
+		require.Equal(t, account2.Balance-20, updated2.Balance)
+		updated3, err := store.GetAccount(ctx, account3.ID)
+		require.NoError(t, err)
+		require.Equal(t, account3.Balance+30, updated3.Balance)
+	})
+
+	t.Run("ConcurrentIdempotentTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		arg := TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD, IdempotencyKey: util.RandomString(16)}
+
+		n := 5
+		results := make(chan TransferTxResult, n)
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			go func() {
+				result, err := store.TransferTx(context.Background(), arg)
+				errs <- err
+				results <- result
+			}()
+		}
+		transferIDs := make(map[int64]bool)
+		for i := 0; i < n; i++ {
+			require.NoError(t, <-errs)
+			transferIDs[(<-results).Transfer.ID] = true
+		}
+		require.Len(t, transferIDs, 1)
+
+		updated1, err := store.GetAccount(context.Background(), account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance-10, updated1.Balance)
+	})
+
+	t.Run("ExpiredIdempotencyKeyIsReused", func(t *testing.T) {
+		store := newStore(t, WithIdempotencyRetention(-time.Second)) // every key is already expired
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		arg := TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD, IdempotencyKey: util.RandomString(16)}
+
+		result1, err := store.TransferTx(ctx, arg)
+		require.NoError(t, err)
+		arg.Amount = 20 // an expired key doesn't conflict
+		result2, err := store.TransferTx(ctx, arg)
+		require.NoError(t, err)
+		require.NotEqual(t, result1.Transfer.ID, result2.Transfer.ID)
+
+		deleted, err := store.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, deleted, int64(1))
+		_, err = store.GetIdempotencyKeyForUpdate(ctx, GetIdempotencyKeyForUpdateParams{AccountID: arg.FromAccountID, Key: arg.IdempotencyKey})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("FailedIdempotentTransferTxReleasesKey", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		arg := TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance + 1, Currency: util.USD, IdempotencyKey: util.RandomString(16)}
+
+		_, err := store.TransferTx(ctx, arg)
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+		// the key was rolled back together with the transfer, so it can be retried with other parameters
+		arg.Amount = 10
+		_, err = store.TransferTx(ctx, arg)
+		require.NoError(t, err)
+	})
+
+	t.Run("BatchTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		payer := createRandomStoreAccount(t, store, util.EUR)
+		var payees []Account
+		var legs []TransferLeg
+		for i := 0; i < 3; i++ {
+			payee := createRandomStoreAccount(t, store, util.EUR)
+			payees = append(payees, payee)
+			legs = append(legs, TransferLeg{FromAccountID: payer.ID, ToAccountID: payee.ID, Amount: int64(10 * (i + 1))})
+		}
+
+		result, err := store.BatchTransferTx(ctx, BatchTransferTxParams{Legs: legs, Currency: util.EUR})
+		require.NoError(t, err)
+		require.Len(t, result.Transfers, 3)
+		require.Len(t, result.Entries, 6)
+		require.Len(t, result.Accounts, 4)
+		for i, transfer := range result.Transfers {
+			require.Equal(t, legs[i].ToAccountID, transfer.ToAccountID)
+			require.Equal(t, legs[i].Amount, transfer.Amount)
+			require.Equal(t, util.EUR, transfer.Currency)
+			require.Equal(t, -legs[i].Amount, result.Entries[2*i].Amount)
+			require.Equal(t, legs[i].Amount, result.Entries[2*i+1].Amount)
+		}
+		for i := 1; i < len(result.Accounts); i++ {
+			require.Less(t, result.Accounts[i-1].ID, result.Accounts[i].ID)
+		}
+
+		updatedPayer, err := store.GetAccount(ctx, payer.ID)
+		require.NoError(t, err)
+		require.Equal(t, payer.Balance-60, updatedPayer.Balance)
+		for i, payee := range payees {
+			updated, err := store.GetAccount(ctx, payee.ID)
+			require.NoError(t, err)
+			require.Equal(t, payee.Balance+legs[i].Amount, updated.Balance)
+		}
+	})
+
+	t.Run("BatchTransferTxOnlyChecksFinalBalance", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+
+		// account2 forwards more than it holds, but receives it earlier in the same batch
+		_, err := store.BatchTransferTx(ctx, BatchTransferTxParams{Currency: util.USD, Legs: []TransferLeg{
+			{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: account2.Balance + 100},
+			{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 100},
+		}})
+		require.NoError(t, err)
+
+		updated2, err := store.GetAccount(ctx, account2.ID)
+		require.NoError(t, err)
+		require.Zero(t, updated2.Balance)
+	})
+
+	t.Run("BatchTransferTxFromFrozenAccount", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		accountA := createRandomStoreAccount(t, store, util.USD)
+		accountB := createRandomStoreAccount(t, store, util.USD)
+		accountC := createRandomStoreAccount(t, store, util.USD)
+		_, err := store.FreezeAccountTx(ctx, AccountStatusTxParams{AccountID: accountA.ID, Reason: "aml review", Actor: "compliance"})
+		require.NoError(t, err)
+
+		// the frozen account gains money overall, but still can't send any
+		_, err = store.BatchTransferTx(ctx, BatchTransferTxParams{Currency: util.USD, Legs: []TransferLeg{
+			{FromAccountID: accountA.ID, ToAccountID: accountB.ID, Amount: 10},
+			{FromAccountID: accountC.ID, ToAccountID: accountA.ID, Amount: 20},
+		}})
+		require.ErrorIs(t, err, ErrAccountFrozen)
+
+		unchanged, err := store.GetAccount(ctx, accountA.ID)
+		require.NoError(t, err)
+		require.Equal(t, accountA.Balance, unchanged.Balance)
+	})
+
+	t.Run("FailedBatchTransferTxRollsBack", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		account3 := createRandomStoreAccount(t, store, util.CAD)
+
+		testCases := []struct {
+			name    string
+			legs    []TransferLeg
+			wantErr error
+		}{
+			{"Empty", nil, ErrEmptyBatch},
+			{"InvalidAmount", []TransferLeg{{account1.ID, account2.ID, 10}, {account2.ID, account1.ID, 0}}, ErrInvalidAmount},
+			{"SameAccount", []TransferLeg{{account1.ID, account2.ID, 10}, {account2.ID, account2.ID, 10}}, ErrSameAccount},
+			{"MissingAccount", []TransferLeg{{account1.ID, account2.ID, 10}, {account2.ID, -1, 10}}, ErrAccountNotFound},
+			{"CurrencyMismatch", []TransferLeg{{account1.ID, account2.ID, 10}, {account2.ID, account3.ID, 10}}, ErrCurrencyMismatch},
+			{"InsufficientFunds", []TransferLeg{{account1.ID, account2.ID, 10}, {account1.ID, account2.ID, account1.Balance}}, ErrInsufficientFunds},
+		}
+		for _, tc := range testCases {
+			_, err := store.BatchTransferTx(ctx, BatchTransferTxParams{Legs: tc.legs, Currency: util.USD})
+			require.ErrorIs(t, err, tc.wantErr, tc.name)
+		}
+
+		for _, account := range []Account{account1, account2, account3} {
+			unchanged, err := store.GetAccount(ctx, account.ID)
+			require.NoError(t, err)
+			require.Equal(t, account.Balance, unchanged.Balance)
+			require.NoError(t, store.DeleteAccount(ctx, account.ID))
+		}
+	})
+
+	t.Run("ConcurrentBatchTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		var accounts []Account
+		for i := 0; i < 4; i++ {
+			accounts = append(accounts, createRandomStoreAccount(t, store, util.USD))
+		}
+		// every batch walks the same accounts in a different order, money goes around in a circle
+		n := 8
+		errs := make(chan error)
+		for i := 0; i < n; i++ {
+			var legs []TransferLeg
+			for j := range accounts {
+				from := accounts[(i+j)%len(accounts)]
+				to := accounts[(i+j+1)%len(accounts)]
+				if i%2 == 1 {
+					from, to = to, from
+				}
+				legs = append(legs, TransferLeg{FromAccountID: from.ID, ToAccountID: to.ID, Amount: 10})
+			}
+			go func() {
+				_, err := store.BatchTransferTx(context.Background(), BatchTransferTxParams{Legs: legs, Currency: util.USD})
+				errs <- err
+			}()
+		}
+		for i := 0; i < n; i++ {
+			require.NoError(t, <-errs)
+		}
+		for _, account := range accounts {
+			updated, err := store.GetAccount(context.Background(), account.ID)
+			require.NoError(t, err)
+			require.Equal(t, account.Balance, updated.Balance)
+		}
+	})
+
+	t.Run("ReverseTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		original, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 100, Currency: util.USD})
+		require.NoError(t, err)
+
+		// partial refund
+		result, err := store.ReverseTransferTx(ctx, original.Transfer.ID, 30)
+		require.NoError(t, err)
+		require.Equal(t, account2.ID, result.Transfer.FromAccountID)
+		require.Equal(t, account1.ID, result.Transfer.ToAccountID)
+		require.Equal(t, int64(30), result.Transfer.Amount)
+		require.Equal(t, util.USD, result.Transfer.Currency)
+		require.Equal(t, sql.NullInt64{Int64: original.Transfer.ID, Valid: true}, result.Transfer.ReversalOf)
+		require.Equal(t, int64(-30), result.FromEntry.Amount)
+		require.Equal(t, int64(30), result.ToEntry.Amount)
+		require.Equal(t, account1.Balance-70, result.ToAccount.Balance)
+		require.Equal(t, account2.Balance+70, result.FromAccount.Balance)
+		require.Equal(t, int64(30), result.ReversedAmount)
+		require.Equal(t, int64(70), result.RemainingAmount)
+
+		// more than what is left
+		_, err = store.ReverseTransferTx(ctx, original.Transfer.ID, 71)
+		require.ErrorIs(t, err, ErrReversalExceedsAmount)
+
+		// the rest
+		result, err = store.ReverseTransferTx(ctx, original.Transfer.ID, 70)
+		require.NoError(t, err)
+		require.Zero(t, result.RemainingAmount)
+		require.Equal(t, account1.Balance, result.ToAccount.Balance)
+		require.Equal(t, account2.Balance, result.FromAccount.Balance)
+
+		_, err = store.ReverseTransferTx(ctx, original.Transfer.ID, 1)
+		require.ErrorIs(t, err, ErrReversalExceedsAmount)
+
+		// reversal history
+		reversals, err := store.ListTransferReversals(ctx, original.Transfer.ID)
+		require.NoError(t, err)
+		require.Len(t, reversals, 2)
+		require.Equal(t, int64(30), reversals[0].Amount)
+		require.Equal(t, result.Transfer.ID, reversals[1].ID)
+	})
+
+	t.Run("FailedReverseTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		account3 := createRandomStoreAccount(t, store, util.USD)
+		original, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 100, Currency: util.USD})
+		require.NoError(t, err)
+		reversal, err := store.ReverseTransferTx(ctx, original.Transfer.ID, 10)
+		require.NoError(t, err)
+
+		_, err = store.ReverseTransferTx(ctx, original.Transfer.ID, 0)
+		require.ErrorIs(t, err, ErrInvalidAmount)
+		_, err = store.ReverseTransferTx(ctx, -1, 10)
+		require.ErrorIs(t, err, ErrTransferNotFound)
+		_, err = store.ReverseTransferTx(ctx, reversal.Transfer.ID, 10)
+		require.ErrorIs(t, err, ErrTransferIsReversal)
+
+		// the money has already left the destination account
+		drained, err := store.GetAccount(ctx, account2.ID)
+		require.NoError(t, err)
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: account2.ID, ToAccountID: account3.ID, Amount: drained.Balance, Currency: util.USD})
+		require.NoError(t, err)
+		_, err = store.ReverseTransferTx(ctx, original.Transfer.ID, 10)
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+
+		reversals, err := store.ListTransferReversals(ctx, original.Transfer.ID)
+		require.NoError(t, err)
+		require.Len(t, reversals, 1)
+	})
+
+	t.Run("ConcurrentReverseTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		original, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 100, Currency: util.USD})
+		require.NoError(t, err)
+
+		// 10 concurrent refunds of 30: only 3 fit into the original 100
+		n := 10
+		errs := make(chan error)
+		for i := 0; i < n; i++ {
+			go func() {
+				_, err := store.ReverseTransferTx(context.Background(), original.Transfer.ID, 30)
+				errs <- err
+			}()
+		}
+		succeeded := 0
+		for i := 0; i < n; i++ {
+			err := <-errs
+			if err == nil {
+				succeeded++
+				continue
+			}
+			require.ErrorIs(t, err, ErrReversalExceedsAmount)
+		}
+		require.Equal(t, 3, succeeded)
+
+		updated1, err := store.GetAccount(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance-10, updated1.Balance)
+	})
+
+	t.Run("AuthorizeTxReducesAvailableBalance", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+
+		hold, err := store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 400, Currency: util.USD})
+		require.NoError(t, err)
+		require.NotZero(t, hold.ID)
+		require.Equal(t, HoldStatusActive, hold.Status)
+		require.Equal(t, int64(400), hold.Amount)
+		require.WithinDuration(t, time.Now().Add(DefaultHoldExpiration), hold.ExpiresAt, time.Minute)
+
+		// the ledger balance doesn't move, the available balance does
+		balance, err := store.GetAccountBalance(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, balance.LedgerBalance)
+		require.Equal(t, account1.Balance-400, balance.AvailableBalance)
+
+		// transfers and new holds can only use the available balance
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance, Currency: util.USD})
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+		_, err = store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: account1.Balance - 399, Currency: util.USD})
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance - 400, Currency: util.USD})
+		require.NoError(t, err)
+
+		_, err = store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 0, Currency: util.USD})
+		require.ErrorIs(t, err, ErrInvalidAmount)
+		_, err = store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 10, Currency: util.EUR})
+		require.ErrorIs(t, err, ErrCurrencyMismatch)
+		_, err = store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: -1, Amount: 10, Currency: util.USD})
+		require.ErrorIs(t, err, ErrAccountNotFound)
+
+		holds, err := store.ListAccountHolds(ctx, ListAccountHoldsParams{AccountID: account1.ID, Limit: 5})
+		require.NoError(t, err)
+		require.Equal(t, []Hold{hold}, holds)
+	})
+
+	t.Run("CaptureTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		hold, err := store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 400, Currency: util.USD})
+		require.NoError(t, err)
+
+		// partial capture: 250 moves, the other 150 is released
+		result, err := store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: 250})
+		require.NoError(t, err)
+		require.Equal(t, HoldStatusCaptured, result.Hold.Status)
+		require.Equal(t, int64(250), result.Hold.CapturedAmount)
+		require.Equal(t, sql.NullInt64{Int64: result.Transfer.ID, Valid: true}, result.Hold.TransferID)
+		require.Equal(t, int64(250), result.Transfer.Amount)
+		require.Equal(t, account1.Balance-250, result.FromAccount.Balance)
+		require.Equal(t, account2.Balance+250, result.ToAccount.Balance)
+
+		balance, err := store.GetAccountBalance(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, balance.LedgerBalance, balance.AvailableBalance)
+
+		_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrHoldNotActive)
+		_, err = store.VoidTx(ctx, hold.ID)
+		require.ErrorIs(t, err, ErrHoldNotActive)
+	})
+
+	t.Run("CaptureTxUsesHeldFunds", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+
+		// the whole balance is held, capturing it must still work
+		hold, err := store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: account1.Balance, Currency: util.USD})
+		require.NoError(t, err)
+		result, err := store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: account1.Balance})
+		require.NoError(t, err)
+		require.Zero(t, result.FromAccount.Balance)
+	})
+
+	t.Run("FailedCaptureTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		account3 := createRandomStoreAccount(t, store, util.EUR)
+		hold, err := store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 400, Currency: util.USD})
+		require.NoError(t, err)
+
+		_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: -1, ToAccountID: account2.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrHoldNotFound)
+		_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: 401})
+		require.ErrorIs(t, err, ErrCaptureExceedsHold)
+		_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: 0})
+		require.ErrorIs(t, err, ErrInvalidAmount)
+		_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account1.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrSameAccount)
+		_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account3.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrCurrencyMismatch)
+
+		// nothing moved and the hold is still there
+		got, err := store.GetHold(ctx, hold.ID)
+		require.NoError(t, err)
+		require.Equal(t, hold, got)
+		updated1, err := store.GetAccount(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, updated1.Balance)
+	})
+
+	t.Run("VoidTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account := createRandomStoreAccount(t, store, util.USD)
+		hold, err := store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account.ID, Amount: 400, Currency: util.USD})
+		require.NoError(t, err)
+
+		voided, err := store.VoidTx(ctx, hold.ID)
+		require.NoError(t, err)
+		require.Equal(t, HoldStatusVoided, voided.Status)
+		require.Zero(t, voided.CapturedAmount)
+		require.False(t, voided.TransferID.Valid)
+
+		balance, err := store.GetAccountBalance(ctx, account.ID)
+		require.NoError(t, err)
+		require.Equal(t, account.Balance, balance.LedgerBalance)
+		require.Equal(t, account.Balance, balance.AvailableBalance)
+
+		_, err = store.VoidTx(ctx, hold.ID)
+		require.ErrorIs(t, err, ErrHoldNotActive)
+		_, err = store.VoidTx(ctx, -1)
+		require.ErrorIs(t, err, ErrHoldNotFound)
+	})
+
+	t.Run("HoldsExpire", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		hold, err := store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account1.ID, Amount: 400, Currency: util.USD, ExpiresIn: 50 * time.Millisecond})
+		require.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+
+		// an expired hold stops reserving funds before its status is tidied up
+		balance, err := store.GetAccountBalance(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, balance.AvailableBalance)
+		_, err = store.CaptureTx(ctx, CaptureTxParams{HoldID: hold.ID, ToAccountID: account2.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrHoldExpired)
+		_, err = store.VoidTx(ctx, hold.ID)
+		require.ErrorIs(t, err, ErrHoldExpired)
+
+		expired, err := store.ExpireHolds(ctx)
+		require.NoError(t, err)
+		got, err := store.GetHold(ctx, hold.ID)
+		require.NoError(t, err)
+		require.Equal(t, HoldStatusExpired, got.Status)
+		require.Contains(t, expired, got)
+
+		// the audit log gets a row per expired hold
+		logs, err := store.ListAuditLogs(ctx, ListAuditLogsParams{AccountID: sql.NullInt64{Int64: account1.ID, Valid: true}, Limit: 10})
+		require.NoError(t, err)
+		log := logs[len(logs)-1]
+		require.Equal(t, AuditActionExpire, log.Action)
+		require.Equal(t, fmt.Sprint(hold.ID), log.TargetID)
+		var before, after Hold
+		require.NoError(t, json.Unmarshal(log.Before, &before))
+		require.NoError(t, json.Unmarshal(log.After, &after))
+		require.Equal(t, HoldStatusActive, before.Status)
+		require.Equal(t, HoldStatusExpired, after.Status)
+		require.Equal(t, got.ID, after.ID)
+	})
+
+	t.Run("ConcurrentAuthorizeTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account := createRandomStoreAccount(t, store, util.USD)
+
+		// 10 concurrent holds of a third of the balance: only 3 fit
+		n := 10
+		amount := account.Balance / 3
+		errs := make(chan error)
+		for i := 0; i < n; i++ {
+			go func() {
+				_, err := store.AuthorizeTx(context.Background(), AuthorizeTxParams{AccountID: account.ID, Amount: amount, Currency: util.USD})
+				errs <- err
+			}()
+		}
+		succeeded := 0
+		for i := 0; i < n; i++ {
+			err := <-errs
+			if err == nil {
+				succeeded++
+				continue
+			}
+			require.ErrorIs(t, err, ErrInsufficientFunds)
+		}
+		require.Equal(t, 3, succeeded)
+
+		held, err := store.GetHeldAmount(ctx, account.ID)
+		require.NoError(t, err)
+		require.Equal(t, 3*amount, held)
+	})
+
+	t.Run("ExchangeRates", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Second)
+
+		older, err := store.CreateExchangeRate(ctx, CreateExchangeRateParams{BaseCurrency: util.CAD, QuoteCurrency: util.EUR, Rate: "0.68", EffectiveAt: now.Add(-2 * time.Hour)})
+		require.NoError(t, err)
+		require.Equal(t, "0.6800000000", older.Rate)
+		newer, err := store.CreateExchangeRate(ctx, CreateExchangeRateParams{BaseCurrency: util.CAD, QuoteCurrency: util.EUR, Rate: "0.69", EffectiveAt: now.Add(-time.Hour)})
+		require.NoError(t, err)
+		future, err := store.CreateExchangeRate(ctx, CreateExchangeRateParams{BaseCurrency: util.CAD, QuoteCurrency: util.EUR, Rate: "0.70", EffectiveAt: now.Add(time.Hour)})
+		require.NoError(t, err)
+		defer store.DeleteExchangeRate(ctx, future.ID)
+
+		// the latest rate that is already in effect
+		effective, err := store.GetEffectiveExchangeRate(ctx, GetEffectiveExchangeRateParams{BaseCurrency: util.CAD, QuoteCurrency: util.EUR, At: now})
+		require.NoError(t, err)
+		require.Equal(t, newer.ID, effective.ID)
+		effective, err = store.GetEffectiveExchangeRate(ctx, GetEffectiveExchangeRateParams{BaseCurrency: util.CAD, QuoteCurrency: util.EUR, At: now.Add(-90 * time.Minute)})
+		require.NoError(t, err)
+		require.Equal(t, older.ID, effective.ID)
+		_, err = store.GetEffectiveExchangeRate(ctx, GetEffectiveExchangeRateParams{BaseCurrency: util.EUR, QuoteCurrency: util.CAD, At: now.Add(-100 * 24 * time.Hour)})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+
+		rates, err := store.ListExchangeRates(ctx, ListExchangeRatesParams{BaseCurrency: util.CAD, QuoteCurrency: util.EUR, Limit: 3})
+		require.NoError(t, err)
+		require.Len(t, rates, 3)
+		require.Equal(t, future.ID, rates[0].ID) // newest first
+		require.Equal(t, newer.ID, rates[1].ID)
+
+		_, err = store.CreateExchangeRate(ctx, CreateExchangeRateParams{BaseCurrency: util.CAD, QuoteCurrency: util.EUR, Rate: "0", EffectiveAt: now})
+		require.Error(t, err)
+
+		require.NoError(t, store.DeleteExchangeRate(ctx, future.ID))
+		_, err = store.GetExchangeRate(ctx, future.ID)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("FXTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.EUR)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		_, err := store.CreateExchangeRate(ctx, CreateExchangeRateParams{BaseCurrency: util.EUR, QuoteCurrency: util.USD, Rate: "1.0850", EffectiveAt: time.Now().Add(-time.Second)})
+		require.NoError(t, err)
+
+		// 1.23 EUR at 1.085 = 1.33455 USD
+		result, err := store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 123})
+		require.NoError(t, err)
+		require.Equal(t, "1.0850000000", result.Rate.Rate)
+		transfer := result.Transfer
+		require.Equal(t, int64(123), transfer.Amount)
+		require.Equal(t, util.EUR, transfer.Currency)
+		require.Equal(t, sql.NullInt64{Int64: 133, Valid: true}, transfer.ConvertedAmount)
+		require.Equal(t, sql.NullString{String: util.USD, Valid: true}, transfer.ConvertedCurrency)
+		require.Equal(t, sql.NullString{String: "1.0850000000", Valid: true}, transfer.ExchangeRate)
+		require.Equal(t, int64(-123), result.FromEntry.Amount)
+		require.Equal(t, int64(133), result.ToEntry.Amount)
+		require.Equal(t, account1.Balance-123, result.FromAccount.Balance)
+		require.Equal(t, account2.Balance+133, result.ToAccount.Balance)
+
+		stored, err := store.GetTransfer(ctx, transfer.ID)
+		require.NoError(t, err)
+		require.Equal(t, transfer, stored)
+
+		result, err = store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 123, Rounding: RoundDown})
+		require.NoError(t, err)
+		require.Equal(t, int64(133), result.Transfer.ConvertedAmount.Int64)
+		result, err = store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 200})
+		require.NoError(t, err)
+		require.Equal(t, int64(217), result.Transfer.ConvertedAmount.Int64)
+
+		// refunds of a conversion need a rate of their own
+		_, err = store.ReverseTransferTx(ctx, transfer.ID, 10)
+		require.ErrorIs(t, err, ErrFXTransferReversal)
+	})
+
+	t.Run("FXTransferTxSameCurrency", func(t *testing.T) {
+		store := newStore(t)
+		account1 := createRandomStoreAccount(t, store, util.CAD)
+		account2 := createRandomStoreAccount(t, store, util.CAD)
+
+		result, err := store.FXTransferTx(context.Background(), FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10})
+		require.NoError(t, err)
+		require.False(t, result.Transfer.ConvertedAmount.Valid)
+		require.False(t, result.Transfer.ExchangeRate.Valid)
+		require.Equal(t, account2.Balance+10, result.ToAccount.Balance)
+	})
+
+	t.Run("FailedFXTransferTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.CAD)
+
+		// only rates that are already in effect count
+		future, err := store.CreateExchangeRate(ctx, CreateExchangeRateParams{BaseCurrency: util.USD, QuoteCurrency: util.CAD, Rate: "1.35", EffectiveAt: time.Now().Add(24 * time.Hour)})
+		require.NoError(t, err)
+		defer store.DeleteExchangeRate(ctx, future.ID)
+		_, err = store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrExchangeRateNotFound)
+		// and only the direct pair
+		_, err = store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrExchangeRateNotFound)
+
+		_, err = store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance + 1})
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+		_, err = store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account1.ID, Amount: 10})
+		require.ErrorIs(t, err, ErrSameAccount)
+		_, err = store.FXTransferTx(ctx, FXTransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 0})
+		require.ErrorIs(t, err, ErrInvalidAmount)
+
+		updated1, err := store.GetAccount(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, updated1.Balance)
+	})
+
+	t.Run("AdjustBalanceTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		_, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+		require.NoError(t, err)
+
+		// the opening balance has no entry behind it
+		total, err := store.GetAccountEntriesTotal(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(-10), total)
+		rows, err := store.ListAccountEntryTotals(ctx, ListAccountEntryTotalsParams{AfterID: account1.ID - 1, Limit: 2})
+		require.NoError(t, err)
+		require.Equal(t, []ListAccountEntryTotalsRow{
+			{ID: account1.ID, Currency: util.USD, Balance: account1.Balance - 10, EntriesTotal: -10},
+			{ID: account2.ID, Currency: util.USD, Balance: account2.Balance + 10, EntriesTotal: 10},
+		}, rows)
+
+		result, err := store.AdjustBalanceTx(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, result.Drift)
+		require.Equal(t, int64(-10), result.EntriesTotal)
+		require.Equal(t, account1.Balance, result.Entry.Amount)
+		require.Equal(t, account1.Balance-10, result.Account.Balance)
+
+		// nothing left to adjust
+		result, err = store.AdjustBalanceTx(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Zero(t, result.Drift)
+		require.Zero(t, result.Entry.ID)
+
+		_, err = store.AdjustBalanceTx(ctx, -1)
+		require.ErrorIs(t, err, ErrAccountNotFound)
+	})
+
+	t.Run("GetBalanceAt", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		time.Sleep(20 * time.Millisecond)
+		opened := time.Now()
+		time.Sleep(20 * time.Millisecond)
+
+		first, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 100, Currency: util.USD})
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+		between := time.Now()
+		time.Sleep(20 * time.Millisecond)
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 50, Currency: util.USD})
+		require.NoError(t, err)
+
+		testCases := []struct {
+			at   time.Time
+			want int64
+		}{
+			{account1.CreatedAt.Add(-time.Second), 0}, // the account didn't exist yet
+			{opened, account1.Balance},
+			{first.FromEntry.CreatedAt, account1.Balance - 100}, // entries made exactly at t count
+			{between, account1.Balance - 100},
+			{time.Now().Add(time.Second), account1.Balance - 150},
+		}
+		for _, tc := range testCases {
+			balance, err := store.GetBalanceAt(ctx, account1.ID, tc.at)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, balance)
+		}
+
+		balances, err := store.GetBalancesAt(ctx, []int64{account1.ID, account2.ID}, between)
+		require.NoError(t, err)
+		require.Equal(t, map[int64]int64{account1.ID: account1.Balance - 100, account2.ID: account2.Balance + 100}, balances)
+
+		_, err = store.GetBalanceAt(ctx, -1, between)
+		require.ErrorIs(t, err, ErrAccountNotFound)
+		_, err = store.GetBalancesAt(ctx, []int64{account1.ID, -1}, between)
+		require.ErrorIs(t, err, ErrAccountNotFound)
+	})
+
+	t.Run("ListStatementEntries", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		from := time.Now()
+		time.Sleep(20 * time.Millisecond)
+
+		result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+		require.NoError(t, err)
+		require.Equal(t, sql.NullInt64{Int64: result.Transfer.ID, Valid: true}, result.FromEntry.TransferID)
+		require.Equal(t, sql.NullInt64{Int64: result.Transfer.ID, Valid: true}, result.ToEntry.TransferID)
+		adjustment, err := store.CreateEntry(ctx, CreateEntryParams{AccountID: account1.ID, Amount: 5})
+		require.NoError(t, err)
+		require.False(t, adjustment.TransferID.Valid)
+		_, err = store.CreateEntry(ctx, CreateEntryParams{AccountID: account1.ID, Amount: 5, TransferID: sql.NullInt64{Int64: -1, Valid: true}})
+		requireForeignKeyViolation(t, err)
+
+		rows, err := store.ListStatementEntries(ctx, ListStatementEntriesParams{AccountID: account1.ID, FromTime: from, ToTime: time.Now().Add(time.Second)})
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		require.Equal(t, result.FromEntry.ID, rows[0].ID)
+		require.Equal(t, sql.NullInt64{Int64: account1.ID, Valid: true}, rows[0].FromAccountID)
+		require.Equal(t, sql.NullInt64{Int64: account2.ID, Valid: true}, rows[0].ToAccountID)
+		require.Equal(t, adjustment.ID, rows[1].ID)
+		require.False(t, rows[1].TransferID.Valid)
+		require.False(t, rows[1].FromAccountID.Valid)
+
+		rows, err = store.ListStatementEntries(ctx, ListStatementEntriesParams{AccountID: account1.ID, FromTime: from.Add(-time.Hour), ToTime: from})
+		require.NoError(t, err)
+		require.Empty(t, rows)
+	})
+
+	t.Run("ListEntries", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		var results []TransferTxResult
+		for _, amount := range []int64{10, 20, 30, 40, 50} {
+			result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: amount, Currency: util.USD})
+			require.NoError(t, err)
+			results = append(results, result)
+		}
+		_, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 35, Currency: util.USD})
+		require.NoError(t, err)
+
+		// debits of account1 between 20 and 40, two per page
+		arg := ListEntriesParams{
+			AccountID: sql.NullInt64{Int64: account1.ID, Valid: true},
+			Direction: sql.NullString{String: DirectionOut, Valid: true},
+			MinAmount: sql.NullInt64{Int64: 20, Valid: true},
+			MaxAmount: sql.NullInt64{Int64: 40, Valid: true},
+			Limit:     2,
+		}
+		page1, err := store.ListEntries(ctx, arg)
+		require.NoError(t, err)
+		require.Equal(t, []Entry{results[1].FromEntry, results[2].FromEntry}, page1)
+		page2, err := store.ListEntries(ctx, arg.After(EntryCursor(page1[1])))
+		require.NoError(t, err)
+		require.Equal(t, []Entry{results[3].FromEntry}, page2)
+		page3, err := store.ListEntries(ctx, arg.After(EntryCursor(page2[0])))
+		require.NoError(t, err)
+		require.Empty(t, page3)
+
+		credits, err := store.ListEntries(ctx, ListEntriesParams{
+			AccountID: sql.NullInt64{Int64: account1.ID, Valid: true},
+			Direction: sql.NullString{String: DirectionIn, Valid: true},
+			Limit:     10,
+		})
+		require.NoError(t, err)
+		require.Len(t, credits, 1)
+		require.Equal(t, int64(35), credits[0].Amount)
+
+		window, err := store.ListEntries(ctx, ListEntriesParams{
+			AccountID: sql.NullInt64{Int64: account2.ID, Valid: true},
+			FromTime:  sql.NullTime{Time: results[0].ToEntry.CreatedAt, Valid: true},
+			ToTime:    sql.NullTime{Time: results[2].ToEntry.CreatedAt, Valid: true},
+			Limit:     10,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Entry{results[1].ToEntry, results[2].ToEntry}, window)
+	})
+
+	t.Run("ListTransfers", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		account3 := createRandomStoreAccount(t, store, util.USD)
+		var transfers []Transfer
+		for _, leg := range []TransferLeg{
+			{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10},
+			{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 20},
+			{FromAccountID: account2.ID, ToAccountID: account3.ID, Amount: 30},
+			{FromAccountID: account1.ID, ToAccountID: account3.ID, Amount: 40},
+		} {
+			result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: leg.FromAccountID, ToAccountID: leg.ToAccountID, Amount: leg.Amount, Currency: util.USD})
+			require.NoError(t, err)
+			transfers = append(transfers, result.Transfer)
+		}
+
+		account1ID := sql.NullInt64{Int64: account1.ID, Valid: true}
+		all, err := store.ListTransfers(ctx, ListTransfersParams{AccountID: account1ID, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []Transfer{transfers[0], transfers[1], transfers[3]}, all)
+		sent, err := store.ListTransfers(ctx, ListTransfersParams{AccountID: account1ID, Direction: sql.NullString{String: DirectionOut, Valid: true}, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []Transfer{transfers[0], transfers[3]}, sent)
+		received, err := store.ListTransfers(ctx, ListTransfersParams{AccountID: account1ID, Direction: sql.NullString{String: DirectionIn, Valid: true}, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []Transfer{transfers[1]}, received)
+		large, err := store.ListTransfers(ctx, ListTransfersParams{AccountID: account1ID, MinAmount: sql.NullInt64{Int64: 15, Valid: true}, MaxAmount: sql.NullInt64{Int64: 35, Valid: true}, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []Transfer{transfers[1]}, large)
+
+		// walk every transfer of the test one at a time, through opaque cursors
+		arg := ListTransfersParams{FromTime: sql.NullTime{Time: transfers[0].CreatedAt.Add(-time.Microsecond), Valid: true}, Limit: 1}
+		var walked []Transfer
+		for {
+			page, err := store.ListTransfers(ctx, arg)
+			require.NoError(t, err)
+			if len(page) == 0 {
+				break
+			}
+			walked = append(walked, page...)
+			cursor, err := ParseCursor(TransferCursor(page[len(page)-1]).String())
+			require.NoError(t, err)
+			arg = arg.After(cursor)
+		}
+		require.Equal(t, transfers, walked)
+	})
+
+	t.Run("AccountStatusTransitions", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account := createRandomStoreAccount(t, store, util.USD)
+		require.Equal(t, AccountStatusActive, account.Status)
+		arg := AccountStatusTxParams{AccountID: account.ID, Reason: "aml review", Actor: "compliance"}
+
+		result, err := store.FreezeAccountTx(ctx, arg)
+		require.NoError(t, err)
+		require.Equal(t, AccountStatusFrozen, result.Account.Status)
+		require.Equal(t, "aml review", result.Account.StatusReason)
+		require.Equal(t, AccountStatusActive, result.Change.FromStatus)
+		require.Equal(t, AccountStatusFrozen, result.Change.ToStatus)
+		require.Equal(t, "compliance", result.Change.Actor)
+
+		// already frozen, and only dormant accounts can be reactivated
+		_, err = store.FreezeAccountTx(ctx, arg)
+		require.ErrorIs(t, err, ErrInvalidStatusTransition)
+		_, err = store.ReactivateAccountTx(ctx, arg)
+		require.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+		arg.Reason = "cleared"
+		_, err = store.UnfreezeAccountTx(ctx, arg)
+		require.NoError(t, err)
+		_, err = store.MarkAccountDormantTx(ctx, arg)
+		require.NoError(t, err)
+		result, err = store.ReactivateAccountTx(ctx, arg)
+		require.NoError(t, err)
+		require.Equal(t, AccountStatusActive, result.Account.Status)
+
+		changes, err := store.ListAccountStatusChanges(ctx, account.ID)
+		require.NoError(t, err)
+		require.Len(t, changes, 4)
+		var path []string
+		for _, change := range changes {
+			path = append(path, change.ToStatus)
+		}
+		require.Equal(t, []string{AccountStatusFrozen, AccountStatusActive, AccountStatusDormant, AccountStatusActive}, path)
+
+		// the reason is mandatory and failed changes aren't recorded
+		_, err = store.FreezeAccountTx(ctx, AccountStatusTxParams{AccountID: account.ID, Reason: " "})
+		require.ErrorIs(t, err, ErrReasonRequired)
+		_, err = store.FreezeAccountTx(ctx, AccountStatusTxParams{AccountID: -1, Reason: "aml review"})
+		require.ErrorIs(t, err, ErrAccountNotFound)
+		changes, err = store.ListAccountStatusChanges(ctx, account.ID)
+		require.NoError(t, err)
+		require.Len(t, changes, 4)
+	})
+
+	t.Run("AccountStatusBlocksTransfers", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		frozen := createRandomStoreAccount(t, store, util.USD)
+		other := createRandomStoreAccount(t, store, util.USD)
+		_, err := store.FreezeAccountTx(ctx, AccountStatusTxParams{AccountID: frozen.ID, Reason: "dispute"})
+		require.NoError(t, err)
+
+		// money can come in but not go out
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: frozen.ID, ToAccountID: other.ID, Amount: 10, Currency: util.USD})
+		require.ErrorIs(t, err, ErrAccountFrozen)
+		_, err = store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: frozen.ID, Amount: 10, Currency: util.USD})
+		require.ErrorIs(t, err, ErrAccountFrozen)
+		_, err = store.BatchTransferTx(ctx, BatchTransferTxParams{Currency: util.USD, Legs: []TransferLeg{{FromAccountID: frozen.ID, ToAccountID: other.ID, Amount: 10}}})
+		require.ErrorIs(t, err, ErrAccountFrozen)
+		result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: other.ID, ToAccountID: frozen.ID, Amount: 10, Currency: util.USD})
+		require.NoError(t, err)
+
+		// a refund would debit the frozen account
+		_, err = store.ReverseTransferTx(ctx, result.Transfer.ID, 10)
+		require.ErrorIs(t, err, ErrAccountFrozen)
+
+		// nothing goes in or out of a closed account
+		closed, err := store.CreateAccount(ctx, CreateAccountParams{Owner: createRandomStoreUser(t, store).Username, Currency: util.USD})
+		require.NoError(t, err)
+		_, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: closed.ID, Reason: "customer request"})
+		require.NoError(t, err)
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: other.ID, ToAccountID: closed.ID, Amount: 10, Currency: util.USD})
+		require.ErrorIs(t, err, ErrAccountClosed)
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: closed.ID, ToAccountID: other.ID, Amount: 10, Currency: util.USD})
+		require.ErrorIs(t, err, ErrAccountClosed)
+
+		account, err := store.GetAccount(ctx, other.ID)
+		require.NoError(t, err)
+		require.Equal(t, other.Balance-10, account.Balance)
+	})
+
+	t.Run("CloseAccountTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account := createRandomStoreAccount(t, store, util.USD)
+		destination := createRandomStoreAccount(t, store, util.USD)
+		arg := CloseAccountTxParams{AccountID: account.ID, DestinationAccountID: destination.ID, Reason: "customer request", Actor: "support"}
+
+		// the remaining balance is swept with a regular transfer
+		result, err := store.CloseAccountTx(ctx, arg)
+		require.NoError(t, err)
+		require.Equal(t, account.Balance, result.SweptAmount)
+		require.Equal(t, account.Balance, result.Sweep.Transfer.Amount)
+		require.Equal(t, -account.Balance, result.Sweep.FromEntry.Amount)
+		require.Equal(t, destination.Balance+account.Balance, result.Sweep.ToAccount.Balance)
+		require.Zero(t, result.Account.Balance)
+		require.Equal(t, AccountStatusClosed, result.Account.Status)
+		require.Equal(t, AccountStatusActive, result.Change.FromStatus)
+		require.Equal(t, AccountStatusClosed, result.Change.ToStatus)
+		require.Equal(t, "support", result.Change.Actor)
+
+		// closed is terminal
+		_, err = store.CloseAccountTx(ctx, arg)
+		require.ErrorIs(t, err, ErrInvalidStatusTransition)
+		_, err = store.UnfreezeAccountTx(ctx, AccountStatusTxParams{AccountID: account.ID, Reason: "mistake"})
+		require.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+		// nothing to sweep, no destination needed, and one that is given isn't even looked at
+		empty, err := store.CreateAccount(ctx, CreateAccountParams{Owner: createRandomStoreUser(t, store).Username, Currency: util.USD})
+		require.NoError(t, err)
+		result, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: empty.ID, Reason: "duplicate"})
+		require.NoError(t, err)
+		require.Zero(t, result.SweptAmount)
+		require.Zero(t, result.Sweep.Transfer.ID)
+		require.Equal(t, AccountStatusClosed, result.Account.Status)
+		empty, err = store.CreateAccount(ctx, CreateAccountParams{Owner: createRandomStoreUser(t, store).Username, Currency: util.USD})
+		require.NoError(t, err)
+		_, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: empty.ID, DestinationAccountID: -1, Reason: "duplicate"})
+		require.NoError(t, err)
+
+		// a frozen account can't be emptied by closing it, only closed once it is empty
+		frozen := createRandomStoreAccount(t, store, util.USD)
+		_, err = store.FreezeAccountTx(ctx, AccountStatusTxParams{AccountID: frozen.ID, Reason: "fraud"})
+		require.NoError(t, err)
+		_, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: frozen.ID, DestinationAccountID: destination.ID, Reason: "fraud"})
+		require.ErrorIs(t, err, ErrAccountFrozen)
+		got, err := store.GetAccount(ctx, frozen.ID)
+		require.NoError(t, err)
+		require.Equal(t, frozen.Balance, got.Balance)
+		require.Equal(t, AccountStatusFrozen, got.Status)
+
+		frozen, err = store.CreateAccount(ctx, CreateAccountParams{Owner: createRandomStoreUser(t, store).Username, Currency: util.USD})
+		require.NoError(t, err)
+		_, err = store.FreezeAccountTx(ctx, AccountStatusTxParams{AccountID: frozen.ID, Reason: "fraud"})
+		require.NoError(t, err)
+		result, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: frozen.ID, Reason: "fraud"})
+		require.NoError(t, err)
+		require.Equal(t, AccountStatusFrozen, result.Change.FromStatus)
+	})
+
+	t.Run("FailedCloseAccountTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account := createRandomStoreAccount(t, store, util.USD)
+		destination := createRandomStoreAccount(t, store, util.USD)
+		eur := createRandomStoreAccount(t, store, util.EUR)
+		negative, err := store.CreateAccount(ctx, CreateAccountParams{Owner: createRandomStoreUser(t, store).Username, Balance: -10, Currency: util.USD})
+		require.NoError(t, err)
+
+		testCases := []struct {
+			name string
+			arg  CloseAccountTxParams
+			err  error
+		}{
+			{"NoReason", CloseAccountTxParams{AccountID: account.ID, DestinationAccountID: destination.ID}, ErrReasonRequired},
+			{"NoDestination", CloseAccountTxParams{AccountID: account.ID, Reason: "r"}, ErrAccountNotEmpty},
+			{"SameAccount", CloseAccountTxParams{AccountID: account.ID, DestinationAccountID: account.ID, Reason: "r"}, ErrSameAccount},
+			{"MissingAccount", CloseAccountTxParams{AccountID: -1, DestinationAccountID: destination.ID, Reason: "r"}, ErrAccountNotFound},
+			{"MissingDestination", CloseAccountTxParams{AccountID: account.ID, DestinationAccountID: -1, Reason: "r"}, ErrAccountNotFound},
+			{"CurrencyMismatch", CloseAccountTxParams{AccountID: account.ID, DestinationAccountID: eur.ID, Reason: "r"}, ErrCurrencyMismatch},
+			{"NegativeBalance", CloseAccountTxParams{AccountID: negative.ID, DestinationAccountID: destination.ID, Reason: "r"}, ErrNegativeBalance},
+		}
+		for _, tc := range testCases {
+			_, err := store.CloseAccountTx(ctx, tc.arg)
+			require.ErrorIs(t, err, tc.err, tc.name)
+		}
+
+		// pending holds must be captured or voided first
+		_, err = store.AuthorizeTx(ctx, AuthorizeTxParams{AccountID: account.ID, Amount: 1, Currency: util.USD})
+		require.NoError(t, err)
+		_, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: account.ID, DestinationAccountID: destination.ID, Reason: "r"})
+		require.ErrorIs(t, err, ErrHoldsPending)
+
+		// a closed destination can't receive the sweep
+		closed, err := store.CreateAccount(ctx, CreateAccountParams{Owner: createRandomStoreUser(t, store).Username, Currency: util.USD})
+		require.NoError(t, err)
+		_, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: closed.ID, Reason: "r"})
+		require.NoError(t, err)
+		_, err = store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: destination.ID, DestinationAccountID: closed.ID, Reason: "r"})
+		require.ErrorIs(t, err, ErrAccountClosed)
+
+		// nothing was written
+		for _, a := range []Account{account, destination} {
+			got, err := store.GetAccount(ctx, a.ID)
+			require.NoError(t, err)
+			require.Equal(t, a.Balance, got.Balance)
+			require.Equal(t, AccountStatusActive, got.Status)
+			changes, err := store.ListAccountStatusChanges(ctx, a.ID)
+			require.NoError(t, err)
+			require.Empty(t, changes)
+		}
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		arg := RegisterUserParams{
+			Username: util.RandomString(10),
+			Password: util.RandomString(8),
+			FullName: util.RandomOwner(),
+			Email:    util.RandomString(10) + "@email.com",
+		}
+		user, err := store.RegisterUser(ctx, arg)
+		require.NoError(t, err)
+		require.Equal(t, arg.Username, user.Username)
+		require.Equal(t, arg.Email, user.Email)
+		require.NotEqual(t, arg.Password, user.HashedPassword)
+		require.NoError(t, util.CheckPassword(arg.Password, user.HashedPassword))
+		require.True(t, user.PasswordChangedAt.IsZero())
+		require.NotZero(t, user.CreatedAt)
+
+		got, err := store.GetUser(ctx, arg.Username)
+		require.NoError(t, err)
+		require.Equal(t, user, got)
+		got, err = store.GetUserByEmail(ctx, arg.Email)
+		require.NoError(t, err)
+		require.Equal(t, user, got)
+		_, err = store.GetUser(ctx, util.RandomString(10))
+		require.ErrorIs(t, err, sql.ErrNoRows)
+
+		got, err = store.AuthenticateUser(ctx, arg.Username, arg.Password)
+		require.NoError(t, err)
+		require.Equal(t, user, got)
+		_, err = store.AuthenticateUser(ctx, arg.Username, arg.Password+"x")
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+		_, err = store.AuthenticateUser(ctx, util.RandomString(10), arg.Password)
+		require.ErrorIs(t, err, ErrInvalidCredentials)
+
+		// bcrypt's limit is in bytes, not characters
+		arg.Username, arg.Email = util.RandomString(10), util.RandomString(10)+"@email.com"
+		arg.Password = strings.Repeat("é", util.MaxPasswordBytes/2+1)
+		_, err = store.RegisterUser(ctx, arg)
+		require.ErrorIs(t, err, ErrPasswordTooLong)
+		arg.Password = strings.Repeat("é", util.MaxPasswordBytes/2)
+		_, err = store.RegisterUser(ctx, arg)
+		require.NoError(t, err)
+
+		// usernames and emails are unique
+		_, err = store.CreateUser(ctx, CreateUserParams{Username: user.Username, Email: util.RandomString(10) + "@email.com"})
+		requireUniqueViolation(t, err)
+		_, err = store.CreateUser(ctx, CreateUserParams{Username: util.RandomString(10), Email: user.Email})
+		requireUniqueViolation(t, err)
+	})
+
+	t.Run("AccountOwner", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		// the owner must be a user
+		_, err := store.CreateAccount(ctx, CreateAccountParams{Owner: util.RandomString(10), Currency: util.USD})
+		requireForeignKeyViolation(t, err)
+
+		// and can hold a single account per currency
+		user := createRandomStoreUser(t, store)
+		_, err = store.CreateAccount(ctx, CreateAccountParams{Owner: user.Username, Currency: util.USD})
+		require.NoError(t, err)
+		_, err = store.CreateAccount(ctx, CreateAccountParams{Owner: user.Username, Currency: util.USD})
+		requireUniqueViolation(t, err)
+		_, err = store.CreateAccount(ctx, CreateAccountParams{Owner: user.Username, Currency: util.EUR})
+		require.NoError(t, err)
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+
+		var transferID, newAccountID int64
+		err := store.DryRun(ctx, func(dry Store) error {
+			result, err := dry.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+			require.NoError(t, err)
+			transferID = result.Transfer.ID
+			require.Equal(t, account1.Balance-10, result.FromAccount.Balance)
+
+			// a failed canned transaction only undoes its own writes
+			_, err = dry.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance * 2, Currency: util.USD})
+			require.ErrorIs(t, err, ErrInsufficientFunds)
+
+			account, err := dry.CreateAccount(ctx, CreateAccountParams{Owner: account1.Owner, Currency: util.EUR})
+			require.NoError(t, err)
+			newAccountID = account.ID
+
+			got, err := dry.GetAccount(ctx, account1.ID)
+			require.NoError(t, err)
+			require.Equal(t, account1.Balance-10, got.Balance)
+			return nil
+		})
+		require.NoError(t, err)
+
+		// nothing was kept
+		_, err = store.GetTransfer(ctx, transferID)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		_, err = store.GetAccount(ctx, newAccountID)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		got, err := store.GetAccount(ctx, account1.ID)
+		require.NoError(t, err)
+		require.Equal(t, account1.Balance, got.Balance)
+
+		// ids are not reused
+		account3 := createRandomStoreAccount(t, store, util.USD)
+		require.Greater(t, account3.ID, newAccountID)
+
+		// the error of fn is returned
+		err = store.DryRun(ctx, func(dry Store) error {
+			_, err := dry.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account1.ID, Amount: 1, Currency: util.USD})
+			return err
+		})
+		require.ErrorIs(t, err, ErrSameAccount)
+	})
+
+	t.Run("OutboxEventsAreWrittenWithTheChange", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		listEvents := func(aggregateType string, aggregateID int64) []OutboxEvent {
+			events, err := store.ListOutboxEvents(ctx, ListOutboxEventsParams{AggregateType: aggregateType, AggregateID: aggregateID})
+			require.NoError(t, err)
+			return events
+		}
+
+		arg := TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 100, Currency: util.USD, IdempotencyKey: util.RandomString(16)}
+		transfer, err := store.TransferTx(ctx, arg)
+		require.NoError(t, err)
+		events := listEvents(AggregateTypeTransfer, transfer.Transfer.ID)
+		require.Len(t, events, 1)
+		require.Equal(t, EventTransferCreated, events[0].EventType)
+		require.False(t, events[0].SentAt.Valid)
+		require.Zero(t, events[0].Attempts)
+		var payload TransferEvent
+		require.NoError(t, json.Unmarshal(events[0].Payload, &payload))
+		require.Equal(t, TransferEvent{
+			TransferID:    transfer.Transfer.ID,
+			FromAccountID: account1.ID,
+			ToAccountID:   account2.ID,
+			Amount:        100,
+			Currency:      util.USD,
+			FromBalance:   account1.Balance - 100,
+			ToBalance:     account2.Balance + 100,
+		}, payload)
+
+		// a replayed request doesn't publish the transfer again
+		_, err = store.TransferTx(ctx, arg)
+		require.NoError(t, err)
+		require.Len(t, listEvents(AggregateTypeTransfer, transfer.Transfer.ID), 1)
+
+		reversal, err := store.ReverseTransferTx(ctx, transfer.Transfer.ID, 40)
+		require.NoError(t, err)
+		events = listEvents(AggregateTypeTransfer, reversal.Transfer.ID)
+		require.Len(t, events, 1)
+		require.Equal(t, EventTransferReversed, events[0].EventType)
+		require.NoError(t, json.Unmarshal(events[0].Payload, &payload))
+		require.Equal(t, transfer.Transfer.ID, payload.ReversalOf)
+
+		batch, err := store.BatchTransferTx(ctx, BatchTransferTxParams{
+			Legs: []TransferLeg{
+				{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10},
+				{FromAccountID: account2.ID, ToAccountID: account1.ID, Amount: 5},
+			},
+			Currency: util.USD,
+		})
+		require.NoError(t, err)
+		for _, transfer := range batch.Transfers {
+			events = listEvents(AggregateTypeTransfer, transfer.ID)
+			require.Len(t, events, 1)
+			require.Equal(t, EventTransferCreated, events[0].EventType)
+		}
+
+		// status changes, failed ones publish nothing
+		statusArg := AccountStatusTxParams{AccountID: account1.ID, Reason: "aml review", Actor: "compliance"}
+		_, err = store.FreezeAccountTx(ctx, statusArg)
+		require.NoError(t, err)
+		_, err = store.FreezeAccountTx(ctx, statusArg)
+		require.ErrorIs(t, err, ErrInvalidStatusTransition)
+		_, err = store.UnfreezeAccountTx(ctx, statusArg)
+		require.NoError(t, err)
+		_, err = store.MarkAccountDormantTx(ctx, statusArg)
+		require.NoError(t, err)
+		_, err = store.ReactivateAccountTx(ctx, statusArg)
+		require.NoError(t, err)
+		events = listEvents(AggregateTypeAccount, account1.ID)
+		var types []string
+		for _, event := range events {
+			types = append(types, event.EventType)
+		}
+		require.Equal(t, []string{EventAccountFrozen, EventAccountUnfrozen, EventAccountDormant, EventAccountReactivated}, types)
+		var statusPayload AccountStatusEvent
+		require.NoError(t, json.Unmarshal(events[0].Payload, &statusPayload))
+		require.Equal(t, AccountStatusEvent{
+			AccountID:  account1.ID,
+			Owner:      account1.Owner,
+			FromStatus: AccountStatusActive,
+			ToStatus:   AccountStatusFrozen,
+			Reason:     "aml review",
+			Actor:      "compliance",
+			Balance:    account1.Balance - 100 + 40 - 10 + 5,
+			Currency:   util.USD,
+		}, statusPayload)
+
+		// closing sweeps the balance (transfer.created) and then closes the account
+		closed, err := store.CloseAccountTx(ctx, CloseAccountTxParams{AccountID: account1.ID, DestinationAccountID: account2.ID, Reason: "customer request"})
+		require.NoError(t, err)
+		require.Len(t, listEvents(AggregateTypeTransfer, closed.Sweep.Transfer.ID), 1)
+		events = listEvents(AggregateTypeAccount, account1.ID)
+		require.Equal(t, EventAccountClosed, events[len(events)-1].EventType)
+	})
+
+	t.Run("RelayOutboxTx", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		// the outbox may hold events of other tests, drain it first
+		for {
+			result, err := store.RelayOutboxTx(ctx, 0, func(ctx context.Context, event OutboxEvent) error { return nil })
+			require.NoError(t, err)
+			if len(result.Sent) == 0 {
+				break
+			}
+		}
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		var transferIDs []int64
+		for i := 0; i < 3; i++ {
+			result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+			require.NoError(t, err)
+			transferIDs = append(transferIDs, result.Transfer.ID)
+		}
+		eventID := func(transferID int64) int64 {
+			events, err := store.ListOutboxEvents(ctx, ListOutboxEventsParams{AggregateType: AggregateTypeTransfer, AggregateID: transferID})
+			require.NoError(t, err)
+			require.Len(t, events, 1)
+			return events[0].ID
+		}
+		failing := eventID(transferIDs[1])
+
+		var published []int64
+		publishErr := errors.New("broker unavailable")
+		result, err := store.RelayOutboxTx(ctx, 1000, func(ctx context.Context, event OutboxEvent) error {
+			if event.ID == failing {
+				return publishErr
+			}
+			published = append(published, event.ID)
+			return nil
+		})
+		require.ErrorIs(t, err, ErrPublishFailed)
+		require.ErrorIs(t, err, publishErr)
+		require.NotNil(t, result.Failed)
+		require.Equal(t, failing, result.Failed.ID)
+		require.Equal(t, []int64{eventID(transferIDs[0])}, published)
+
+		event, err := store.GetOutboxEvent(ctx, failing)
+		require.NoError(t, err)
+		require.False(t, event.SentAt.Valid)
+		require.Equal(t, int32(1), event.Attempts)
+		require.Equal(t, "broker unavailable", event.LastError)
+		event, err = store.GetOutboxEvent(ctx, eventID(transferIDs[0]))
+		require.NoError(t, err)
+		require.True(t, event.SentAt.Valid)
+		require.Equal(t, int32(1), event.Attempts)
+
+		// the next run retries the failed event, then continues in order
+		published = nil
+		for {
+			result, err = store.RelayOutboxTx(ctx, 1, func(ctx context.Context, event OutboxEvent) error {
+				published = append(published, event.ID)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Nil(t, result.Failed)
+			if len(result.Sent) == 0 {
+				break
+			}
+			require.Len(t, result.Sent, 1)
+		}
+		// the batch stopped at the failure, so the order is kept
+		require.Equal(t, []int64{failing, eventID(transferIDs[2])}, published)
+		event, err = store.GetOutboxEvent(ctx, failing)
+		require.NoError(t, err)
+		require.True(t, event.SentAt.Valid)
+		require.Equal(t, int32(2), event.Attempts)
+		require.Empty(t, event.LastError)
+	})
+
+	t.Run("RelayOutboxTxPoisonEvent", func(t *testing.T) {
+		store := newStore(t, WithOutboxMaxAttempts(2))
+		ctx := context.Background()
+		for {
+			result, err := store.RelayOutboxTx(ctx, 0, func(ctx context.Context, event OutboxEvent) error { return nil })
+			require.NoError(t, err)
+			if len(result.Sent) == 0 {
+				break
+			}
+		}
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		var eventIDs []int64
+		for i := 0; i < 3; i++ {
+			result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+			require.NoError(t, err)
+			events, err := store.ListOutboxEvents(ctx, ListOutboxEventsParams{AggregateType: AggregateTypeTransfer, AggregateID: result.Transfer.ID})
+			require.NoError(t, err)
+			eventIDs = append(eventIDs, events[0].ID)
+		}
+		poison := eventIDs[0]
+		var published []int64
+		publish := func(ctx context.Context, event OutboxEvent) error {
+			if event.ID == poison {
+				return errors.New("malformed payload")
+			}
+			published = append(published, event.ID)
+			return nil
+		}
+
+		// the first rejection holds the batch back, as usual
+		result, err := store.RelayOutboxTx(ctx, 1000, publish)
+		require.ErrorIs(t, err, ErrPublishFailed)
+		require.Equal(t, poison, result.Failed.ID)
+		require.Empty(t, published)
+
+		// the last one gives up on the event, the others go out in the same batch
+		result, err = store.RelayOutboxTx(ctx, 1000, publish)
+		require.NoError(t, err)
+		require.Nil(t, result.Failed)
+		require.Len(t, result.Dead, 1)
+		require.Equal(t, poison, result.Dead[0].ID)
+		require.Equal(t, eventIDs[1:], published)
+
+		event, err := store.GetOutboxEvent(ctx, poison)
+		require.NoError(t, err)
+		require.True(t, event.FailedAt.Valid)
+		require.False(t, event.SentAt.Valid)
+		require.Equal(t, int32(2), event.Attempts)
+		require.Equal(t, "malformed payload", event.LastError)
+
+		// and it is never offered again
+		result, err = store.RelayOutboxTx(ctx, 1000, publish)
+		require.NoError(t, err)
+		require.Empty(t, result.Sent)
+		require.Empty(t, result.Dead)
+	})
+
+	t.Run("Webhooks", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+		transfer, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD})
+		require.NoError(t, err)
+		events, err := store.ListOutboxEvents(ctx, ListOutboxEventsParams{AggregateType: AggregateTypeTransfer, AggregateID: transfer.Transfer.ID})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+
+		endpoint, err := store.CreateWebhookEndpoint(ctx, CreateWebhookEndpointParams{
+			Owner:               account1.Owner,
+			Url:                 "https://example.com/hooks",
+			Secret:              util.RandomString(32),
+			EventTypes:          []string{EventTransferCreated, EventAccountFrozen},
+			LowBalanceThreshold: 100,
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{EventTransferCreated, EventAccountFrozen}, endpoint.EventTypes)
+		got, err := store.GetWebhookEndpoint(ctx, endpoint.ID)
+		require.NoError(t, err)
+		require.Equal(t, endpoint, got)
+		_, err = store.CreateWebhookEndpoint(ctx, CreateWebhookEndpointParams{Owner: util.RandomString(10), Url: "https://example.com", EventTypes: []string{}})
+		requireForeignKeyViolation(t, err)
+
+		endpoints, err := store.ListWebhookEndpoints(ctx, account1.Owner)
+		require.NoError(t, err)
+		require.Equal(t, []WebhookEndpoint{endpoint}, endpoints)
+		endpoints, err = store.ListWebhookEndpointsForEvent(ctx, ListWebhookEndpointsForEventParams{Owner: account1.Owner, EventType: EventAccountFrozen})
+		require.NoError(t, err)
+		require.Equal(t, []WebhookEndpoint{endpoint}, endpoints)
+		endpoints, err = store.ListWebhookEndpointsForEvent(ctx, ListWebhookEndpointsForEventParams{Owner: account1.Owner, EventType: EventAccountClosed})
+		require.NoError(t, err)
+		require.Empty(t, endpoints)
+
+		// one delivery per endpoint, event and type
+		now := time.Now().Truncate(time.Microsecond)
+		arg := CreateWebhookDeliveryParams{
+			EndpointID:    endpoint.ID,
+			EventID:       events[0].ID,
+			EventType:     EventTransferCreated,
+			Payload:       []byte(`{"type":"transfer.created"}`),
+			NextAttemptAt: now,
+		}
+		n, err := store.CreateWebhookDelivery(ctx, arg)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, n)
+		n, err = store.CreateWebhookDelivery(ctx, arg)
+		require.NoError(t, err)
+		require.Zero(t, n)
+		deliveries, err := store.ListWebhookDeliveries(ctx, ListWebhookDeliveriesParams{EndpointID: endpoint.ID, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		delivery := deliveries[0]
+		require.Equal(t, WebhookDeliveryPending, delivery.Status)
+		require.Zero(t, delivery.Attempts)
+		require.True(t, delivery.NextAttemptAt.Equal(now))
+		require.JSONEq(t, string(arg.Payload), string(delivery.Payload))
+
+		// claiming leases the delivery
+		claimed := func(at time.Time) bool {
+			deliveries, err := store.ClaimWebhookDeliveries(ctx, ClaimWebhookDeliveriesParams{LeaseUntil: at.Add(time.Minute), Now: at, Limit: 1000})
+			require.NoError(t, err)
+			for _, d := range deliveries {
+				if d.ID == delivery.ID {
+					return true
+				}
+			}
+			return false
+		}
+		require.False(t, claimed(now.Add(-time.Second)))
+		require.True(t, claimed(now))
+		require.False(t, claimed(now))
+		require.True(t, claimed(now.Add(time.Minute)))
+
+		// the attempts go to the log, the last one allowed kills the delivery
+		record := func(errMsg string) RecordWebhookAttemptTxResult {
+			result, err := store.RecordWebhookAttemptTx(ctx, RecordWebhookAttemptTxParams{
+				DeliveryID:    delivery.ID,
+				StatusCode:    500,
+				Error:         errMsg,
+				Duration:      25 * time.Millisecond,
+				MaxAttempts:   2,
+				NextAttemptAt: now.Add(time.Hour),
+			})
+			require.NoError(t, err)
+			return result
+		}
+		result := record("unexpected status 500 Internal Server Error")
+		require.Equal(t, WebhookDeliveryPending, result.Delivery.Status)
+		require.EqualValues(t, 1, result.Delivery.Attempts)
+		require.True(t, result.Delivery.NextAttemptAt.Equal(now.Add(time.Hour)))
+		require.Equal(t, "unexpected status 500 Internal Server Error", result.Delivery.LastError)
+		require.EqualValues(t, 1, result.Attempt.Attempt)
+		require.EqualValues(t, 25, result.Attempt.DurationMs)
+		result = record("unexpected status 500 Internal Server Error")
+		require.Equal(t, WebhookDeliveryDead, result.Delivery.Status)
+		require.EqualValues(t, 2, result.Delivery.Attempts)
+		require.False(t, result.Delivery.DeliveredAt.Valid)
+		_, err = store.RecordWebhookAttemptTx(ctx, RecordWebhookAttemptTxParams{DeliveryID: delivery.ID, MaxAttempts: 2})
+		require.ErrorIs(t, err, ErrWebhookDeliveryNotPending)
+		_, err = store.RecordWebhookAttemptTx(ctx, RecordWebhookAttemptTxParams{DeliveryID: delivery.ID + 1000000, MaxAttempts: 2})
+		require.ErrorIs(t, err, ErrWebhookDeliveryNotFound)
+
+		deliveries, err = store.ListWebhookDeliveries(ctx, ListWebhookDeliveriesParams{
+			EndpointID: endpoint.ID,
+			Status:     sql.NullString{String: WebhookDeliveryPending, Valid: true},
+			Limit:      10,
+		})
+		require.NoError(t, err)
+		require.Empty(t, deliveries)
+
+		// requeueing only works on dead deliveries and starts the schedule over
+		requeued, err := store.RequeueWebhookDelivery(ctx, RequeueWebhookDeliveryParams{ID: delivery.ID, NextAttemptAt: now})
+		require.NoError(t, err)
+		require.Equal(t, WebhookDeliveryPending, requeued.Status)
+		require.Zero(t, requeued.Attempts)
+		_, err = store.RequeueWebhookDelivery(ctx, RequeueWebhookDeliveryParams{ID: delivery.ID, NextAttemptAt: now})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		result = record("")
+		require.Equal(t, WebhookDeliveryDelivered, result.Delivery.Status)
+		require.True(t, result.Delivery.DeliveredAt.Valid)
+		require.Empty(t, result.Delivery.LastError)
+
+		attempts, err := store.ListWebhookAttempts(ctx, delivery.ID)
+		require.NoError(t, err)
+		require.Len(t, attempts, 3)
+		for i, attempt := range []int32{1, 2, 1} {
+			require.Equal(t, attempt, attempts[i].Attempt)
+		}
+
+		// deleting the endpoint drops its deliveries and their attempts
+		require.NoError(t, store.DeleteWebhookEndpoint(ctx, endpoint.ID))
+		_, err = store.GetWebhookDelivery(ctx, delivery.ID)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		attempts, err = store.ListWebhookAttempts(ctx, delivery.ID)
+		require.NoError(t, err)
+		require.Empty(t, attempts)
+	})
+
+	t.Run("AuditLog", func(t *testing.T) {
+		store := newStore(t)
+		actor := "auditor-" + util.RandomString(8) // tells the rows of this test apart from the others
+		ctx := WithActor(context.Background(), actor)
+		require.Equal(t, actor, ActorFromContext(ctx))
+		require.Equal(t, SystemActor, ActorFromContext(context.Background()))
+
+		list := func(arg ListAuditLogsParams) []AuditLog {
+			arg.Actor = sql.NullString{String: actor, Valid: true}
+			arg.Limit = 100
+			logs, err := store.ListAuditLogs(ctx, arg)
+			require.NoError(t, err)
+			return logs
+		}
+		requireRow := func(log AuditLog, action, targetType, targetID string, accountIDs []int64, before, after any) {
+			require.Equal(t, actor, log.Actor)
+			require.Equal(t, action, log.Action)
+			require.Equal(t, targetType, log.TargetType)
+			require.Equal(t, targetID, log.TargetID)
+			require.Equal(t, accountIDs, log.AccountIds)
+			for _, c := range []struct {
+				want any
+				got  json.RawMessage
+			}{{before, log.Before}, {after, log.After}} {
+				want, err := json.Marshal(c.want)
+				require.NoError(t, err)
+				require.JSONEq(t, string(want), string(c.got))
+			}
+		}
+
+		user, err := store.CreateUser(ctx, CreateUserParams{
+			Username:       util.RandomString(10),
+			HashedPassword: util.RandomString(60),
+			FullName:       util.RandomOwner(),
+			Email:          util.RandomEmail(),
+		})
+		require.NoError(t, err)
+		account1, err := store.CreateAccount(ctx, CreateAccountParams{Owner: user.Username, Balance: 100, Currency: util.USD})
+		require.NoError(t, err)
+		account2 := createRandomStoreAccount(t, store, util.USD) // recorded as made by SystemActor
+		logs := list(ListAuditLogsParams{})
+		require.Len(t, logs, 2)
+		redacted := user
+		redacted.HashedPassword = "" // the hash stays out of the log
+		requireRow(logs[0], AuditActionCreate, AuditTargetUser, user.Username, []int64{}, nil, redacted)
+		require.NotContains(t, string(logs[0].After), user.HashedPassword)
+		requireRow(logs[1], AuditActionCreate, AuditTargetAccount, fmt.Sprint(account1.ID), []int64{account1.ID}, nil, account1)
+		logs, err = store.ListAuditLogs(ctx, ListAuditLogsParams{AccountID: sql.NullInt64{Int64: account2.ID, Valid: true}, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, logs, 1)
+		require.Equal(t, SystemActor, logs[0].Actor)
+
+		updated, err := store.UpdateAccount(ctx, UpdateAccountParams{ID: account2.ID, Balance: 50})
+		require.NoError(t, err)
+		logs = list(ListAuditLogsParams{AccountID: sql.NullInt64{Int64: account2.ID, Valid: true}})
+		require.Len(t, logs, 1)
+		requireRow(logs[0], AuditActionUpdate, AuditTargetAccount, fmt.Sprint(account2.ID), []int64{account2.ID}, account2, updated)
+
+		// every write of a canned transaction is recorded, with the actor of the context
+		afterUpdate := logs[0].CreatedAt
+		time.Sleep(10 * time.Millisecond) // the transfer must come strictly after afterUpdate
+		result, err := store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 30, Currency: util.USD})
+		require.NoError(t, err)
+		logs = list(ListAuditLogsParams{FromTime: sql.NullTime{Time: afterUpdate, Valid: true}})
+		require.Len(t, logs, 5)
+		transferID := fmt.Sprint(result.Transfer.ID)
+		requireRow(logs[0], AuditActionCreate, AuditTargetTransfer, transferID, []int64{account1.ID, account2.ID}, nil, result.Transfer)
+		requireRow(logs[1], AuditActionCreate, AuditTargetEntry, fmt.Sprint(result.FromEntry.ID), []int64{account1.ID}, nil, result.FromEntry)
+		requireRow(logs[2], AuditActionCreate, AuditTargetEntry, fmt.Sprint(result.ToEntry.ID), []int64{account2.ID}, nil, result.ToEntry)
+		// the balances are updated in account id order
+		requireRow(logs[3], AuditActionAddBalance, AuditTargetAccount, fmt.Sprint(account1.ID), []int64{account1.ID}, account1, result.FromAccount)
+		requireRow(logs[4], AuditActionAddBalance, AuditTargetAccount, fmt.Sprint(account2.ID), []int64{account2.ID}, updated, result.ToAccount)
+		require.Len(t, list(ListAuditLogsParams{ToTime: sql.NullTime{Time: afterUpdate, Valid: true}}), 3)
+		require.Len(t, list(ListAuditLogsParams{AccountID: sql.NullInt64{Int64: account1.ID, Valid: true}}), 4) // creation, transfer, entry, balance
+
+		// rejected writes leave no trace
+		_, err = store.TransferTx(ctx, TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 1000, Currency: util.USD})
+		require.ErrorIs(t, err, ErrInsufficientFunds)
+		_, err = store.UpdateAccount(ctx, UpdateAccountParams{ID: -1, Balance: 10})
+		require.ErrorIs(t, err, sql.ErrNoRows)
+		require.NoError(t, store.DeleteAccount(ctx, -1))
+		require.Len(t, list(ListAuditLogsParams{}), 8)
+
+		account3, err := store.CreateAccount(ctx, CreateAccountParams{Owner: user.Username, Balance: 0, Currency: util.EUR})
+		require.NoError(t, err)
+		require.NoError(t, store.DeleteAccount(ctx, account3.ID))
+		logs = list(ListAuditLogsParams{AccountID: sql.NullInt64{Int64: account3.ID, Valid: true}})
+		require.Len(t, logs, 2)
+		requireRow(logs[1], AuditActionDelete, AuditTargetAccount, fmt.Sprint(account3.ID), []int64{account3.ID}, account3, nil)
+
+		require.Len(t, list(ListAuditLogsParams{}), 10)
+	})
+
+	t.Run("TransferTxWholeBalance", func(t *testing.T) {
+		store := newStore(t)
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
+
+		result, err := store.TransferTx(context.Background(), TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: account1.Balance, Currency: util.USD})
+		require.NoError(t, err)
+		require.Zero(t, result.FromAccount.Balance)
+	})
+}
+
+// accounts start with at least 1000 so the transfer tests never run out of funds
+// every account gets an owner of its own, so any number of accounts can share a currency
+func createRandomStoreAccount(t *testing.T, store Store, currency string) Account {
+	account, err := store.CreateAccount(context.Background(), CreateAccountParams{
+		Owner:    createRandomStoreUser(t, store).Username,
+		Balance:  1000 + util.RandomMoney(),
+		Currency: currency,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, account.ID)
+	require.NotZero(t, account.CreatedAt)
+	return account
+}
+
+// the hash isn't a real bcrypt hash (hashing is slow on purpose), these users can't log in
+func createRandomStoreUser(t *testing.T, store Store) User {
+	user, err := store.CreateUser(context.Background(), CreateUserParams{
+		Username:       util.RandomString(10),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomString(10) + "@email.com",
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func requireForeignKeyViolation(t *testing.T, err error) {
+	var pqErr *pq.Error
+	require.True(t, errors.As(err, &pqErr), "expected *pq.Error, got %v", err)
+	require.Equal(t, pq.ErrorCode("23503"), pqErr.Code)
+}
+
+func requireUniqueViolation(t *testing.T, err error) {
+	var pqErr *pq.Error
+	require.True(t, errors.As(err, &pqErr), "expected *pq.Error, got %v", err)
+	require.Equal(t, pq.ErrorCode("23505"), pqErr.Code)
+}
@@ -5,14 +5,15 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/harshaljanjani/cashflow.net/db/util"
 	"github.com/stretchr/testify/require"
 )
 
 func TestTransferTx(t *testing.T) {
 	store := NewStore(testDB)
 
-	account1 := createRandomAccount(t)
-	account2 := createRandomAccount(t)
+	account1 := createRandomStoreAccount(t, store, util.USD)
+	account2 := createRandomStoreAccount(t, store, util.USD)
 	// concurrency control: best practice to run concurrent co-routines
 	// writing logs (before)
 	fmt.Println(">> before:", account1.Balance, account2.Balance)
@@ -30,6 +31,7 @@ func TestTransferTx(t *testing.T) {
 				FromAccountID: account1.ID,
 				ToAccountID: account2.ID,
 				Amount: amount,
+				Currency: util.USD,
 			})
 			errs <- err
 			results <- result
@@ -125,8 +127,8 @@ func TestTransferTx(t *testing.T) {
 	func TestTransferTxDeadlock(t *testing.T) {
 		store := NewStore(testDB)
 	
-		account1 := createRandomAccount(t)
-		account2 := createRandomAccount(t)
+		account1 := createRandomStoreAccount(t, store, util.USD)
+		account2 := createRandomStoreAccount(t, store, util.USD)
 		// concurrency control: best practice to run concurrent co-routines
 		// writing logs (before)
 		fmt.Println(">> before:", account1.Balance, account2.Balance)
@@ -150,6 +152,7 @@ func TestTransferTx(t *testing.T) {
 					FromAccountID: fromAccountID,
 					ToAccountID: toAccountID,
 					Amount: amount,
+					Currency: util.USD,
 				})
 				errs <- err
 				// send error back to the main go routine and check from there
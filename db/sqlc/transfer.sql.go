@@ -7,26 +7,84 @@ package db
 
 import (
 	"context"
+	"database/sql"
 )
 
+const createFXTransfer = `-- name: CreateFXTransfer :one
+INSERT INTO transfers (
+  from_account_id,
+  to_account_id,
+  amount,
+  currency,
+  converted_amount,
+  converted_currency,
+  exchange_rate
+) VALUES (
+  $1, $2, $3, $4, $5::bigint, $6::varchar, $7::numeric
+) RETURNING id, from_account_id, to_account_id, amount, created_at, currency, reversal_of, converted_amount, converted_currency, exchange_rate
+`
+
+type CreateFXTransferParams struct {
+	FromAccountID     int64  `json:"from_account_id"`
+	ToAccountID       int64  `json:"to_account_id"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	ConvertedAmount   int64  `json:"converted_amount"`
+	ConvertedCurrency string `json:"converted_currency"`
+	ExchangeRate      string `json:"exchange_rate"`
+}
+
+func (q *Queries) CreateFXTransfer(ctx context.Context, arg CreateFXTransferParams) (Transfer, error) {
+	row := q.db.QueryRowContext(ctx, createFXTransfer,
+		arg.FromAccountID,
+		arg.ToAccountID,
+		arg.Amount,
+		arg.Currency,
+		arg.ConvertedAmount,
+		arg.ConvertedCurrency,
+		arg.ExchangeRate,
+	)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Currency,
+		&i.ReversalOf,
+		&i.ConvertedAmount,
+		&i.ConvertedCurrency,
+		&i.ExchangeRate,
+	)
+	return i, err
+}
+
 const createTransfer = `-- name: CreateTransfer :one
 INSERT INTO transfers (
   from_account_id,
   to_account_id,
-  amount
+  amount,
+  currency
 ) VALUES (
-  $1, $2, $3
-) RETURNING id, from_account_id, to_account_id, amount, created_at
+  $1, $2, $3, $4
+) RETURNING id, from_account_id, to_account_id, amount, created_at, currency, reversal_of, converted_amount, converted_currency, exchange_rate
 `
 
 type CreateTransferParams struct {
-	FromAccountID int64 `json:"from_account_id"`
-	ToAccountID   int64 `json:"to_account_id"`
-	Amount        int64 `json:"amount"`
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
 }
 
-func (q *Queries) CreateTransfer(ctx context.Context, arg TransferTxParams) (Transfer, error) {
-	row := q.db.QueryRowContext(ctx, createTransfer, arg.FromAccountID, arg.ToAccountID, arg.Amount)
+func (q *Queries) CreateTransfer(ctx context.Context, arg CreateTransferParams) (Transfer, error) {
+	row := q.db.QueryRowContext(ctx, createTransfer,
+		arg.FromAccountID,
+		arg.ToAccountID,
+		arg.Amount,
+		arg.Currency,
+	)
 	var i Transfer
 	err := row.Scan(
 		&i.ID,
@@ -34,12 +92,61 @@ func (q *Queries) CreateTransfer(ctx context.Context, arg TransferTxParams) (Tra
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.Currency,
+		&i.ReversalOf,
+		&i.ConvertedAmount,
+		&i.ConvertedCurrency,
+		&i.ExchangeRate,
+	)
+	return i, err
+}
+
+const createTransferReversal = `-- name: CreateTransferReversal :one
+INSERT INTO transfers (
+  from_account_id,
+  to_account_id,
+  amount,
+  currency,
+  reversal_of
+) VALUES (
+  $1, $2, $3, $4, $5::bigint
+) RETURNING id, from_account_id, to_account_id, amount, created_at, currency, reversal_of, converted_amount, converted_currency, exchange_rate
+`
+
+type CreateTransferReversalParams struct {
+	FromAccountID int64  `json:"from_account_id"`
+	ToAccountID   int64  `json:"to_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	ReversalOf    int64  `json:"reversal_of"`
+}
+
+func (q *Queries) CreateTransferReversal(ctx context.Context, arg CreateTransferReversalParams) (Transfer, error) {
+	row := q.db.QueryRowContext(ctx, createTransferReversal,
+		arg.FromAccountID,
+		arg.ToAccountID,
+		arg.Amount,
+		arg.Currency,
+		arg.ReversalOf,
+	)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Currency,
+		&i.ReversalOf,
+		&i.ConvertedAmount,
+		&i.ConvertedCurrency,
+		&i.ExchangeRate,
 	)
 	return i, err
 }
 
 const getTransfer = `-- name: GetTransfer :one
-SELECT id, from_account_id, to_account_id, amount, created_at FROM transfers
+SELECT id, from_account_id, to_account_id, amount, created_at, currency, reversal_of, converted_amount, converted_currency, exchange_rate FROM transfers
 WHERE id = $1 LIMIT 1
 `
 
@@ -52,6 +159,145 @@ func (q *Queries) GetTransfer(ctx context.Context, id int64) (Transfer, error) {
 		&i.ToAccountID,
 		&i.Amount,
 		&i.CreatedAt,
+		&i.Currency,
+		&i.ReversalOf,
+		&i.ConvertedAmount,
+		&i.ConvertedCurrency,
+		&i.ExchangeRate,
 	)
 	return i, err
-}
\ No newline at end of file
+}
+
+const getTransferForUpdate = `-- name: GetTransferForUpdate :one
+SELECT id, from_account_id, to_account_id, amount, created_at, currency, reversal_of, converted_amount, converted_currency, exchange_rate FROM transfers
+WHERE id = $1 LIMIT 1
+FOR NO KEY UPDATE
+`
+
+func (q *Queries) GetTransferForUpdate(ctx context.Context, id int64) (Transfer, error) {
+	row := q.db.QueryRowContext(ctx, getTransferForUpdate, id)
+	var i Transfer
+	err := row.Scan(
+		&i.ID,
+		&i.FromAccountID,
+		&i.ToAccountID,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Currency,
+		&i.ReversalOf,
+		&i.ConvertedAmount,
+		&i.ConvertedCurrency,
+		&i.ExchangeRate,
+	)
+	return i, err
+}
+
+const listTransferReversals = `-- name: ListTransferReversals :many
+SELECT id, from_account_id, to_account_id, amount, created_at, currency, reversal_of, converted_amount, converted_currency, exchange_rate FROM transfers
+WHERE reversal_of = $1::bigint
+ORDER BY id
+`
+
+func (q *Queries) ListTransferReversals(ctx context.Context, transferID int64) ([]Transfer, error) {
+	rows, err := q.db.QueryContext(ctx, listTransferReversals, transferID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Transfer
+	for rows.Next() {
+		var i Transfer
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromAccountID,
+			&i.ToAccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.ReversalOf,
+			&i.ConvertedAmount,
+			&i.ConvertedCurrency,
+			&i.ExchangeRate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTransfers = `-- name: ListTransfers :many
+SELECT id, from_account_id, to_account_id, amount, created_at, currency, reversal_of, converted_amount, converted_currency, exchange_rate FROM transfers
+WHERE ($1::bigint IS NULL
+    OR ($2::varchar IS DISTINCT FROM 'in' AND from_account_id = $1)
+    OR ($2 IS DISTINCT FROM 'out' AND to_account_id = $1))
+  AND ($3::bigint IS NULL OR amount >= $3)
+  AND ($4::bigint IS NULL OR amount <= $4)
+  AND ($5::timestamptz IS NULL OR created_at > $5)
+  AND ($6::timestamptz IS NULL OR created_at <= $6)
+  AND ($7::timestamptz IS NULL OR (created_at, id) > ($7, $8::bigint))
+ORDER BY created_at, id
+LIMIT $9
+`
+
+type ListTransfersParams struct {
+	AccountID       sql.NullInt64  `json:"account_id"`
+	Direction       sql.NullString `json:"direction"`
+	MinAmount       sql.NullInt64  `json:"min_amount"`
+	MaxAmount       sql.NullInt64  `json:"max_amount"`
+	FromTime        sql.NullTime   `json:"from_time"`
+	ToTime          sql.NullTime   `json:"to_time"`
+	CursorCreatedAt sql.NullTime   `json:"cursor_created_at"`
+	CursorID        sql.NullInt64  `json:"cursor_id"`
+	Limit           int32          `json:"limit"`
+}
+
+func (q *Queries) ListTransfers(ctx context.Context, arg ListTransfersParams) ([]Transfer, error) {
+	rows, err := q.db.QueryContext(ctx, listTransfers,
+		arg.AccountID,
+		arg.Direction,
+		arg.MinAmount,
+		arg.MaxAmount,
+		arg.FromTime,
+		arg.ToTime,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Transfer
+	for rows.Next() {
+		var i Transfer
+		if err := rows.Scan(
+			&i.ID,
+			&i.FromAccountID,
+			&i.ToAccountID,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.ReversalOf,
+			&i.ConvertedAmount,
+			&i.ConvertedCurrency,
+			&i.ExchangeRate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
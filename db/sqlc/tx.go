@@ -0,0 +1,161 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ANSI isolation levels supported by postgres
+// (read-uncommitted behaves exactly like read-committed in postgres, so it is not exposed)
+const (
+	ReadCommitted  = sql.LevelReadCommitted
+	RepeatableRead = sql.LevelRepeatableRead
+	Serializable   = sql.LevelSerializable
+)
+
+// postgres error codes that mean "run the whole transaction again"
+const (
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+)
+
+// RetryPolicy decides how often a transaction is retried after a serialization failure or deadlock
+type RetryPolicy struct {
+	MaxAttempts int           `json:"max_attempts"` // total attempts including the first one (<= 1 means no retry)
+	BaseDelay   time.Duration `json:"base_delay"`   // backoff before the second attempt, doubled after every failed attempt
+	MaxDelay    time.Duration `json:"max_delay"`    // upper bound of a single backoff
+}
+
+// DefaultRetryPolicy is used by NewStore unless overridden with WithTxOptions
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    500 * time.Millisecond,
+}
+
+// TxOptions configures a unit of work executed with ExecTx
+type TxOptions struct {
+	Isolation sql.IsolationLevel // sql.LevelDefault keeps the server default (read-committed)
+	ReadOnly  bool
+	Retry     RetryPolicy
+}
+
+// IsRetryableTxError reports whether err is a serialization failure (40001) or a deadlock (40P01),
+// in which case postgres has already aborted the transaction and it is safe to run it again
+func IsRetryableTxError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == serializationFailureCode || pqErr.Code == deadlockDetectedCode
+}
+
+// backoff returns a jittered delay before the next attempt (full jitter: random value in [0, min(max, base*2^(attempt-1))])
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// ExecTx executes fn within a database transaction using the given isolation level
+// retryable errors (see IsRetryableTxError) roll the transaction back and run fn again with a fresh transaction,
+// so fn must not keep side effects outside of the queries it is given
+// returns the number of attempts that were made together with the error of the last attempt
+// the ledger writes of fn are recorded in the audit log, like those of the canned transactions (see auditQueries)
+func (store *SQLStore) ExecTx(ctx context.Context, opts TxOptions, fn func(Querier) error) (int, error) {
+	maxAttempts := opts.Retry.MaxAttempts
+	if maxAttempts < 1 || store.tx != nil {
+		// a failed attempt aborts the enclosing transaction of a dry run, there is nothing to retry
+		maxAttempts = 1
+	}
+	txOpts := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = store.runTx(ctx, txOpts, fn)
+		if err == nil || !IsRetryableTxError(err) || attempt >= maxAttempts {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, fmt.Errorf("%w (retry aborted: %v)", err, ctx.Err())
+		case <-time.After(opts.Retry.backoff(attempt)):
+		}
+	}
+}
+
+// runTx runs a single attempt of fn
+// 1) start new db transaction
+// 2) create a new audited Queries object with that transaction
+// 3) call the callback function with the created queries
+// 4) commit or rollback based on error returned
+func (store *SQLStore) runTx(ctx context.Context, txOpts *sql.TxOptions, fn func(Querier) error) error {
+	if store.tx != nil {
+		return store.savepoint(ctx, false, func() error { return fn(auditQueries{store.sqlQueries}) })
+	}
+	tx, err := store.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return err
+	}
+	err = fn(auditQueries{New(tx)})
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("tx err %w, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// DryRun runs fn with a Store bound to a single transaction that is always rolled back:
+// fn sees its own writes (and canned transactions behave as usual, each in a savepoint) but nothing is committed
+// ids handed out by the sequences are consumed anyway, like with any rolled back transaction
+// returns the error of fn
+func (store *SQLStore) DryRun(ctx context.Context, fn func(Store) error) error {
+	if store.tx != nil {
+		return store.savepoint(ctx, true, func() error { return fn(store) })
+	}
+	tx, err := store.db.BeginTx(ctx, &sql.TxOptions{Isolation: store.config.txOptions.Isolation})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(&SQLStore{sqlQueries: New(tx), tx: tx, config: store.config})
+}
+
+// savepoint runs fn inside a savepoint of the dry run transaction
+// the savepoint is rolled back when fn fails or when rollback is set, released otherwise
+func (store *SQLStore) savepoint(ctx context.Context, rollback bool, fn func() error) error {
+	if _, err := store.tx.ExecContext(ctx, "SAVEPOINT dry_run"); err != nil {
+		return err
+	}
+	err := fn()
+	if err != nil || rollback {
+		if _, rbErr := store.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT dry_run"); rbErr != nil {
+			if err == nil {
+				return rbErr
+			}
+			return fmt.Errorf("tx err %w, rb err: %v", err, rbErr)
+		}
+		if _, relErr := store.tx.ExecContext(ctx, "RELEASE SAVEPOINT dry_run"); relErr != nil && err == nil {
+			return relErr
+		}
+		return err
+	}
+	_, err = store.tx.ExecContext(ctx, "RELEASE SAVEPOINT dry_run")
+	return err
+}
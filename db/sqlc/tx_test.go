@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryableTxError(t *testing.T) {
+	require.True(t, IsRetryableTxError(&pq.Error{Code: "40001"}))
+	require.True(t, IsRetryableTxError(&pq.Error{Code: "40P01"}))
+	// wrapped errors (e.g. rollback failures) are still recognised
+	require.True(t, IsRetryableTxError(fmt.Errorf("tx err %w", &pq.Error{Code: "40001"})))
+
+	require.False(t, IsRetryableTxError(&pq.Error{Code: "23503"})) // foreign key violation
+	require.False(t, IsRetryableTxError(errors.New("40001")))
+	require.False(t, IsRetryableTxError(nil))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for attempt := 1; attempt < 10; attempt++ {
+		delay := policy.backoff(attempt)
+		require.GreaterOrEqual(t, delay, time.Duration(0))
+		require.LessOrEqual(t, delay, policy.MaxDelay)
+	}
+	require.Zero(t, RetryPolicy{}.backoff(3))
+}
+
+func TestExecTxRetriesSerializationFailure(t *testing.T) {
+	store := NewSQLStore(testDB)
+	opts := TxOptions{
+		Isolation: Serializable,
+		Retry:     RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+	}
+
+	calls := 0
+	attempts, err := store.ExecTx(context.Background(), opts, func(q Querier) error {
+		calls++
+		if calls < 3 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 3, calls)
+
+	// non-retryable errors are returned after the first attempt
+	errNotRetryable := errors.New("not retryable")
+	attempts, err = store.ExecTx(context.Background(), opts, func(q Querier) error {
+		return errNotRetryable
+	})
+	require.ErrorIs(t, err, errNotRetryable)
+	require.Equal(t, 1, attempts)
+}
+
+// the writes of ExecTx are audited like those of the canned transactions
+func TestExecTxAudit(t *testing.T) {
+	store := NewSQLStore(testDB)
+	actor := util.RandomOwner()
+	ctx := WithActor(context.Background(), actor)
+
+	var account Account
+	_, err := store.ExecTx(ctx, TxOptions{}, func(q Querier) error {
+		var err error
+		account, err = q.CreateAccount(ctx, CreateAccountParams{Owner: createRandomUser(t).Username, Currency: util.USD})
+		return err
+	})
+	require.NoError(t, err)
+
+	logs, err := store.ListAuditLogs(ctx, ListAuditLogsParams{Actor: sql.NullString{String: actor, Valid: true}, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, AuditActionCreate, logs[0].Action)
+	require.Equal(t, []int64{account.ID}, logs[0].AccountIds)
+}
+
+// concurrent transfers between the same pair of accounts at SERIALIZABLE isolation
+// conflicting transactions fail with 40001 and are transparently retried
+func TestTransferTxSerializable(t *testing.T) {
+	store := NewStore(testDB, WithTxOptions(TxOptions{
+		Isolation: Serializable,
+		Retry:     RetryPolicy{MaxAttempts: 20, BaseDelay: 5 * time.Millisecond, MaxDelay: 100 * time.Millisecond},
+	}))
+
+	account1 := createRandomStoreAccount(t, store, util.USD)
+	account2 := createRandomStoreAccount(t, store, util.USD)
+
+	n := 10
+	amount := int64(10)
+	errs := make(chan error)
+	for i := 0; i < n; i++ {
+		fromAccountID, toAccountID := account1.ID, account2.ID
+		if i%2 == 1 {
+			fromAccountID, toAccountID = account2.ID, account1.ID
+		}
+		go func() {
+			_, err := store.TransferTx(context.Background(), TransferTxParams{
+				FromAccountID: fromAccountID,
+				ToAccountID:   toAccountID,
+				Amount:        amount,
+				Currency:      util.USD,
+			})
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	updatedAccount1, err := testQueries.GetAccount(context.Background(), account1.ID)
+	require.NoError(t, err)
+	updatedAccount2, err := testQueries.GetAccount(context.Background(), account2.ID)
+	require.NoError(t, err)
+	require.Equal(t, account1.Balance, updatedAccount1.Balance)
+	require.Equal(t, account2.Balance, updatedAccount2.Balance)
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/harshaljanjani/cashflow.net/db/util"
+)
+
+// input params of RegisterUser
+type RegisterUserParams struct {
+	Username string `json:"username"`
+	Password string `json:"password"` // plain text, only its bcrypt hash is stored
+	FullName string `json:"full_name"`
+	Email    string `json:"email"`
+}
+
+// RegisterUser hashes the password and creates the user, a password over util.MaxPasswordBytes returns ErrPasswordTooLong
+// a taken username or email returns the *pq.Error of the unique violation (code 23505)
+func (store *SQLStore) RegisterUser(ctx context.Context, arg RegisterUserParams) (User, error) {
+	return registerUser(ctx, store, arg)
+}
+
+// AuthenticateUser returns the user if the password matches, ErrInvalidCredentials otherwise
+// an unknown username gives the same error as a wrong password
+func (store *SQLStore) AuthenticateUser(ctx context.Context, username, password string) (User, error) {
+	return authenticateUser(ctx, store, username, password)
+}
+
+// hashing is slow on purpose, q doesn't need to be (and shouldn't be) bound to a transaction
+func registerUser(ctx context.Context, q Querier, arg RegisterUserParams) (User, error) {
+	if len(arg.Password) > util.MaxPasswordBytes {
+		return User{}, ErrPasswordTooLong
+	}
+	hashedPassword, err := util.HashPassword(arg.Password)
+	if err != nil {
+		return User{}, err
+	}
+	return q.CreateUser(ctx, CreateUserParams{
+		Username:       arg.Username,
+		HashedPassword: hashedPassword,
+		FullName:       arg.FullName,
+		Email:          arg.Email,
+	})
+}
+
+func authenticateUser(ctx context.Context, q Querier, username, password string) (User, error) {
+	user, err := q.GetUser(ctx, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %q", ErrInvalidCredentials, username)
+		}
+		return User{}, err
+	}
+	if err = util.CheckPassword(password, user.HashedPassword); err != nil {
+		return User{}, fmt.Errorf("%w: %q", ErrInvalidCredentials, username)
+	}
+	return user, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// statuses of a webhook delivery (webhook_deliveries.status)
+// pending: waiting for its next attempt (webhook_deliveries.next_attempt_at)
+// delivered: the endpoint accepted it, terminal
+// dead: every attempt failed, only RequeueWebhookDelivery brings it back
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// input params of the webhook attempt transaction
+type RecordWebhookAttemptTxParams struct {
+	DeliveryID int64         `json:"delivery_id"`
+	StatusCode int32         `json:"status_code"` // 0 when no response was received
+	Error      string        `json:"error"`       // empty when the endpoint accepted the delivery
+	Duration   time.Duration `json:"duration"`
+	// a failed delivery is dead once it has been attempted this many times, otherwise it is retried at NextAttemptAt
+	MaxAttempts   int32     `json:"max_attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+// output params of the webhook attempt transaction
+type RecordWebhookAttemptTxResult struct {
+	Delivery WebhookDelivery `json:"delivery"` // the delivery after the attempt
+	Attempt  WebhookAttempt  `json:"attempt"`  // the attempt log entry
+}
+
+// RecordWebhookAttemptTx logs an attempt of a pending delivery and moves the delivery on:
+// delivered when arg.Error is empty, dead when it failed arg.MaxAttempts times, rescheduled at arg.NextAttemptAt otherwise
+// fails with ErrWebhookDeliveryNotFound or ErrWebhookDeliveryNotPending (another dispatcher already finished it)
+func (store *SQLStore) RecordWebhookAttemptTx(ctx context.Context, arg RecordWebhookAttemptTxParams) (RecordWebhookAttemptTxResult, error) {
+	var result RecordWebhookAttemptTxResult
+	err := store.execTx(ctx, func(q Querier) error {
+		var err error
+		result, err = recordWebhookAttemptTx(ctx, q, arg)
+		return err
+	})
+	return result, err
+}
+
+func recordWebhookAttemptTx(ctx context.Context, q Querier, arg RecordWebhookAttemptTxParams) (result RecordWebhookAttemptTxResult, err error) {
+	delivery, err := q.GetWebhookDeliveryForUpdate(ctx, arg.DeliveryID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", ErrWebhookDeliveryNotFound, arg.DeliveryID)
+		}
+		return
+	}
+	if delivery.Status != WebhookDeliveryPending {
+		return result, fmt.Errorf("%w: delivery %d is %s", ErrWebhookDeliveryNotPending, delivery.ID, delivery.Status)
+	}
+
+	result.Attempt, err = q.CreateWebhookAttempt(ctx, CreateWebhookAttemptParams{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts + 1,
+		StatusCode: arg.StatusCode,
+		Error:      arg.Error,
+		DurationMs: arg.Duration.Milliseconds(),
+	})
+	if err != nil {
+		return
+	}
+
+	update := UpdateWebhookDeliveryParams{
+		ID:            delivery.ID,
+		Status:        WebhookDeliveryPending,
+		Attempts:      result.Attempt.Attempt,
+		NextAttemptAt: arg.NextAttemptAt,
+		LastError:     arg.Error,
+	}
+	switch {
+	case arg.Error == "":
+		update.Status = WebhookDeliveryDelivered
+		update.NextAttemptAt = delivery.NextAttemptAt
+	case update.Attempts >= arg.MaxAttempts:
+		update.Status = WebhookDeliveryDead
+		update.NextAttemptAt = delivery.NextAttemptAt
+	}
+	result.Delivery, err = q.UpdateWebhookDelivery(ctx, update)
+	return
+}
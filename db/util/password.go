@@ -0,0 +1,25 @@
+package util
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxPasswordBytes is the longest password bcrypt accepts, in bytes: a password of non-ASCII characters reaches it
+// well before 72 characters
+const MaxPasswordBytes = 72
+
+// HashPassword returns the bcrypt hash of the password (random salt included)
+func HashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hashedPassword), nil
+}
+
+// CheckPassword returns nil if password matches the bcrypt hash, bcrypt.ErrMismatchedHashAndPassword otherwise
+func CheckPassword(password string, hashedPassword string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+}
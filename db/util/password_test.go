@@ -0,0 +1,28 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPassword(t *testing.T) {
+	password := RandomString(6)
+
+	hashedPassword1, err := HashPassword(password)
+	require.NoError(t, err)
+	require.NotEmpty(t, hashedPassword1)
+	require.NoError(t, CheckPassword(password, hashedPassword1))
+
+	wrongPassword := RandomString(6)
+	require.ErrorIs(t, CheckPassword(wrongPassword, hashedPassword1), bcrypt.ErrMismatchedHashAndPassword)
+
+	// the salt is random, the same password never gives the same hash
+	hashedPassword2, err := HashPassword(password)
+	require.NoError(t, err)
+	require.NotEqual(t, hashedPassword1, hashedPassword2)
+
+	// an empty hash (users migrated from accounts.owner) never matches
+	require.Error(t, CheckPassword("", ""))
+}
@@ -36,7 +36,11 @@ func RandomMoney() int64{
 }
 // select a random currency out of a list
 func RandomCurrency() string {
-	currencies:= []string{"EUR", "USD", "CAD"}
+	currencies:= []string{EUR, USD, CAD}
 	n:= len(currencies)
 	return currencies[rand.Intn(n)]
-}
\ No newline at end of file
+}
+// generate random email
+func RandomEmail() string {
+	return RandomString(6) + "@email.com"
+}
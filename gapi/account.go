@@ -0,0 +1,76 @@
+package gapi
+
+import (
+	"context"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// new accounts always start with a zero balance, users only open accounts for themselves
+func (server *Server) CreateAccount(ctx context.Context, req *pb.CreateAccountRequest) (*pb.Account, error) {
+	if req.GetOwner() == "" {
+		return nil, status.Error(codes.InvalidArgument, "owner is required")
+	}
+	if req.GetOwner() != authPayload(ctx).Username {
+		return nil, status.Error(codes.PermissionDenied, errNotAccountOwner.Error())
+	}
+	if !util.IsSupportedCurrency(req.GetCurrency()) {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported currency %q", req.GetCurrency())
+	}
+
+	account, err := server.store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner:    req.GetOwner(),
+		Currency: req.GetCurrency(),
+		Balance:  0,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return convertAccount(account), nil
+}
+
+func (server *Server) GetAccount(ctx context.Context, req *pb.GetAccountRequest) (*pb.Account, error) {
+	account, err := server.authorizeAccount(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return convertAccount(account), nil
+}
+
+func (server *Server) ListAccounts(ctx context.Context, req *pb.ListAccountsRequest) (*pb.ListAccountsResponse, error) {
+	if req.GetOwner() == "" {
+		return nil, status.Error(codes.InvalidArgument, "owner is required")
+	}
+	if req.GetOwner() != authPayload(ctx).Username {
+		return nil, status.Error(codes.PermissionDenied, errNotAccountOwner.Error())
+	}
+	size, err := pageSize(req.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+	pageID := req.GetPageId()
+	if pageID == 0 {
+		pageID = 1
+	}
+	if pageID < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "page_id must be positive, got %d", pageID)
+	}
+
+	accounts, err := server.store.ListAccounts(ctx, db.ListAccountsParams{
+		Owner:  req.GetOwner(),
+		Limit:  size,
+		Offset: (pageID - 1) * size,
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	rsp := &pb.ListAccountsResponse{Accounts: make([]*pb.Account, len(accounts))}
+	for i, account := range accounts {
+		rsp.Accounts[i] = convertAccount(account)
+	}
+	return rsp, nil
+}
@@ -0,0 +1,97 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestCreateAccount(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	user := createRandomUser(t, store)
+	ctx := authContext(t, server, user.Username)
+
+	account, err := client.CreateAccount(ctx, &pb.CreateAccountRequest{Owner: user.Username, Currency: util.USD})
+	require.NoError(t, err)
+	require.NotZero(t, account.Id)
+	require.Equal(t, user.Username, account.Owner)
+	require.Equal(t, util.USD, account.Currency)
+	require.Zero(t, account.Balance)
+	require.Equal(t, db.AccountStatusActive, account.Status)
+
+	// the caller is the actor of the change
+	logs, err := store.ListAuditLogs(context.Background(), db.ListAuditLogsParams{
+		AccountID: sql.NullInt64{Int64: account.Id, Valid: true},
+		Limit:     10,
+	})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, user.Username, logs[0].Actor)
+
+	// one account per currency
+	_, err = client.CreateAccount(ctx, &pb.CreateAccountRequest{Owner: user.Username, Currency: util.USD})
+	requireCode(t, err, codes.AlreadyExists)
+
+	_, err = client.CreateAccount(ctx, &pb.CreateAccountRequest{Owner: createRandomUser(t, store).Username, Currency: util.EUR})
+	requireCode(t, err, codes.PermissionDenied)
+	_, err = client.CreateAccount(ctx, &pb.CreateAccountRequest{Owner: user.Username, Currency: "XYZ"})
+	requireCode(t, err, codes.InvalidArgument)
+	_, err = client.CreateAccount(ctx, &pb.CreateAccountRequest{Currency: util.USD})
+	requireCode(t, err, codes.InvalidArgument)
+}
+
+func TestGetAccount(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	account := createRandomAccount(t, store, util.USD)
+	ctx := authContext(t, server, account.Owner)
+
+	got, err := client.GetAccount(ctx, &pb.GetAccountRequest{Id: account.ID})
+	require.NoError(t, err)
+	require.Equal(t, account.ID, got.Id)
+	require.Equal(t, account.Owner, got.Owner)
+	require.Equal(t, account.Balance, got.Balance)
+	require.True(t, account.CreatedAt.Equal(got.CreatedAt.AsTime()))
+
+	_, err = client.GetAccount(ctx, &pb.GetAccountRequest{Id: account.ID + 1})
+	requireCode(t, err, codes.NotFound)
+	_, err = client.GetAccount(authContext(t, server, createRandomUser(t, store).Username), &pb.GetAccountRequest{Id: account.ID})
+	requireCode(t, err, codes.PermissionDenied)
+}
+
+func TestListAccounts(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	user := createRandomUser(t, store)
+	ctx := authContext(t, server, user.Username)
+	for _, currency := range []string{util.USD, util.EUR, util.CAD} {
+		_, err := client.CreateAccount(ctx, &pb.CreateAccountRequest{Owner: user.Username, Currency: currency})
+		require.NoError(t, err)
+	}
+	other := createRandomAccount(t, store, util.USD) // someone else's
+
+	rsp, err := client.ListAccounts(ctx, &pb.ListAccountsRequest{Owner: user.Username, PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, rsp.Accounts, 2)
+	rsp, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{Owner: user.Username, PageId: 2, PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, rsp.Accounts, 1)
+	require.Equal(t, user.Username, rsp.Accounts[0].Owner)
+
+	_, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{Owner: user.Username, PageSize: maxPageSize + 1})
+	requireCode(t, err, codes.InvalidArgument)
+	_, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{PageSize: 5})
+	requireCode(t, err, codes.InvalidArgument)
+	_, err = client.ListAccounts(ctx, &pb.ListAccountsRequest{Owner: other.Owner})
+	requireCode(t, err, codes.PermissionDenied)
+}
@@ -0,0 +1,105 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// every call needs an access token, like the REST api: "authorization: Bearer <token>" in the gRPC metadata,
+// or the Authorization header of the gateway requests
+const (
+	authorizationKey        = "authorization"
+	authorizationTypeBearer = "bearer"
+)
+
+var errNotAccountOwner = errors.New("account doesn't belong to the authenticated user")
+
+type payloadKey struct{}
+
+// authenticate verifies the authorization value of a call and returns ctx with the token payload,
+// the user also becomes the actor of the call's writes in the audit log (db.WithActor)
+func (server *Server) authenticate(ctx context.Context, authorization string) (context.Context, error) {
+	if authorization == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization is not provided")
+	}
+	fields := strings.Fields(authorization)
+	if len(fields) != 2 {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization format")
+	}
+	if authorizationType := strings.ToLower(fields[0]); authorizationType != authorizationTypeBearer {
+		return nil, status.Errorf(codes.Unauthenticated, "unsupported authorization type %s", authorizationType)
+	}
+
+	payload, err := server.tokenMaker.VerifyToken(fields[1])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if payload.Type != token.TypeAccess {
+		// refresh tokens are only good for the REST api's /tokens/refresh
+		return nil, status.Error(codes.Unauthenticated, token.ErrInvalidToken.Error())
+	}
+	ctx = context.WithValue(ctx, payloadKey{}, payload)
+	return db.WithActor(ctx, payload.Username), nil
+}
+
+// authInterceptor authenticates every unary call of the gRPC server
+func (server *Server) authInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(authorizationKey); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	ctx, err := server.authenticate(ctx, authorization)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authHandler authenticates every request of the gateway before mux serves it,
+// the failures are written like the other gateway errors
+func (server *Server) authHandler(mux *runtime.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, err := server.authenticate(r.Context(), r.Header.Get(authorizationKey))
+		if err != nil {
+			_, outbound := runtime.MarshalerForRequest(mux, r)
+			runtime.HTTPError(r.Context(), mux, outbound, w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authPayload returns the payload stored by authenticate
+func authPayload(ctx context.Context) *token.Payload {
+	return ctx.Value(payloadKey{}).(*token.Payload)
+}
+
+// authorizeAccount returns the account if it belongs to the authenticated user
+func (server *Server) authorizeAccount(ctx context.Context, id int64) (db.Account, error) {
+	// the owner never changes, so checking it outside of the transactions is safe
+	account, err := server.store.GetAccount(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", db.ErrAccountNotFound, id)
+		}
+		return db.Account{}, statusError(err)
+	}
+	if account.Owner != authPayload(ctx).Username {
+		return db.Account{}, status.Error(codes.PermissionDenied, errNotAccountOwner.Error())
+	}
+	return account, nil
+}
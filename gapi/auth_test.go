@@ -0,0 +1,54 @@
+package gapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestAuthInterceptor(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	account := createRandomAccount(t, store, util.USD)
+
+	withAuthorization := func(authorization string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), authorizationKey, authorization)
+	}
+	createToken := func(tokenType token.Type, duration time.Duration) string {
+		accessToken, _, err := server.tokenMaker.CreateToken(account.Owner, tokenType, duration)
+		require.NoError(t, err)
+		return accessToken
+	}
+
+	testCases := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"OK", withAuthorization("Bearer " + createToken(token.TypeAccess, time.Minute)), codes.OK},
+		{"NoAuthorization", context.Background(), codes.Unauthenticated},
+		{"UnsupportedType", withAuthorization("Basic " + createToken(token.TypeAccess, time.Minute)), codes.Unauthenticated},
+		{"InvalidFormat", withAuthorization(createToken(token.TypeAccess, time.Minute)), codes.Unauthenticated},
+		{"ExpiredToken", withAuthorization("Bearer " + createToken(token.TypeAccess, -time.Minute)), codes.Unauthenticated},
+		{"RefreshToken", withAuthorization("Bearer " + createToken(token.TypeRefresh, time.Minute)), codes.Unauthenticated},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.GetAccount(tc.ctx, &pb.GetAccountRequest{Id: account.ID})
+			if tc.code == codes.OK {
+				require.NoError(t, err)
+				return
+			}
+			requireCode(t, err, tc.code)
+		})
+	}
+}
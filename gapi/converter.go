@@ -0,0 +1,62 @@
+package gapi
+
+import (
+	"database/sql"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func convertAccount(account db.Account) *pb.Account {
+	return &pb.Account{
+		Id:              account.ID,
+		Owner:           account.Owner,
+		Balance:         account.Balance,
+		Currency:        account.Currency,
+		CreatedAt:       timestamppb.New(account.CreatedAt),
+		Status:          account.Status,
+		StatusReason:    account.StatusReason,
+		StatusChangedAt: timestamppb.New(account.StatusChangedAt),
+	}
+}
+
+func convertEntry(entry db.Entry) *pb.Entry {
+	return &pb.Entry{
+		Id:         entry.ID,
+		AccountId:  entry.AccountID,
+		Amount:     entry.Amount,
+		CreatedAt:  timestamppb.New(entry.CreatedAt),
+		TransferId: optionalInt64(entry.TransferID),
+	}
+}
+
+func convertTransfer(transfer db.Transfer) *pb.Transfer {
+	return &pb.Transfer{
+		Id:                transfer.ID,
+		FromAccountId:     transfer.FromAccountID,
+		ToAccountId:       transfer.ToAccountID,
+		Amount:            transfer.Amount,
+		Currency:          transfer.Currency,
+		CreatedAt:         timestamppb.New(transfer.CreatedAt),
+		ReversalOf:        optionalInt64(transfer.ReversalOf),
+		ConvertedAmount:   optionalInt64(transfer.ConvertedAmount),
+		ConvertedCurrency: optionalString(transfer.ConvertedCurrency),
+		ExchangeRate:      optionalString(transfer.ExchangeRate),
+	}
+}
+
+// NULL columns become unset optional fields
+func optionalInt64(n sql.NullInt64) *int64 {
+	if !n.Valid {
+		return nil
+	}
+	return &n.Int64
+}
+
+func optionalString(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
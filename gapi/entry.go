@@ -0,0 +1,62 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (server *Server) GetEntry(ctx context.Context, req *pb.GetEntryRequest) (*pb.Entry, error) {
+	entry, err := server.store.GetEntry(ctx, req.GetId())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, status.Errorf(codes.NotFound, "entry not found: %d", req.GetId())
+		}
+		return nil, statusError(err)
+	}
+	if _, err := server.authorizeAccount(ctx, entry.AccountID); err != nil {
+		return nil, err
+	}
+	return convertEntry(entry), nil
+}
+
+func (server *Server) ListEntries(ctx context.Context, req *pb.ListEntriesRequest) (*pb.ListEntriesResponse, error) {
+	if _, err := server.authorizeAccount(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+	size, err := pageSize(req.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+	arg := db.ListEntriesParams{
+		AccountID: sql.NullInt64{Int64: req.GetAccountId(), Valid: true},
+		Limit:     size + 1, // one more row tells whether there is a next page
+	}
+	if req.GetPageToken() != "" {
+		cursor, err := db.ParseCursor(req.GetPageToken())
+		if err != nil {
+			return nil, statusError(err)
+		}
+		arg = arg.After(cursor)
+	}
+
+	entries, err := server.store.ListEntries(ctx, arg)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	rsp := &pb.ListEntriesResponse{}
+	if len(entries) > int(size) {
+		entries = entries[:size]
+		rsp.NextPageToken = db.EntryCursor(entries[size-1]).String()
+	}
+	rsp.Entries = make([]*pb.Entry, len(entries))
+	for i, entry := range entries {
+		rsp.Entries[i] = convertEntry(entry)
+	}
+	return rsp, nil
+}
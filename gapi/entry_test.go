@@ -0,0 +1,53 @@
+package gapi
+
+import (
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestEntries(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	account1 := createRandomAccount(t, store, util.USD)
+	account2 := createRandomAccount(t, store, util.USD)
+	ctx := authContext(t, server, account1.Owner)
+	other := authContext(t, server, account2.Owner)
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		rsp, err := client.CreateTransfer(ctx, &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: 5, Currency: util.USD})
+		require.NoError(t, err)
+		ids = append(ids, rsp.FromEntry.Id)
+	}
+
+	entry, err := client.GetEntry(ctx, &pb.GetEntryRequest{Id: ids[0]})
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, entry.AccountId)
+	require.Equal(t, int64(-5), entry.Amount)
+	require.NotNil(t, entry.TransferId)
+	_, err = client.GetEntry(ctx, &pb.GetEntryRequest{Id: 1 << 40})
+	requireCode(t, err, codes.NotFound)
+	_, err = client.GetEntry(other, &pb.GetEntryRequest{Id: ids[0]})
+	requireCode(t, err, codes.PermissionDenied)
+
+	rsp, err := client.ListEntries(ctx, &pb.ListEntriesRequest{AccountId: account1.ID, PageSize: 2})
+	require.NoError(t, err)
+	require.Len(t, rsp.Entries, 2)
+	require.NotEmpty(t, rsp.NextPageToken)
+	last, err := client.ListEntries(ctx, &pb.ListEntriesRequest{AccountId: account1.ID, PageSize: 2, PageToken: rsp.NextPageToken})
+	require.NoError(t, err)
+	require.Len(t, last.Entries, 1)
+	require.Empty(t, last.NextPageToken)
+	require.Equal(t, ids, []int64{rsp.Entries[0].Id, rsp.Entries[1].Id, last.Entries[0].Id})
+
+	_, err = client.ListEntries(ctx, &pb.ListEntriesRequest{AccountId: account1.ID, PageSize: -1})
+	requireCode(t, err, codes.InvalidArgument)
+	_, err = client.ListEntries(other, &pb.ListEntriesRequest{AccountId: account1.ID})
+	requireCode(t, err, codes.PermissionDenied)
+}
@@ -0,0 +1,72 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// postgres error codes the handlers care about
+const (
+	foreignKeyViolation = pq.ErrorCode("23503")
+	uniqueViolation     = pq.ErrorCode("23505")
+)
+
+// statusError turns a store error into a gRPC status error (see errorCode)
+func statusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := errorCode(err)
+	if code == codes.Internal {
+		// don't leak the details of unexpected failures to callers
+		return status.Error(code, "internal error")
+	}
+	return status.Error(code, err.Error())
+}
+
+// errorCode maps store errors to gRPC codes, the same way api.errorStatus maps them to HTTP statuses
+// anything unknown is Internal
+func errorCode(err error) codes.Code {
+	var pqErr *pq.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, sql.ErrNoRows),
+		errors.Is(err, db.ErrAccountNotFound),
+		errors.Is(err, db.ErrTransferNotFound):
+		return codes.NotFound
+	case errors.Is(err, db.ErrInvalidAmount),
+		errors.Is(err, db.ErrSameAccount),
+		errors.Is(err, db.ErrCurrencyMismatch),
+		errors.Is(err, db.ErrInvalidCursor),
+		errors.Is(err, db.ErrPasswordTooLong):
+		return codes.InvalidArgument
+	case errors.Is(err, db.ErrAccountFrozen),
+		errors.Is(err, db.ErrAccountClosed),
+		errors.Is(err, db.ErrInsufficientFunds):
+		return codes.FailedPrecondition
+	case errors.Is(err, db.ErrIdempotencyKeyConflict):
+		return codes.AlreadyExists
+	case errors.As(err, &pqErr):
+		switch pqErr.Code {
+		case foreignKeyViolation:
+			// a missing referenced row is the caller's mistake, a row that is still referenced is a conflict
+			if strings.HasPrefix(pqErr.Message, "update or delete on table") {
+				return codes.FailedPrecondition
+			}
+			return codes.InvalidArgument
+		case uniqueViolation:
+			return codes.AlreadyExists
+		}
+	}
+	return codes.Internal
+}
@@ -0,0 +1,54 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCode(t *testing.T) {
+	testCases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{sql.ErrNoRows, codes.NotFound},
+		{fmt.Errorf("%w: 1", db.ErrAccountNotFound), codes.NotFound},
+		{fmt.Errorf("%w: 1", db.ErrTransferNotFound), codes.NotFound},
+		{&db.CurrencyMismatchError{AccountID: 1, Expected: "USD", Actual: "EUR"}, codes.InvalidArgument},
+		{fmt.Errorf("%w: 1", db.ErrAccountClosed), codes.FailedPrecondition},
+		{fmt.Errorf("%w: 1", db.ErrInsufficientFunds), codes.FailedPrecondition},
+		{db.ErrIdempotencyKeyConflict, codes.AlreadyExists},
+		{fmt.Errorf("list entries: %w", context.DeadlineExceeded), codes.DeadlineExceeded},
+		{&pq.Error{Code: "23503", Message: `insert or update on table "accounts" violates foreign key constraint "accounts_owner_fkey"`}, codes.InvalidArgument},
+		{&pq.Error{Code: "23503", Message: `update or delete on table "accounts" violates foreign key constraint "entries_account_id_fkey" on table "entries"`}, codes.FailedPrecondition},
+		{&pq.Error{Code: "23505"}, codes.AlreadyExists},
+		{&pq.Error{Code: "57014"}, codes.Internal},
+		{errors.New("boom"), codes.Internal},
+	}
+	for _, tc := range testCases {
+		require.Equal(t, tc.code, errorCode(tc.err), tc.err.Error())
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	// internal errors are not shown to callers
+	st := status.Convert(statusError(errors.New("connection refused")))
+	require.Equal(t, codes.Internal, st.Code())
+	require.NotContains(t, st.Message(), "connection refused")
+
+	// status errors are passed through
+	err := status.Error(codes.InvalidArgument, "bad")
+	require.Equal(t, err, statusError(err))
+
+	st = status.Convert(statusError(fmt.Errorf("%w: 7", db.ErrAccountNotFound)))
+	require.Equal(t, codes.NotFound, st.Code())
+	require.Equal(t, "account not found: 7", st.Message())
+}
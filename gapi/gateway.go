@@ -0,0 +1,32 @@
+package gapi
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// NewGateway returns a handler serving the Cashflow service as JSON over HTTP, following the
+// google.api.http options of proto/service_cashflow.proto
+// calls go straight to server, without a gRPC hop, after the same authentication as the gRPC calls
+// (the Authorization header); errors come back as a google.rpc.Status body with the HTTP status matching its code
+func NewGateway(ctx context.Context, server *Server) (http.Handler, error) {
+	// snake_case field names and zero values, like the REST api
+	marshaler := &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			UseProtoNames:   true,
+			EmitUnpopulated: true,
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: true,
+		},
+	}
+	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, marshaler))
+	if err := pb.RegisterCashflowHandlerServer(ctx, mux, server); err != nil {
+		return nil, err
+	}
+	return server.authHandler(mux, mux), nil
+}
@@ -0,0 +1,102 @@
+package gapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// serveGateway sends a request with an optional JSON body and authorization straight to the gateway
+func serveGateway(t *testing.T, gateway http.Handler, method, url, authorization string, body any) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	request, err := http.NewRequest(method, url, bytes.NewReader(data))
+	require.NoError(t, err)
+	if authorization != "" {
+		request.Header.Set(authorizationKey, authorization)
+	}
+	recorder := httptest.NewRecorder()
+	gateway.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestGateway(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	gateway, err := NewGateway(context.Background(), server)
+	require.NoError(t, err)
+	user := createRandomUser(t, store)
+	account2 := createRandomAccount(t, store, util.USD)
+	authorization := accessToken(t, server, user.Username)
+
+	// the same authentication as the gRPC calls
+	recorder := serveGateway(t, gateway, http.MethodPost, "/v1/accounts", "", map[string]any{"owner": user.Username, "currency": util.USD})
+	require.Equal(t, http.StatusUnauthorized, recorder.Code, recorder.Body.String())
+	recorder = serveGateway(t, gateway, http.MethodGet, "/v1/accounts/"+strconv.FormatInt(account2.ID, 10), authorization, nil)
+	require.Equal(t, http.StatusForbidden, recorder.Code, recorder.Body.String())
+
+	recorder = serveGateway(t, gateway, http.MethodPost, "/v1/accounts", authorization, map[string]any{"owner": user.Username, "currency": util.USD})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var account struct {
+		ID      string `json:"id"` // int64 is a string in proto JSON
+		Owner   string `json:"owner"`
+		Balance string `json:"balance"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &account))
+	require.Equal(t, user.Username, account.Owner)
+	require.Equal(t, "0", account.Balance) // zero values are not omitted
+
+	recorder = serveGateway(t, gateway, http.MethodGet, "/v1/accounts/"+account.ID, authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	// errors carry the HTTP status of their gRPC code
+	recorder = serveGateway(t, gateway, http.MethodGet, "/v1/accounts/"+strconv.FormatInt(account2.ID+100, 10), authorization, nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, recorder.Body.String(), db.ErrAccountNotFound.Error())
+
+	id, err := strconv.ParseInt(account.ID, 10, 64)
+	require.NoError(t, err)
+	recorder = serveGateway(t, gateway, http.MethodPost, "/v1/transfers", authorization, map[string]any{
+		"from_account_id": id,
+		"to_account_id":   account2.ID,
+		"amount":          10,
+		"currency":        util.USD,
+	})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String()) // FailedPrecondition: the new account is empty
+	require.Contains(t, recorder.Body.String(), db.ErrInsufficientFunds.Error())
+
+	recorder = serveGateway(t, gateway, http.MethodPost, "/v1/transfers", accessToken(t, server, account2.Owner), map[string]any{
+		"from_account_id": account2.ID,
+		"to_account_id":   id,
+		"amount":          10,
+		"currency":        util.USD,
+	})
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var transfer struct {
+		Transfer struct {
+			Amount string `json:"amount"`
+		} `json:"transfer"`
+		ToAccount struct {
+			Balance string `json:"balance"`
+		} `json:"to_account"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &transfer))
+	require.Equal(t, "10", transfer.Transfer.Amount)
+	require.Equal(t, "10", transfer.ToAccount.Balance)
+
+	recorder = serveGateway(t, gateway, http.MethodGet, "/v1/accounts/"+account.ID+"/entries?page_size=5", authorization, nil)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Contains(t, recorder.Body.String(), `"next_page_token":""`)
+}
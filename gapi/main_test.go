@@ -0,0 +1,90 @@
+package gapi
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestServer(t *testing.T, store db.Store) *Server {
+	tokenMaker, err := token.NewJWTMaker(token.Key{ID: "test", Secret: util.RandomString(32)})
+	require.NoError(t, err)
+	return NewServer(store, tokenMaker)
+}
+
+// newTestClient serves server over an in-memory connection, the server stops with the test
+func newTestClient(t *testing.T, server *Server) pb.CashflowClient {
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, listener)
+	}()
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		require.NoError(t, <-done)
+	})
+	return pb.NewCashflowClient(conn)
+}
+
+// accessToken returns an "authorization" value for username
+func accessToken(t *testing.T, server *Server, username string) string {
+	accessToken, _, err := server.tokenMaker.CreateToken(username, token.TypeAccess, time.Minute)
+	require.NoError(t, err)
+	return "Bearer " + accessToken
+}
+
+// authContext returns a context sending the calls as username
+func authContext(t *testing.T, server *Server, username string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), authorizationKey, accessToken(t, server, username))
+}
+
+func createRandomUser(t *testing.T, store db.Store) db.User {
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	return user
+}
+
+func createRandomAccount(t *testing.T, store db.Store, currency string) db.Account {
+	account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    createRandomUser(t, store).Username,
+		Balance:  1000 + util.RandomMoney(),
+		Currency: currency,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func requireCode(t *testing.T, err error, code codes.Code) {
+	require.Error(t, err)
+	st, ok := status.FromError(err)
+	require.True(t, ok, err.Error())
+	require.Equal(t, code, st.Code(), st.Message())
+}
@@ -0,0 +1,124 @@
+package gapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"github.com/harshaljanjani/cashflow.net/token"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// ShutdownTimeout is how long Serve and ServeGateway wait for in-flight calls once their context is cancelled
+const ShutdownTimeout = 10 * time.Second
+
+// page sizes of the list calls, a zero page_size means defaultPageSize
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+func pageSize(size int32) (int32, error) {
+	switch {
+	case size == 0:
+		return defaultPageSize, nil
+	case size < 0 || size > maxPageSize:
+		return 0, status.Errorf(codes.InvalidArgument, "page_size must be between 1 and %d, got %d", maxPageSize, size)
+	}
+	return size, nil
+}
+
+// Server serves gRPC requests for the banking service
+// callers authenticate with the access tokens of the REST api and only see and move the money of their own accounts
+type Server struct {
+	pb.UnimplementedCashflowServer
+	store      db.Store
+	tokenMaker token.Maker
+}
+
+// NewServer creates a new gRPC server, tokenMaker verifies the access tokens (the one of the REST api)
+// any Store works: db.NewStore for postgres, db.NewMemStore for tests
+func NewServer(store db.Store, tokenMaker token.Maker) *Server {
+	return &Server{store: store, tokenMaker: tokenMaker}
+}
+
+// NewGRPCServer returns a grpc.Server with the Cashflow service and server reflection registered,
+// every unary call is authenticated (see authInterceptor)
+func (server *Server) NewGRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(server.authInterceptor)}, opts...)
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterCashflowServer(grpcServer, server)
+	reflection.Register(grpcServer)
+	return grpcServer
+}
+
+// Serve accepts gRPC connections on listener until ctx is cancelled, then stops gracefully:
+// in-flight calls get up to ShutdownTimeout to finish before they are cancelled
+// returns nil after a clean shutdown
+func (server *Server) Serve(ctx context.Context, listener net.Listener) error {
+	grpcServer := server.NewGRPCServer()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- grpcServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(ShutdownTimeout):
+		grpcServer.Stop()
+	}
+	return <-errs
+}
+
+// ServeGateway serves the JSON gateway (see NewGateway) on listener until ctx is cancelled,
+// then shuts down like api.Server.Serve
+func (server *Server) ServeGateway(ctx context.Context, listener net.Listener) error {
+	gateway, err := NewGateway(ctx, server)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Handler:           gateway,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
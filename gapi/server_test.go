@@ -0,0 +1,42 @@
+package gapi
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestServeShutdown(t *testing.T) {
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- newTestServer(t, db.NewMemStore()).Serve(ctx, listener)
+	}()
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewCashflowClient(conn)
+	_, err = client.GetAccount(context.Background(), &pb.GetAccountRequest{Id: 1})
+	requireCode(t, err, codes.Unauthenticated)
+
+	// a clean shutdown returns nil and closes the listener
+	cancel()
+	require.NoError(t, <-done)
+	_, err = listener.Dial()
+	require.Error(t, err)
+}
@@ -0,0 +1,94 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// only the owner of the source account can send money from it
+// the accounts, currencies and funds are checked by TransferTx itself, under lock
+func (server *Server) CreateTransfer(ctx context.Context, req *pb.CreateTransferRequest) (*pb.CreateTransferResponse, error) {
+	if _, err := server.authorizeAccount(ctx, req.GetFromAccountId()); err != nil {
+		return nil, err
+	}
+	result, err := server.store.TransferTx(ctx, db.TransferTxParams{
+		FromAccountID:  req.GetFromAccountId(),
+		ToAccountID:    req.GetToAccountId(),
+		Amount:         req.GetAmount(),
+		Currency:       req.GetCurrency(),
+		IdempotencyKey: req.GetIdempotencyKey(),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.CreateTransferResponse{
+		Transfer:    convertTransfer(result.Transfer),
+		FromAccount: convertAccount(result.FromAccount),
+		ToAccount:   convertAccount(result.ToAccount),
+		FromEntry:   convertEntry(result.FromEntry),
+		ToEntry:     convertEntry(result.ToEntry),
+	}, nil
+}
+
+// a transfer is visible to the owners of both of its accounts
+func (server *Server) GetTransfer(ctx context.Context, req *pb.GetTransferRequest) (*pb.Transfer, error) {
+	transfer, err := server.store.GetTransfer(ctx, req.GetId())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", db.ErrTransferNotFound, req.GetId())
+		}
+		return nil, statusError(err)
+	}
+	if _, err := server.authorizeAccount(ctx, transfer.FromAccountID); err != nil {
+		if status.Code(err) != codes.PermissionDenied {
+			return nil, err
+		}
+		if _, err := server.authorizeAccount(ctx, transfer.ToAccountID); err != nil {
+			return nil, err
+		}
+	}
+	return convertTransfer(transfer), nil
+}
+
+func (server *Server) ListTransfers(ctx context.Context, req *pb.ListTransfersRequest) (*pb.ListTransfersResponse, error) {
+	if _, err := server.authorizeAccount(ctx, req.GetAccountId()); err != nil {
+		return nil, err
+	}
+	size, err := pageSize(req.GetPageSize())
+	if err != nil {
+		return nil, err
+	}
+	arg := db.ListTransfersParams{
+		AccountID: sql.NullInt64{Int64: req.GetAccountId(), Valid: true},
+		Limit:     size + 1, // one more row tells whether there is a next page
+	}
+	if req.GetPageToken() != "" {
+		cursor, err := db.ParseCursor(req.GetPageToken())
+		if err != nil {
+			return nil, statusError(err)
+		}
+		arg = arg.After(cursor)
+	}
+
+	transfers, err := server.store.ListTransfers(ctx, arg)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	rsp := &pb.ListTransfersResponse{}
+	if len(transfers) > int(size) {
+		transfers = transfers[:size]
+		rsp.NextPageToken = db.TransferCursor(transfers[size-1]).String()
+	}
+	rsp.Transfers = make([]*pb.Transfer, len(transfers))
+	for i, transfer := range transfers {
+		rsp.Transfers[i] = convertTransfer(transfer)
+	}
+	return rsp, nil
+}
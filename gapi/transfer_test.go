@@ -0,0 +1,135 @@
+package gapi
+
+import (
+	"context"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/pb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestCreateTransfer(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	account1 := createRandomAccount(t, store, util.USD)
+	account2 := createRandomAccount(t, store, util.USD)
+	ctx := authContext(t, server, account1.Owner)
+
+	req := &pb.CreateTransferRequest{
+		FromAccountId:  account1.ID,
+		ToAccountId:    account2.ID,
+		Amount:         10,
+		Currency:       util.USD,
+		IdempotencyKey: util.RandomString(16),
+	}
+	rsp, err := client.CreateTransfer(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, rsp.Transfer.FromAccountId)
+	require.Equal(t, int64(10), rsp.Transfer.Amount)
+	require.Nil(t, rsp.Transfer.ReversalOf)
+	require.Equal(t, account1.Balance-10, rsp.FromAccount.Balance)
+	require.Equal(t, account2.Balance+10, rsp.ToAccount.Balance)
+	require.Equal(t, int64(-10), rsp.FromEntry.Amount)
+	require.Equal(t, rsp.Transfer.Id, rsp.ToEntry.GetTransferId())
+
+	// a retry returns the same transfer
+	retry, err := client.CreateTransfer(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, rsp.Transfer.Id, retry.Transfer.Id)
+
+	// both owners see the transfer, nobody else does
+	got, err := client.GetTransfer(ctx, &pb.GetTransferRequest{Id: rsp.Transfer.Id})
+	require.NoError(t, err)
+	require.Equal(t, rsp.Transfer.Id, got.Id)
+	_, err = client.GetTransfer(authContext(t, server, account2.Owner), &pb.GetTransferRequest{Id: rsp.Transfer.Id})
+	require.NoError(t, err)
+	_, err = client.GetTransfer(authContext(t, server, createRandomUser(t, store).Username), &pb.GetTransferRequest{Id: rsp.Transfer.Id})
+	requireCode(t, err, codes.PermissionDenied)
+	_, err = client.GetTransfer(ctx, &pb.GetTransferRequest{Id: rsp.Transfer.Id + 1})
+	requireCode(t, err, codes.NotFound)
+
+	// only the owner of the source account can send from it
+	_, err = client.CreateTransfer(authContext(t, server, account2.Owner), req)
+	requireCode(t, err, codes.PermissionDenied)
+}
+
+func TestCreateTransferErrors(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	account1 := createRandomAccount(t, store, util.USD)
+	account2 := createRandomAccount(t, store, util.USD)
+	account3 := createRandomAccount(t, store, util.EUR)
+	account4 := createRandomAccount(t, store, util.CAD)
+	// a frozen account of the same owner
+	frozen, err := store.CreateAccount(context.Background(), db.CreateAccountParams{Owner: account1.Owner, Balance: 100, Currency: util.CAD})
+	require.NoError(t, err)
+	_, err = store.FreezeAccountTx(context.Background(), db.AccountStatusTxParams{AccountID: frozen.ID, Reason: "fraud", Actor: "ops"})
+	require.NoError(t, err)
+	ctx := authContext(t, server, account1.Owner)
+
+	key := util.RandomString(16)
+	_, err = client.CreateTransfer(ctx, &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: 1, Currency: util.USD, IdempotencyKey: key})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		req  *pb.CreateTransferRequest
+		code codes.Code
+	}{
+		{"InvalidAmount", &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: -1, Currency: util.USD}, codes.InvalidArgument},
+		{"SameAccount", &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account1.ID, Amount: 1, Currency: util.USD}, codes.InvalidArgument},
+		{"CurrencyMismatch", &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account3.ID, Amount: 1, Currency: util.USD}, codes.InvalidArgument},
+		{"AccountNotFound", &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: 1 << 40, Amount: 1, Currency: util.USD}, codes.NotFound},
+		{"InsufficientFunds", &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: account1.Balance * 2, Currency: util.USD}, codes.FailedPrecondition},
+		{"AccountFrozen", &pb.CreateTransferRequest{FromAccountId: frozen.ID, ToAccountId: account4.ID, Amount: 1, Currency: util.CAD}, codes.FailedPrecondition},
+		{"FromAccountNotFound", &pb.CreateTransferRequest{FromAccountId: 1 << 40, ToAccountId: account2.ID, Amount: 1, Currency: util.USD}, codes.NotFound},
+		{"NotOwner", &pb.CreateTransferRequest{FromAccountId: account2.ID, ToAccountId: account1.ID, Amount: 1, Currency: util.USD}, codes.PermissionDenied},
+		{"IdempotencyKeyConflict", &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: 2, Currency: util.USD, IdempotencyKey: key}, codes.AlreadyExists},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.CreateTransfer(ctx, tc.req)
+			requireCode(t, err, tc.code)
+		})
+	}
+}
+
+func TestListTransfers(t *testing.T) {
+	store := db.NewMemStore()
+	server := newTestServer(t, store)
+	client := newTestClient(t, server)
+	account1 := createRandomAccount(t, store, util.USD)
+	account2 := createRandomAccount(t, store, util.USD)
+	ctx := authContext(t, server, account1.Owner)
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		rsp, err := client.CreateTransfer(ctx, &pb.CreateTransferRequest{FromAccountId: account1.ID, ToAccountId: account2.ID, Amount: 1, Currency: util.USD})
+		require.NoError(t, err)
+		ids = append(ids, rsp.Transfer.Id)
+	}
+
+	// pages of 2, 2 and 1, the last one without a token
+	var got []int64
+	var token string
+	for page := 0; page < 3; page++ {
+		rsp, err := client.ListTransfers(ctx, &pb.ListTransfersRequest{AccountId: account1.ID, PageSize: 2, PageToken: token})
+		require.NoError(t, err)
+		for _, transfer := range rsp.Transfers {
+			got = append(got, transfer.Id)
+		}
+		token = rsp.NextPageToken
+	}
+	require.Empty(t, token)
+	require.Equal(t, ids, got)
+
+	_, err := client.ListTransfers(ctx, &pb.ListTransfersRequest{AccountId: account1.ID, PageToken: "not a token"})
+	requireCode(t, err, codes.InvalidArgument)
+	_, err = client.ListTransfers(ctx, &pb.ListTransfersRequest{AccountId: account2.ID})
+	requireCode(t, err, codes.PermissionDenied)
+}
@@ -0,0 +1,79 @@
+// Package maintenance tidies up the rows the ledger leaves behind: the holds past their expiry are marked expired
+// (db.Store.ExpireHolds, they already stopped reserving funds) and the idempotency keys past their retention are deleted
+// (db.Store.DeleteExpiredIdempotencyKeys), nothing else depends on the worker running on time
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// DefaultInterval is how long Run waits between two runs, when Options.Interval is not set
+const DefaultInterval = time.Minute
+
+// Options of a worker
+type Options struct {
+	Interval time.Duration // (DefaultInterval)
+	// called by Run with the errors it recovers from (database failures), optional
+	OnError func(error)
+	// current time (time.Now), idempotency keys expiring at or before it are deleted
+	Now func() time.Time
+}
+
+// Worker runs the maintenance of a store, several workers can share a store
+type Worker struct {
+	store db.Store
+	opts  Options
+}
+
+func NewWorker(store db.Store, opts Options) *Worker {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Worker{store: store, opts: opts}
+}
+
+// Result of a run
+type Result struct {
+	ExpiredHolds           []db.Hold `json:"expired_holds"`
+	DeletedIdempotencyKeys int64     `json:"deleted_idempotency_keys"`
+}
+
+// RunOnce expires the holds and deletes the idempotency keys, a failing step doesn't prevent the other one
+// the error joins the failures of both steps
+func (w *Worker) RunOnce(ctx context.Context) (Result, error) {
+	var result Result
+	var errs []error
+	var err error
+	if result.ExpiredHolds, err = w.store.ExpireHolds(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("expire holds: %w", err))
+	}
+	if result.DeletedIdempotencyKeys, err = w.store.DeleteExpiredIdempotencyKeys(ctx, w.opts.Now()); err != nil {
+		errs = append(errs, fmt.Errorf("delete expired idempotency keys: %w", err))
+	}
+	return result, errors.Join(errs...)
+}
+
+// Run calls RunOnce every Interval until ctx is done, errors are reported to OnError and retried by the next run
+// returns nil once ctx is done
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.RunOnce(ctx); err != nil && ctx.Err() == nil && w.opts.OnError != nil {
+			w.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package maintenance
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAccount(t *testing.T, store db.Store) db.Account {
+	ctx := context.Background()
+	user, err := store.CreateUser(ctx, db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	account, err := store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  1000,
+		Currency: util.USD,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+// authorize holds 10 on the account for expiresIn
+func authorize(t *testing.T, store db.Store, account db.Account, expiresIn time.Duration) db.Hold {
+	hold, err := store.AuthorizeTx(context.Background(), db.AuthorizeTxParams{AccountID: account.ID, Amount: 10, Currency: util.USD, ExpiresIn: expiresIn})
+	require.NoError(t, err)
+	return hold
+}
+
+func TestWorkerRunOnce(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+	expiring := authorize(t, store, account1, 10*time.Millisecond)
+	active := authorize(t, store, account1, time.Hour)
+	_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD, IdempotencyKey: util.RandomString(16)})
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+
+	// the key is kept for DefaultIdempotencyRetention
+	result, err := NewWorker(store, Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+	require.Len(t, result.ExpiredHolds, 1)
+	require.Equal(t, expiring.ID, result.ExpiredHolds[0].ID)
+	require.Equal(t, db.HoldStatusExpired, result.ExpiredHolds[0].Status)
+	require.Zero(t, result.DeletedIdempotencyKeys)
+
+	hold, err := store.GetHold(ctx, active.ID)
+	require.NoError(t, err)
+	require.Equal(t, db.HoldStatusActive, hold.Status)
+
+	later := func() time.Time { return time.Now().Add(db.DefaultIdempotencyRetention + time.Hour) }
+	result, err = NewWorker(store, Options{Now: later}).RunOnce(ctx)
+	require.NoError(t, err)
+	require.Empty(t, result.ExpiredHolds)
+	require.Equal(t, int64(1), result.DeletedIdempotencyKeys)
+}
+
+// countingStore counts the deletions of idempotency keys
+type countingStore struct {
+	db.Store
+	deleted atomic.Int64
+}
+
+func (store *countingStore) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	deleted, err := store.Store.DeleteExpiredIdempotencyKeys(ctx, now)
+	store.deleted.Add(deleted)
+	return deleted, err
+}
+
+func TestWorkerRun(t *testing.T) {
+	store := &countingStore{Store: db.NewMemStore(db.WithIdempotencyRetention(-time.Second))} // every key is already expired
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+	worker := NewWorker(store, Options{
+		Interval: 10 * time.Millisecond,
+		OnError:  func(err error) { t.Error(err) },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- worker.Run(ctx)
+	}()
+
+	_, err := store.TransferTx(context.Background(), db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 10, Currency: util.USD, IdempotencyKey: util.RandomString(16)})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return store.deleted.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+	hold := authorize(t, store, account1, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		got, err := store.GetHold(context.Background(), hold.ID)
+		require.NoError(t, err)
+		return got.Status == db.HoldStatusExpired
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
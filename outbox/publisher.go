@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// Publisher delivers outbox events to the outside world (a broker, a file, webhooks, ...)
+// Publish returning nil means the event is safely handed over, an error makes the relay retry it later
+// events can be delivered more than once (at-least-once), consumers should dedupe on the event id
+type Publisher interface {
+	Publish(ctx context.Context, event db.OutboxEvent) error
+}
+
+// PublisherFunc turns a function into a Publisher
+type PublisherFunc func(ctx context.Context, event db.OutboxEvent) error
+
+func (f PublisherFunc) Publish(ctx context.Context, event db.OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// MultiPublisher publishes every event to each of publishers in turn, the first failure stops it
+// the event is then published again to all of them, so each publisher must tolerate duplicates (as with any Publisher)
+func MultiPublisher(publishers ...Publisher) Publisher {
+	return PublisherFunc(func(ctx context.Context, event db.OutboxEvent) error {
+		for _, publisher := range publishers {
+			if err := publisher.Publish(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Message is how the publishers of this package serialize an event
+type Message struct {
+	ID            int64           `json:"id"`
+	EventType     string          `json:"event_type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// NewMessage drops the delivery bookkeeping (sent_at, attempts, last_error, failed_at) of an event
+func NewMessage(event db.OutboxEvent) Message {
+	return Message{
+		ID:            event.ID,
+		EventType:     event.EventType,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Payload:       event.Payload,
+		CreatedAt:     event.CreatedAt,
+	}
+}
+
+// MemoryPublisher keeps the published messages in memory, for tests and local runs
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event db.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, NewMessage(event))
+	return nil
+}
+
+// Messages returns a copy of the published messages, in publication order (duplicates included)
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
+
+// FilePublisher appends every event as a JSON line to a file, the file is synced before Publish returns
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher opens (or creates) the file in append mode
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, event db.OutboxEvent) error {
+	line, err := json.Marshal(NewMessage(event))
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return p.file.Sync()
+}
+
+func (p *FilePublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.file.Close()
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePublisher(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	events := []db.OutboxEvent{
+		{ID: 1, EventType: db.EventTransferCreated, AggregateType: db.AggregateTypeTransfer, AggregateID: 7, Payload: json.RawMessage(`{"transfer_id":7}`), CreatedAt: time.Now().UTC()},
+		{ID: 2, EventType: db.EventAccountFrozen, AggregateType: db.AggregateTypeAccount, AggregateID: 3, Payload: json.RawMessage(`{"account_id":3}`), CreatedAt: time.Now().UTC(), Attempts: 4},
+	}
+
+	publisher, err := NewFilePublisher(path)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(ctx, events[0]))
+	require.NoError(t, publisher.Close())
+
+	// the file is appended to, not truncated
+	publisher, err = NewFilePublisher(path)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(ctx, events[1]))
+	require.NoError(t, publisher.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	var messages []Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var message Message
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &message))
+		messages = append(messages, message)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, []Message{NewMessage(events[0]), NewMessage(events[1])}, messages)
+}
+
+func TestFilePublisherClosed(t *testing.T) {
+	publisher, err := NewFilePublisher(filepath.Join(t.TempDir(), "outbox.jsonl"))
+	require.NoError(t, err)
+	require.NoError(t, publisher.Close())
+	require.Error(t, publisher.Publish(context.Background(), db.OutboxEvent{ID: 1, Payload: json.RawMessage(`{}`)}))
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	publisher := NewMemoryPublisher()
+	event := db.OutboxEvent{ID: 1, EventType: db.EventTransferCreated, Payload: json.RawMessage(`{}`)}
+	require.NoError(t, publisher.Publish(context.Background(), event))
+	require.NoError(t, publisher.Publish(context.Background(), event)) // redeliveries are kept
+
+	messages := publisher.Messages()
+	require.Equal(t, []Message{NewMessage(event), NewMessage(event)}, messages)
+	messages[0].ID = 2
+	require.Equal(t, int64(1), publisher.Messages()[0].ID)
+}
@@ -0,0 +1,76 @@
+// Package outbox publishes the events the ledger writes to outbox_events (see db.Store.RelayOutboxTx)
+// an event is written in the same transaction as the change it describes, so it is published if and only if the change committed,
+// the relay hands the unsent events to a Publisher in id order and marks them sent: delivery is at-least-once
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// DefaultPollInterval is how long Run waits when the outbox is empty or the publisher failed, when Options.PollInterval is not set
+const DefaultPollInterval = time.Second
+
+// Options of a relay
+type Options struct {
+	BatchSize    int32         // events claimed per transaction (db.DefaultOutboxRelayLimit)
+	PollInterval time.Duration // (DefaultPollInterval)
+	// called with the errors Run recovers from (publisher or database failures) and the events given up on, optional
+	OnError func(error)
+}
+
+// Relay moves events from the outbox to a publisher, several relays can share an outbox (claimed events are skipped by the others)
+type Relay struct {
+	store     db.Store
+	publisher Publisher
+	opts      Options
+}
+
+func NewRelay(store db.Store, publisher Publisher, opts Options) *Relay {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	return &Relay{store: store, publisher: publisher, opts: opts}
+}
+
+// RunOnce publishes batches until the outbox is empty and returns the number of events sent
+// it stops at the first publisher failure (the error wraps db.ErrPublishFailed), the failed event is retried by the next run
+// events the store gave up on (db.WithOutboxMaxAttempts) don't stop it, they are reported to OnError
+func (r *Relay) RunOnce(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		result, err := r.store.RelayOutboxTx(ctx, r.opts.BatchSize, r.publisher.Publish)
+		sent += len(result.Sent)
+		if r.opts.OnError != nil {
+			for _, event := range result.Dead {
+				r.opts.OnError(fmt.Errorf("%w: %d given up after %d attempts: %s", db.ErrPublishFailed, event.ID, event.Attempts, event.LastError))
+			}
+		}
+		if err != nil {
+			return sent, err
+		}
+		if len(result.Sent) == 0 && len(result.Dead) == 0 {
+			return sent, nil
+		}
+	}
+}
+
+// Run drains the outbox every PollInterval until ctx is done, errors are reported to OnError and retried
+// returns nil once ctx is done
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RunOnce(ctx); err != nil && ctx.Err() == nil && r.opts.OnError != nil {
+			r.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
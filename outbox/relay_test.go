@@ -0,0 +1,190 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAccount(t *testing.T, store db.Store) db.Account {
+	ctx := context.Background()
+	user, err := store.CreateUser(ctx, db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	account, err := store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  1000,
+		Currency: util.USD,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+// transfer moves 10 between the accounts, which writes a transfer.created event
+func transfer(t *testing.T, store db.Store, from, to db.Account) db.Transfer {
+	result, err := store.TransferTx(context.Background(), db.TransferTxParams{FromAccountID: from.ID, ToAccountID: to.ID, Amount: 10, Currency: util.USD})
+	require.NoError(t, err)
+	return result.Transfer
+}
+
+func TestRelayRunOnce(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+	var transfers []db.Transfer
+	for i := 0; i < 5; i++ {
+		transfers = append(transfers, transfer(t, store, account1, account2))
+	}
+	_, err := store.FreezeAccountTx(ctx, db.AccountStatusTxParams{AccountID: account2.ID, Reason: "aml review", Actor: "compliance"})
+	require.NoError(t, err)
+
+	publisher := NewMemoryPublisher()
+	relay := NewRelay(store, publisher, Options{BatchSize: 2})
+	sent, err := relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 6, sent)
+
+	messages := publisher.Messages()
+	require.Len(t, messages, 6)
+	for i, transfer := range transfers {
+		require.Equal(t, db.EventTransferCreated, messages[i].EventType)
+		require.Equal(t, db.AggregateTypeTransfer, messages[i].AggregateType)
+		require.Equal(t, transfer.ID, messages[i].AggregateID)
+		var payload db.TransferEvent
+		require.NoError(t, json.Unmarshal(messages[i].Payload, &payload))
+		require.Equal(t, transfer.ID, payload.TransferID)
+		require.Equal(t, account1.Balance-10*int64(i+1), payload.FromBalance)
+	}
+	require.Equal(t, db.EventAccountFrozen, messages[5].EventType)
+	require.Equal(t, account2.ID, messages[5].AggregateID)
+
+	// everything was marked sent
+	sent, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Zero(t, sent)
+	require.Len(t, publisher.Messages(), 6)
+}
+
+func TestRelayRetriesFailedEvents(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+	transfer1 := transfer(t, store, account1, account2)
+	transfer2 := transfer(t, store, account1, account2)
+
+	memory := NewMemoryPublisher()
+	down := true
+	errBroker := errors.New("broker unavailable")
+	relay := NewRelay(store, PublisherFunc(func(ctx context.Context, event db.OutboxEvent) error {
+		if down {
+			return errBroker
+		}
+		return memory.Publish(ctx, event)
+	}), Options{})
+
+	sent, err := relay.RunOnce(ctx)
+	require.ErrorIs(t, err, db.ErrPublishFailed)
+	require.ErrorIs(t, err, errBroker)
+	require.Zero(t, sent)
+
+	down = false
+	sent, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, sent)
+	messages := memory.Messages()
+	require.Equal(t, transfer1.ID, messages[0].AggregateID)
+	require.Equal(t, transfer2.ID, messages[1].AggregateID)
+
+	events, err := store.ListOutboxEvents(ctx, db.ListOutboxEventsParams{AggregateType: db.AggregateTypeTransfer, AggregateID: transfer1.ID})
+	require.NoError(t, err)
+	require.True(t, events[0].SentAt.Valid)
+	require.Equal(t, int32(2), events[0].Attempts)
+}
+
+func TestRelaySkipsPoisonEvents(t *testing.T) {
+	store := db.NewMemStore(db.WithOutboxMaxAttempts(3))
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+	poison := transfer(t, store, account1, account2)
+	transfer2 := transfer(t, store, account1, account2)
+
+	memory := NewMemoryPublisher()
+	var dead []error
+	relay := NewRelay(store, PublisherFunc(func(ctx context.Context, event db.OutboxEvent) error {
+		if event.AggregateID == poison.ID {
+			return errors.New("rejected by the broker")
+		}
+		return memory.Publish(ctx, event)
+	}), Options{BatchSize: 1, OnError: func(err error) { dead = append(dead, err) }})
+
+	for i := 0; i < 2; i++ {
+		_, err := relay.RunOnce(ctx)
+		require.ErrorIs(t, err, db.ErrPublishFailed)
+		require.Empty(t, memory.Messages()) // held back while the event may still go out
+	}
+	// the third rejection gives up on it, the events after it are delivered
+	sent, err := relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+	require.Len(t, memory.Messages(), 1)
+	require.Equal(t, transfer2.ID, memory.Messages()[0].AggregateID)
+	require.Len(t, dead, 1)
+	require.ErrorIs(t, dead[0], db.ErrPublishFailed)
+
+	transfer3 := transfer(t, store, account1, account2)
+	sent, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+	require.Equal(t, transfer3.ID, memory.Messages()[1].AggregateID)
+}
+
+func TestRelayRun(t *testing.T) {
+	store := db.NewMemStore()
+	account1 := createRandomAccount(t, store)
+	account2 := createRandomAccount(t, store)
+
+	var failures atomic.Int32
+	memory := NewMemoryPublisher()
+	relay := NewRelay(store, PublisherFunc(func(ctx context.Context, event db.OutboxEvent) error {
+		// the first attempt fails, Run reports it and tries again
+		if failures.Load() == 0 {
+			return errors.New("broker unavailable")
+		}
+		return memory.Publish(ctx, event)
+	}), Options{
+		PollInterval: 10 * time.Millisecond,
+		OnError:      func(err error) { failures.Add(1) },
+	})
+
+	transfer1 := transfer(t, store, account1, account2)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return len(memory.Messages()) == 1 }, time.Second, 5*time.Millisecond)
+	transfer2 := transfer(t, store, account1, account2)
+	require.Eventually(t, func() bool { return len(memory.Messages()) == 2 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+	require.Equal(t, int32(1), failures.Load())
+	messages := memory.Messages()
+	require.Equal(t, transfer1.ID, messages[0].AggregateID)
+	require.Equal(t, transfer2.ID, messages[1].AggregateID)
+}
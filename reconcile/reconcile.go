@@ -0,0 +1,105 @@
+// Package reconcile checks that the stored balance of every account (accounts.balance) still matches the sum of its entries
+// the balance is a denormalised copy that AddAccountBalance and UpdateAccount change without looking at the entries,
+// so a bug or a manual fix can make the two drift apart
+package reconcile
+
+import (
+	"context"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// DefaultPageSize is the number of accounts read per query when Options.PageSize is not set
+const DefaultPageSize = 500
+
+// Options of a reconciliation run
+type Options struct {
+	Adjust   bool  // write a correcting adjustment entry for every drift (see db.Store.AdjustBalanceTx)
+	PageSize int32 // accounts read per query (DefaultPageSize)
+}
+
+// Drift is an account whose balance doesn't match the sum of its entries
+type Drift struct {
+	AccountID    int64  `json:"account_id"`
+	Currency     string `json:"currency"`
+	Balance      int64  `json:"balance"`
+	EntriesTotal int64  `json:"entries_total"`
+	Drift        int64  `json:"drift"` // balance minus entries total
+	// set when the run wrote an adjustment entry for this drift
+	AdjustmentEntryID int64 `json:"adjustment_entry_id,omitempty"`
+}
+
+// Report is the machine-readable result of a run
+type Report struct {
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	AccountsChecked int       `json:"accounts_checked"`
+	Adjusted        bool      `json:"adjusted"` // adjustment entries were written for the drifts
+	Drifts          []Drift   `json:"drifts"`
+}
+
+// OK reports whether every account was consistent
+func (r Report) OK() bool {
+	return len(r.Drifts) == 0
+}
+
+// Run compares the balance of every account with the sum of its entries, in ascending account id order
+// with opts.Adjust each drifting account is fixed in its own transaction, the drift is checked again under the account lock first
+// (an account that became consistent in the meantime is left out of the report)
+func Run(ctx context.Context, store db.Store, opts Options) (Report, error) {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	report := Report{
+		StartedAt: time.Now(),
+		Adjusted:  opts.Adjust,
+		Drifts:    []Drift{},
+	}
+
+	var afterID int64
+	for {
+		rows, err := store.ListAccountEntryTotals(ctx, db.ListAccountEntryTotalsParams{
+			AfterID: afterID,
+			Limit:   pageSize,
+		})
+		if err != nil {
+			return report, err
+		}
+		for _, row := range rows {
+			report.AccountsChecked++
+			if row.Balance == row.EntriesTotal {
+				continue
+			}
+			drift := Drift{
+				AccountID:    row.ID,
+				Currency:     row.Currency,
+				Balance:      row.Balance,
+				EntriesTotal: row.EntriesTotal,
+				Drift:        row.Balance - row.EntriesTotal,
+			}
+			if opts.Adjust {
+				result, err := store.AdjustBalanceTx(ctx, row.ID)
+				if err != nil {
+					return report, err
+				}
+				if result.Drift == 0 {
+					continue
+				}
+				drift.Balance = result.Account.Balance
+				drift.EntriesTotal = result.EntriesTotal
+				drift.Drift = result.Drift
+				drift.AdjustmentEntryID = result.Entry.ID
+			}
+			report.Drifts = append(report.Drifts, drift)
+		}
+		if len(rows) < int(pageSize) {
+			break
+		}
+		afterID = rows[len(rows)-1].ID
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
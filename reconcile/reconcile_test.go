@@ -0,0 +1,84 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+// createConsistentAccount opens an account whose opening balance is backed by an entry
+func createConsistentAccount(t *testing.T, store db.Store, balance int64) db.Account {
+	ctx := context.Background()
+	user, err := store.CreateUser(ctx, db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	account, err := store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  balance,
+		Currency: util.USD,
+	})
+	require.NoError(t, err)
+	_, err = store.CreateEntry(ctx, db.CreateEntryParams{AccountID: account.ID, Amount: balance})
+	require.NoError(t, err)
+	return account
+}
+
+func TestRun(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+
+	account1 := createConsistentAccount(t, store, 1000)
+	account2 := createConsistentAccount(t, store, 1000)
+	account3 := createConsistentAccount(t, store, 1000)
+	_, err := store.TransferTx(ctx, db.TransferTxParams{FromAccountID: account1.ID, ToAccountID: account2.ID, Amount: 300, Currency: util.USD})
+	require.NoError(t, err)
+
+	report, err := Run(ctx, store, Options{})
+	require.NoError(t, err)
+	require.True(t, report.OK())
+	require.Equal(t, 3, report.AccountsChecked)
+	require.NotNil(t, report.Drifts)
+
+	// balances changed behind the back of the ledger
+	_, err = store.AddAccountBalance(ctx, db.AddAccountBalanceParams{ID: account1.ID, Amount: 50})
+	require.NoError(t, err)
+	_, err = store.UpdateAccount(ctx, db.UpdateAccountParams{ID: account3.ID, Balance: 900})
+	require.NoError(t, err)
+
+	report, err = Run(ctx, store, Options{PageSize: 2})
+	require.NoError(t, err)
+	require.False(t, report.OK())
+	require.False(t, report.Adjusted)
+	require.Equal(t, 3, report.AccountsChecked)
+	require.Equal(t, []Drift{
+		{AccountID: account1.ID, Currency: util.USD, Balance: 750, EntriesTotal: 700, Drift: 50},
+		{AccountID: account3.ID, Currency: util.USD, Balance: 900, EntriesTotal: 1000, Drift: -100},
+	}, report.Drifts)
+
+	// adjusting writes one entry per drift and leaves the balances alone
+	report, err = Run(ctx, store, Options{Adjust: true})
+	require.NoError(t, err)
+	require.True(t, report.Adjusted)
+	require.Len(t, report.Drifts, 2)
+	for _, drift := range report.Drifts {
+		entry, err := store.GetEntry(ctx, drift.AdjustmentEntryID)
+		require.NoError(t, err)
+		require.Equal(t, drift.AccountID, entry.AccountID)
+		require.Equal(t, drift.Drift, entry.Amount)
+
+		account, err := store.GetAccount(ctx, drift.AccountID)
+		require.NoError(t, err)
+		require.Equal(t, drift.Balance, account.Balance)
+	}
+
+	report, err = Run(ctx, store, Options{})
+	require.NoError(t, err)
+	require.True(t, report.OK())
+}
@@ -1,46 +0,0 @@
-CREATE TABLE "accounts" (
-  "id" bigserial PRIMARY KEY,
-  "owner" varchar NOT NULL,
-  "balance" bigint NOT NULL,
-  "currency" varchar NOT NULL,
-  "created_at" timestamptz NOT NULL DEFAULT (now())
-);
-CREATE TABLE "entries" (
-  "id" bigserial PRIMARY KEY,
-  "account_id" bigint NOT NULL,
-  "amount" bigint NOT NULL, /*Can be negative or positive*/
-  "created_at" timestamptz NOT NULL DEFAULT (now())
-);
-CREATE TABLE "transfers" (
-    "id" bigserial PRIMARY KEY,
-    "from_account_id" bigint NOT NULL,
-    "to_account_id" bigint NOT NULL,
-    "amount" bigint NOT NULL, /*Must be positive*/
-    "created_at" timestamptz NOT NULL DEFAULT (now())
-);
-
-CREATE INDEX ON "accounts" ("owner");
-
-CREATE INDEX ON "entries" ("account_id");
-
-CREATE INDEX ON "transfers" ("from_account_id");
-
-CREATE INDEX ON "transfers" ("to_account_id");
-
-CREATE INDEX ON "transfers" ("from_account_id", "to_account_id");
-
-ALTER TABLE "entries" ADD FOREIGN KEY ("account_id") REFERENCES "accounts" ("id");
-
-ALTER TABLE "transfers" ADD FOREIGN KEY ("from_account_id") REFERENCES "accounts" ("id");
-
-ALTER TABLE "transfers" ADD FOREIGN KEY ("to_account_id") REFERENCES "accounts" ("id");
-
-COMMENT ON COLUMN entries.amount is 'Can be negative or positive';
-
-COMMENT ON COLUMN transfers.amount is 'Must be positive';
-
--- DROP TABLE "public"."accounts";
-
--- DROP TABLE "public"."entries";
-
--- DROP TABLE "public"."transfers";
\ No newline at end of file
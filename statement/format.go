@@ -0,0 +1,105 @@
+package statement
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// output formats supported by Write
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatText = "text"
+)
+
+// ErrUnknownFormat is returned by Write for a format other than FormatJSON, FormatCSV or FormatText
+var ErrUnknownFormat = errors.New("unknown statement format")
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// Write writes the statement in the given format
+func (s Statement) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return s.WriteJSON(w)
+	case FormatCSV:
+		return s.WriteCSV(w)
+	case FormatText:
+		return s.WriteText(w)
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// WriteJSON writes the statement as indented JSON, amounts stay in minor units
+func (s Statement) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// WriteCSV writes one record per line, framed by an opening and a closing balance record
+// amounts are decimal strings (12.34), times are RFC 3339
+func (s Statement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	records := [][]string{
+		{"time", "entry_id", "transfer_id", "counterparty_account_id", "description", "amount", "balance"},
+		{s.From.Format(time.RFC3339), "", "", "", "opening balance", "", formatAmount(s.OpeningBalance)},
+	}
+	for _, line := range s.Lines {
+		records = append(records, []string{
+			line.Time.Format(time.RFC3339Nano),
+			strconv.FormatInt(line.EntryID, 10),
+			formatID(line.TransferID),
+			formatID(line.CounterpartyAccountID),
+			line.Description(),
+			formatAmount(line.Amount),
+			formatAmount(line.Balance),
+		})
+	}
+	records = append(records, []string{s.To.Format(time.RFC3339), "", "", "", "closing balance", "", formatAmount(s.ClosingBalance)})
+	return writer.WriteAll(records) // WriteAll flushes
+}
+
+// WriteText writes a statement meant to be read by a person, times are shown in the location of From
+func (s Statement) WriteText(w io.Writer) error {
+	loc := s.From.Location()
+	fmt.Fprintf(w, "Statement of account %d (%s, %s)\n", s.AccountID, s.Owner, s.Currency)
+	fmt.Fprintf(w, "Period: %s - %s\n\n", s.From.In(loc).Format(timeLayout), s.To.In(loc).Format(timeLayout))
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "DATE\tENTRY\tDESCRIPTION\tAMOUNT\tBALANCE\t")
+	fmt.Fprintf(table, "%s\t\topening balance\t\t%s\t\n", s.From.In(loc).Format(timeLayout), formatAmount(s.OpeningBalance))
+	for _, line := range s.Lines {
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\t%s\t\n", line.Time.In(loc).Format(timeLayout), line.EntryID, line.Description(), formatAmount(line.Amount), formatAmount(line.Balance))
+	}
+	fmt.Fprintf(table, "%s\t\tclosing balance\t\t%s\t\n", s.To.In(loc).Format(timeLayout), formatAmount(s.ClosingBalance))
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\nTotal in:  %s %s\nTotal out: %s %s\n", formatAmount(s.TotalIn), s.Currency, formatAmount(s.TotalOut), s.Currency)
+	return err
+}
+
+// formatAmount turns minor units into a decimal string: -1234 -> "-12.34"
+func formatAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+func formatID(id int64) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,116 @@
+// Package statement builds account statements: opening balance, every entry of a period with its counterparty and the running balance,
+// totals and closing balance, written as JSON, CSV or plain text
+package statement
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// ErrInvalidPeriod is returned when the end of a statement period is not after its start
+var ErrInvalidPeriod = errors.New("statement period must end after it starts")
+
+// Line is a single entry of a statement
+type Line struct {
+	EntryID int64     `json:"entry_id"`
+	Time    time.Time `json:"time"`
+	Amount  int64     `json:"amount"` // positive: money in, negative: money out
+	// transfer the entry was posted for and the other account of that transfer, 0 for entries without a transfer (adjustments)
+	TransferID            int64 `json:"transfer_id,omitempty"`
+	CounterpartyAccountID int64 `json:"counterparty_account_id,omitempty"`
+	Balance               int64 `json:"balance"` // running balance after this entry
+}
+
+// Description is a human readable summary of the line, used by the CSV and text output
+func (line Line) Description() string {
+	switch {
+	case line.TransferID == 0:
+		return "adjustment"
+	case line.Amount < 0:
+		return fmt.Sprintf("transfer %d to account %d", line.TransferID, line.CounterpartyAccountID)
+	default:
+		return fmt.Sprintf("transfer %d from account %d", line.TransferID, line.CounterpartyAccountID)
+	}
+}
+
+// Statement of an account over the period (From, To]: entries made exactly at From belong to the previous statement
+// every amount is in minor units of Currency
+type Statement struct {
+	AccountID      int64     `json:"account_id"`
+	Owner          string    `json:"owner"`
+	Currency       string    `json:"currency"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	OpeningBalance int64     `json:"opening_balance"` // balance at From
+	Lines          []Line    `json:"lines"`
+	TotalIn        int64     `json:"total_in"`        // sum of the positive entries
+	TotalOut       int64     `json:"total_out"`       // sum of the negative entries, as a positive number
+	ClosingBalance int64     `json:"closing_balance"` // balance at To
+}
+
+// Generate builds the statement of an account for the period (from, to]
+// the opening balance comes from db.Store.GetBalanceAt, the closing balance is the opening balance plus the entries of the period
+func Generate(ctx context.Context, store db.Store, accountID int64, from, to time.Time) (Statement, error) {
+	if !to.After(from) {
+		return Statement{}, fmt.Errorf("%w: %s - %s", ErrInvalidPeriod, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	account, err := store.GetAccount(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", db.ErrAccountNotFound, accountID)
+		}
+		return Statement{}, err
+	}
+	opening, err := store.GetBalanceAt(ctx, accountID, from)
+	if err != nil {
+		return Statement{}, err
+	}
+	rows, err := store.ListStatementEntries(ctx, db.ListStatementEntriesParams{
+		AccountID: accountID,
+		FromTime:  from,
+		ToTime:    to,
+	})
+	if err != nil {
+		return Statement{}, err
+	}
+
+	statement := Statement{
+		AccountID:      account.ID,
+		Owner:          account.Owner,
+		Currency:       account.Currency,
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+		Lines:          make([]Line, 0, len(rows)),
+	}
+	balance := opening
+	for _, row := range rows {
+		balance += row.Amount
+		line := Line{
+			EntryID: row.ID,
+			Time:    row.CreatedAt,
+			Amount:  row.Amount,
+			Balance: balance,
+		}
+		if row.TransferID.Valid {
+			line.TransferID = row.TransferID.Int64
+			line.CounterpartyAccountID = row.FromAccountID.Int64
+			if row.FromAccountID.Int64 == accountID {
+				line.CounterpartyAccountID = row.ToAccountID.Int64
+			}
+		}
+		if row.Amount > 0 {
+			statement.TotalIn += row.Amount
+		} else {
+			statement.TotalOut -= row.Amount
+		}
+		statement.Lines = append(statement.Lines, line)
+	}
+	statement.ClosingBalance = balance
+	return statement, nil
+}
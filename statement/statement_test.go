@@ -0,0 +1,137 @@
+package statement
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func createAccount(t *testing.T, store db.Store, balance int64) db.Account {
+	user, err := store.CreateUser(context.Background(), db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	account, err := store.CreateAccount(context.Background(), db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  balance,
+		Currency: util.USD,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+// transfer moves amount and waits a little, so every transfer gets its own timestamp
+func transfer(t *testing.T, store db.Store, from, to db.Account, amount int64) db.TransferTxResult {
+	result, err := store.TransferTx(context.Background(), db.TransferTxParams{
+		FromAccountID: from.ID,
+		ToAccountID:   to.ID,
+		Amount:        amount,
+		Currency:      util.USD,
+	})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	return result
+}
+
+func TestGenerate(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createAccount(t, store, 10000)
+	account2 := createAccount(t, store, 10000)
+
+	transfer(t, store, account1, account2, 1000) // before the period
+	from := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	out := transfer(t, store, account1, account2, 250)
+	in := transfer(t, store, account2, account1, 1234)
+	to := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	transfer(t, store, account1, account2, 1) // after the period
+
+	statement, err := Generate(ctx, store, account1.ID, from, to)
+	require.NoError(t, err)
+	require.Equal(t, account1.ID, statement.AccountID)
+	require.Equal(t, account1.Owner, statement.Owner)
+	require.Equal(t, int64(9000), statement.OpeningBalance)
+	require.Equal(t, []Line{
+		{EntryID: out.FromEntry.ID, Time: out.FromEntry.CreatedAt, Amount: -250, TransferID: out.Transfer.ID, CounterpartyAccountID: account2.ID, Balance: 8750},
+		{EntryID: in.ToEntry.ID, Time: in.ToEntry.CreatedAt, Amount: 1234, TransferID: in.Transfer.ID, CounterpartyAccountID: account2.ID, Balance: 9984},
+	}, statement.Lines)
+	require.Equal(t, int64(1234), statement.TotalIn)
+	require.Equal(t, int64(250), statement.TotalOut)
+	require.Equal(t, int64(9984), statement.ClosingBalance)
+
+	// the closing balance agrees with the point-in-time balance
+	balance, err := store.GetBalanceAt(ctx, account1.ID, to)
+	require.NoError(t, err)
+	require.Equal(t, balance, statement.ClosingBalance)
+
+	_, err = Generate(ctx, store, account1.ID, to, from)
+	require.ErrorIs(t, err, ErrInvalidPeriod)
+	_, err = Generate(ctx, store, -1, from, to)
+	require.ErrorIs(t, err, db.ErrAccountNotFound)
+}
+
+func TestGenerateEmptyPeriod(t *testing.T) {
+	store := db.NewMemStore()
+	account := createAccount(t, store, 500)
+
+	statement, err := Generate(context.Background(), store, account.ID, time.Now(), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, statement.Lines)
+	require.Equal(t, int64(500), statement.OpeningBalance)
+	require.Equal(t, int64(500), statement.ClosingBalance)
+}
+
+func TestWrite(t *testing.T) {
+	from := time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)
+	statement := Statement{
+		AccountID:      1,
+		Owner:          "alice",
+		Currency:       util.USD,
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: 10000,
+		Lines: []Line{
+			{EntryID: 10, Time: from.Add(time.Hour), Amount: -250, TransferID: 5, CounterpartyAccountID: 2, Balance: 9750},
+			{EntryID: 11, Time: from.Add(2 * time.Hour), Amount: 5, Balance: 9755},
+		},
+		TotalIn:        5,
+		TotalOut:       250,
+		ClosingBalance: 9755,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, statement.Write(&buf, FormatJSON))
+	var decoded Statement
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, statement, decoded)
+
+	buf.Reset()
+	require.NoError(t, statement.Write(&buf, FormatCSV))
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 5) // header, opening, 2 lines, closing
+	require.Equal(t, []string{"2023-03-01T01:00:00Z", "10", "5", "2", "transfer 5 to account 2", "-2.50", "97.50"}, records[2])
+	require.Equal(t, []string{"2023-03-01T02:00:00Z", "11", "", "", "adjustment", "0.05", "97.55"}, records[3])
+	require.Equal(t, "97.55", records[4][6])
+
+	buf.Reset()
+	require.NoError(t, statement.Write(&buf, FormatText))
+	text := buf.String()
+	require.Contains(t, text, "Statement of account 1 (alice, USD)")
+	require.Contains(t, text, "transfer 5 to account 2")
+	require.Contains(t, text, "Total out: 2.50 USD")
+
+	require.ErrorIs(t, statement.Write(&buf, "xml"), ErrUnknownFormat)
+}
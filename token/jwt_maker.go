@@ -0,0 +1,85 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MinSecretKeySize is the minimum length of a signing key (HS256 wants at least 256 bits)
+const MinSecretKeySize = 32
+
+// Key is a named signing key, the ID goes in the "kid" header of every token it signs
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// JWTMaker is a Maker of HS256 JSON web tokens
+// keys are rotated by making the new key current and keeping the old one as a previous key
+// until the tokens it signed have expired: tokens are always signed with the current key,
+// and verified with whichever key their "kid" names
+type JWTMaker struct {
+	current Key
+	keys    map[string][]byte
+}
+
+var _ Maker = (*JWTMaker)(nil)
+
+// NewJWTMaker creates a JWTMaker signing with current and also accepting tokens signed with previous
+func NewJWTMaker(current Key, previous ...Key) (*JWTMaker, error) {
+	maker := &JWTMaker{
+		current: current,
+		keys:    make(map[string][]byte, 1+len(previous)),
+	}
+	for _, key := range append([]Key{current}, previous...) {
+		if key.ID == "" {
+			return nil, errors.New("key id must not be empty")
+		}
+		if len(key.Secret) < MinSecretKeySize {
+			return nil, fmt.Errorf("invalid key %q: must be at least %d characters", key.ID, MinSecretKeySize)
+		}
+		if _, ok := maker.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		maker.keys[key.ID] = []byte(key.Secret)
+	}
+	return maker, nil
+}
+
+func (maker *JWTMaker) CreateToken(username string, tokenType Type, duration time.Duration) (string, *Payload, error) {
+	payload, err := NewPayload(username, tokenType, duration)
+	if err != nil {
+		return "", payload, err
+	}
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, payload)
+	jwtToken.Header["kid"] = maker.current.ID
+	token, err := jwtToken.SignedString(maker.keys[maker.current.ID])
+	return token, payload, err
+}
+
+func (maker *JWTMaker) VerifyToken(token string) (*Payload, error) {
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := maker.keys[kid]
+		if !ok {
+			return nil, ErrInvalidToken // unknown or retired key
+		}
+		return key, nil
+	}
+
+	payload := &Payload{}
+	_, err := jwt.ParseWithClaims(token, payload, keyFunc, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+	if err = payload.Valid(); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
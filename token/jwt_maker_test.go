@@ -0,0 +1,108 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/stretchr/testify/require"
+)
+
+func randomKey(id string) Key {
+	return Key{ID: id, Secret: util.RandomString(32)}
+}
+
+func TestJWTMaker(t *testing.T) {
+	maker, err := NewJWTMaker(randomKey("k1"))
+	require.NoError(t, err)
+
+	username := util.RandomOwner()
+	duration := time.Minute
+	issuedAt := time.Now()
+	expiredAt := issuedAt.Add(duration)
+
+	token, payload, err := maker.CreateToken(username, TypeAccess, duration)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotNil(t, payload)
+
+	payload, err = maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.NotZero(t, payload.ID)
+	require.Equal(t, username, payload.Username)
+	require.Equal(t, TypeAccess, payload.Type)
+	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+}
+
+func TestExpiredJWTToken(t *testing.T) {
+	maker, err := NewJWTMaker(randomKey("k1"))
+	require.NoError(t, err)
+
+	token, _, err := maker.CreateToken(util.RandomOwner(), TypeAccess, -time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.ErrorIs(t, err, ErrExpiredToken)
+	require.Nil(t, payload)
+}
+
+func TestInvalidJWTTokenAlgNone(t *testing.T) {
+	payload, err := NewPayload(util.RandomOwner(), TypeAccess, time.Minute)
+	require.NoError(t, err)
+
+	jwtToken := jwt.NewWithClaims(jwt.SigningMethodNone, payload)
+	jwtToken.Header["kid"] = "k1"
+	token, err := jwtToken.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+
+	maker, err := NewJWTMaker(randomKey("k1"))
+	require.NoError(t, err)
+	payload, err = maker.VerifyToken(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.Nil(t, payload)
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	oldKey, newKey := randomKey("2023-01"), randomKey("2023-02")
+	oldMaker, err := NewJWTMaker(oldKey)
+	require.NoError(t, err)
+	oldToken, _, err := oldMaker.CreateToken(util.RandomOwner(), TypeAccess, time.Minute)
+	require.NoError(t, err)
+
+	// during the rotation tokens of both keys are accepted, new tokens use the new key
+	rotated, err := NewJWTMaker(newKey, oldKey)
+	require.NoError(t, err)
+	_, err = rotated.VerifyToken(oldToken)
+	require.NoError(t, err)
+	newToken, _, err := rotated.CreateToken(util.RandomOwner(), TypeAccess, time.Minute)
+	require.NoError(t, err)
+	_, err = oldMaker.VerifyToken(newToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// once the old key is retired its tokens are rejected
+	retired, err := NewJWTMaker(newKey)
+	require.NoError(t, err)
+	_, err = retired.VerifyToken(oldToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = retired.VerifyToken(newToken)
+	require.NoError(t, err)
+
+	// a token signed with another secret under a known kid is rejected
+	forged, err := NewJWTMaker(Key{ID: newKey.ID, Secret: util.RandomString(32)})
+	require.NoError(t, err)
+	forgedToken, _, err := forged.CreateToken(util.RandomOwner(), TypeAccess, time.Minute)
+	require.NoError(t, err)
+	_, err = retired.VerifyToken(forgedToken)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestNewJWTMakerKeys(t *testing.T) {
+	_, err := NewJWTMaker(Key{ID: "k1", Secret: "too short"})
+	require.Error(t, err)
+	_, err = NewJWTMaker(Key{Secret: util.RandomString(32)})
+	require.Error(t, err)
+	_, err = NewJWTMaker(randomKey("k1"), randomKey("k1"))
+	require.Error(t, err)
+}
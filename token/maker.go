@@ -0,0 +1,14 @@
+package token
+
+import (
+	"time"
+)
+
+// Maker issues and verifies tokens
+type Maker interface {
+	// CreateToken creates a token of the given type for username, valid for duration
+	CreateToken(username string, tokenType Type, duration time.Duration) (string, *Payload, error)
+
+	// VerifyToken checks the signature and expiry of a token and returns its payload
+	VerifyToken(token string) (*Payload, error)
+}
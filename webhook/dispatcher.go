@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+)
+
+// defaults of Options
+const (
+	DefaultBatchSize    = 50
+	DefaultPollInterval = time.Second
+	DefaultTimeout      = 10 * time.Second
+)
+
+// Schedule decides when a failed delivery is retried and when it is given up (dead)
+type Schedule struct {
+	MaxAttempts int32         `json:"max_attempts"` // total attempts including the first one
+	BaseDelay   time.Duration `json:"base_delay"`   // wait after the first failed attempt, doubled after every failed attempt
+	MaxDelay    time.Duration `json:"max_delay"`    // upper bound of a single wait
+}
+
+// DefaultSchedule retries for about a day: 30s, 1m, 2m, 4m, ... then every 6h
+var DefaultSchedule = Schedule{
+	MaxAttempts: 12,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    6 * time.Hour,
+}
+
+// Delay returns the wait after the given failed attempt (1 for the first one)
+func (s Schedule) Delay(attempt int32) time.Duration {
+	delay := s.BaseDelay
+	for i := int32(1); i < attempt && (s.MaxDelay <= 0 || delay < s.MaxDelay); i++ {
+		delay *= 2
+	}
+	if s.MaxDelay > 0 && delay > s.MaxDelay {
+		delay = s.MaxDelay
+	}
+	return delay
+}
+
+// Options of a dispatcher
+type Options struct {
+	Schedule     Schedule      // (DefaultSchedule)
+	BatchSize    int32         // deliveries claimed at once (DefaultBatchSize)
+	PollInterval time.Duration // wait of Run between two batches (DefaultPollInterval)
+	Timeout      time.Duration // of a single request (DefaultTimeout)
+	Client       *http.Client  // (NewClient, a client without its restrictions can reach the internal network)
+	// called by Run with the errors it recovers from (database failures), optional
+	// endpoints failing are not errors: they are logged as attempts and retried
+	OnError func(error)
+	// current time (time.Now), deliveries are due when their next attempt is not after it
+	Now func() time.Time
+}
+
+// Dispatcher POSTs the pending webhook deliveries to their endpoints
+// several dispatchers can share the deliveries: a claimed delivery is leased to its dispatcher for the duration of the request
+type Dispatcher struct {
+	store db.Store
+	opts  Options
+}
+
+func NewDispatcher(store db.Store, opts Options) *Dispatcher {
+	if opts.Schedule == (Schedule{}) {
+		opts.Schedule = DefaultSchedule
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = NewClient()
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Dispatcher{store: store, opts: opts}
+}
+
+// RunOnce attempts every due delivery and returns the attempts that were made
+// a failed attempt is logged and rescheduled (or the delivery is dead), only database errors are returned
+func (d *Dispatcher) RunOnce(ctx context.Context) ([]db.RecordWebhookAttemptTxResult, error) {
+	var results []db.RecordWebhookAttemptTxResult
+	for {
+		now := d.opts.Now()
+		// the requests of a batch are sent one after the other, the lease covers the slowest case
+		deliveries, err := d.store.ClaimWebhookDeliveries(ctx, db.ClaimWebhookDeliveriesParams{
+			Now:        now,
+			LeaseUntil: now.Add(2 * d.opts.Timeout * time.Duration(d.opts.BatchSize)),
+			Limit:      d.opts.BatchSize,
+		})
+		if err != nil {
+			return results, err
+		}
+		for _, delivery := range deliveries {
+			result, err := d.deliver(ctx, delivery)
+			if errors.Is(err, db.ErrWebhookDeliveryNotPending) || errors.Is(err, db.ErrWebhookDeliveryNotFound) {
+				continue // finished by another dispatcher, or its endpoint was deleted
+			}
+			if err != nil {
+				return results, err
+			}
+			results = append(results, result)
+		}
+		if len(deliveries) < int(d.opts.BatchSize) {
+			return results, nil
+		}
+	}
+}
+
+// Run attempts the due deliveries every PollInterval until ctx is done, errors are reported to OnError
+// returns nil once ctx is done
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil && d.opts.OnError != nil {
+			d.opts.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver sends a delivery once and records the attempt
+func (d *Dispatcher) deliver(ctx context.Context, delivery db.WebhookDelivery) (db.RecordWebhookAttemptTxResult, error) {
+	endpoint, err := d.store.GetWebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("%w: %d", db.ErrWebhookDeliveryNotFound, delivery.ID)
+		}
+		return db.RecordWebhookAttemptTxResult{}, err
+	}
+
+	start := time.Now()
+	statusCode, err := d.post(ctx, endpoint, delivery)
+	arg := db.RecordWebhookAttemptTxParams{
+		DeliveryID:    delivery.ID,
+		StatusCode:    int32(statusCode),
+		Duration:      time.Since(start),
+		MaxAttempts:   d.opts.Schedule.MaxAttempts,
+		NextAttemptAt: d.opts.Now().Add(d.opts.Schedule.Delay(delivery.Attempts + 1)),
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// shutting down, the lease expires and the delivery is attempted again
+			return db.RecordWebhookAttemptTxResult{}, ctx.Err()
+		}
+		arg.Error = err.Error()
+	}
+	return d.store.RecordWebhookAttemptTx(ctx, arg)
+}
+
+// post sends the signed delivery, any 2xx response is a success
+// returns the status code of the response (0 when there was none)
+func (d *Dispatcher) post(ctx context.Context, endpoint db.WebhookEndpoint, delivery db.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cashflow-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // lets the connection be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,302 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/outbox"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver is an endpoint that checks the signature of every request and answers with the next status of statuses
+// (200 once they are used up)
+type receiver struct {
+	t        *testing.T
+	server   *httptest.Server
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	received []Notification
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{t: t, statuses: statuses}
+	r.server = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *receiver) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	require.NoError(r.t, err)
+	require.Equal(r.t, http.MethodPost, req.Method)
+	require.Equal(r.t, "application/json", req.Header.Get("Content-Type"))
+	require.NoError(r.t, Verify(r.secret, req.Header.Get(SignatureHeader), body, 0, time.Now()))
+
+	var notification Notification
+	require.NoError(r.t, json.Unmarshal(body, &notification))
+	require.Equal(r.t, notification.Type, req.Header.Get(EventHeader))
+	_, err = strconv.ParseInt(req.Header.Get(DeliveryHeader), 10, 64)
+	require.NoError(r.t, err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, notification)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) notifications() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.received...)
+}
+
+// subscribe registers the receiver for eventTypes as an endpoint of owner
+func (r *receiver) subscribe(store db.Store, owner string, eventTypes ...string) db.WebhookEndpoint {
+	endpoint := createEndpoint(r.t, store, owner, r.server.URL, 0, eventTypes...)
+	r.secret = endpoint.Secret
+	return endpoint
+}
+
+// clock is a settable Options.Now
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func listAttempts(t *testing.T, store db.Store, deliveryID int64) []db.WebhookAttempt {
+	attempts, err := store.ListWebhookAttempts(context.Background(), deliveryID)
+	require.NoError(t, err)
+	return attempts
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store, 1000)
+	account2 := createRandomAccount(t, store, 1000)
+	receiver := newReceiver(t)
+	endpoint := receiver.subscribe(store, account2.Owner, db.EventTransferCreated)
+	transfer := transfer(t, store, account1, account2, 10)
+
+	_, err := outbox.NewRelay(store, NewPublisher(store), outbox.Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+	dispatcher := NewDispatcher(store, Options{Client: receiver.server.Client()})
+	results, err := dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	delivery := results[0].Delivery
+	require.Equal(t, endpoint.ID, delivery.EndpointID)
+	require.Equal(t, db.WebhookDeliveryDelivered, delivery.Status)
+	require.EqualValues(t, 1, delivery.Attempts)
+	require.True(t, delivery.DeliveredAt.Valid)
+	require.Empty(t, delivery.LastError)
+	require.EqualValues(t, 1, results[0].Attempt.Attempt)
+	require.EqualValues(t, http.StatusOK, results[0].Attempt.StatusCode)
+
+	notifications := receiver.notifications()
+	require.Len(t, notifications, 1)
+	require.Equal(t, db.EventTransferCreated, notifications[0].Type)
+	var data TransferData
+	require.NoError(t, json.Unmarshal(notifications[0].Data, &data))
+	require.Equal(t, transfer.ID, data.TransferID)
+	require.Equal(t, account2.Balance+10, *data.ToBalance)
+
+	// delivered is final
+	results, err = dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Empty(t, results)
+	require.Len(t, receiver.notifications(), 1)
+	require.Len(t, listAttempts(t, store, delivery.ID), 1)
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store, 1000)
+	account2 := createRandomAccount(t, store, 1000)
+	receiver := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	receiver.subscribe(store, account1.Owner, db.EventTransferCreated)
+	transfer(t, store, account1, account2, 10)
+	_, err := outbox.NewRelay(store, NewPublisher(store), outbox.Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+
+	clock := &clock{now: time.Now()}
+	schedule := Schedule{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	dispatcher := NewDispatcher(store, Options{Schedule: schedule, Now: clock.Now, Client: receiver.server.Client()})
+
+	results, err := dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	delivery := results[0].Delivery
+	require.Equal(t, db.WebhookDeliveryPending, delivery.Status)
+	require.EqualValues(t, 1, delivery.Attempts)
+	require.Contains(t, delivery.LastError, "500")
+	require.WithinDuration(t, clock.Now().Add(time.Minute), delivery.NextAttemptAt, time.Millisecond)
+
+	// not due yet
+	clock.Advance(59 * time.Second)
+	results, err = dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Empty(t, results)
+
+	clock.Advance(time.Second)
+	results, err = dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, db.WebhookDeliveryPending, results[0].Delivery.Status)
+	require.EqualValues(t, 2, results[0].Delivery.Attempts)
+	require.WithinDuration(t, clock.Now().Add(2*time.Minute), results[0].Delivery.NextAttemptAt, time.Millisecond)
+
+	clock.Advance(2 * time.Minute)
+	results, err = dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, db.WebhookDeliveryDelivered, results[0].Delivery.Status)
+	require.EqualValues(t, 3, results[0].Delivery.Attempts)
+	require.Empty(t, results[0].Delivery.LastError)
+
+	attempts := listAttempts(t, store, delivery.ID)
+	require.Len(t, attempts, 3)
+	for i, status := range []int32{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK} {
+		require.EqualValues(t, i+1, attempts[i].Attempt)
+		require.Equal(t, status, attempts[i].StatusCode)
+		require.Equal(t, status != http.StatusOK, attempts[i].Error != "")
+	}
+
+	// every retry carries the same notification
+	notifications := receiver.notifications()
+	require.Len(t, notifications, 3)
+	require.Equal(t, notifications[0], notifications[2])
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store, 1000)
+	account2 := createRandomAccount(t, store, 1000)
+	receiver := newReceiver(t)
+	endpoint := receiver.subscribe(store, account1.Owner, db.EventTransferCreated)
+	receiver.server.Close() // nothing listens anymore
+	transfer(t, store, account1, account2, 10)
+	_, err := outbox.NewRelay(store, NewPublisher(store), outbox.Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+
+	clock := &clock{now: time.Now()}
+	dispatcher := NewDispatcher(store, Options{Schedule: Schedule{MaxAttempts: 3, BaseDelay: time.Second}, Now: clock.Now, Client: receiver.server.Client()})
+	var delivery db.WebhookDelivery
+	for i := 0; i < 3; i++ {
+		results, err := dispatcher.RunOnce(ctx)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		delivery = results[0].Delivery
+		require.Zero(t, results[0].Attempt.StatusCode)
+		require.NotEmpty(t, results[0].Attempt.Error)
+		clock.Advance(time.Hour)
+	}
+	require.Equal(t, db.WebhookDeliveryDead, delivery.Status)
+	require.EqualValues(t, 3, delivery.Attempts)
+	require.False(t, delivery.DeliveredAt.Valid)
+	require.Len(t, listAttempts(t, store, delivery.ID), 3)
+
+	// dead deliveries are not attempted anymore
+	results, err := dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Empty(t, results)
+	_, err = store.RecordWebhookAttemptTx(ctx, db.RecordWebhookAttemptTxParams{DeliveryID: delivery.ID, MaxAttempts: 3})
+	require.ErrorIs(t, err, db.ErrWebhookDeliveryNotPending)
+
+	// until they are requeued, with a fresh schedule
+	requeued, err := store.RequeueWebhookDelivery(ctx, db.RequeueWebhookDeliveryParams{ID: delivery.ID, NextAttemptAt: clock.Now()})
+	require.NoError(t, err)
+	require.Equal(t, db.WebhookDeliveryPending, requeued.Status)
+	require.Zero(t, requeued.Attempts)
+	results, err = dispatcher.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, db.WebhookDeliveryPending, results[0].Delivery.Status)
+	require.EqualValues(t, 1, results[0].Delivery.Attempts)
+	require.EqualValues(t, 1, results[0].Attempt.Attempt)
+	require.Equal(t, endpoint.ID, results[0].Delivery.EndpointID)
+	require.Len(t, listAttempts(t, store, delivery.ID), 4) // the log keeps the attempts before the requeue
+}
+
+func TestDispatcherSkipsDeletedEndpoints(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store, 1000)
+	account2 := createRandomAccount(t, store, 1000)
+	receiver := newReceiver(t)
+	endpoint := receiver.subscribe(store, account1.Owner, db.EventTransferCreated)
+	transfer(t, store, account1, account2, 10)
+	_, err := outbox.NewRelay(store, NewPublisher(store), outbox.Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+
+	require.NoError(t, store.DeleteWebhookEndpoint(ctx, endpoint.ID))
+	results, err := NewDispatcher(store, Options{Client: receiver.server.Client()}).RunOnce(ctx)
+	require.NoError(t, err)
+	require.Empty(t, results)
+	require.Empty(t, receiver.notifications())
+}
+
+func TestDispatcherRefusesInternalAddresses(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store, 1000)
+	account2 := createRandomAccount(t, store, 1000)
+	receiver := newReceiver(t) // on 127.0.0.1, like an endpoint registered before its host moved to an internal address
+	receiver.subscribe(store, account1.Owner, db.EventTransferCreated)
+	transfer(t, store, account1, account2, 10)
+	_, err := outbox.NewRelay(store, NewPublisher(store), outbox.Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+
+	results, err := NewDispatcher(store, Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Zero(t, results[0].Attempt.StatusCode)
+	require.Contains(t, results[0].Attempt.Error, ErrForbiddenURL.Error())
+	require.Empty(t, receiver.notifications())
+}
+
+func TestScheduleDelay(t *testing.T) {
+	schedule := Schedule{MaxAttempts: 10, BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute}
+	for attempt, delay := range []time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 4 * time.Minute,
+		5: 5 * time.Minute,
+		9: 5 * time.Minute,
+	} {
+		if delay == 0 {
+			continue
+		}
+		require.Equal(t, delay, schedule.Delay(int32(attempt)), attempt)
+	}
+	require.Equal(t, time.Duration(1<<20)*time.Second, Schedule{BaseDelay: time.Second}.Delay(21)) // no upper bound
+}
@@ -0,0 +1,233 @@
+// Package webhook sends the ledger events to the HTTP endpoints registered by account owners
+//
+// a Publisher plugged into the outbox relay turns every event into one delivery per subscribed endpoint
+// (webhook_deliveries), a Dispatcher then POSTs the pending deliveries with a signed body (see Sign) and retries the
+// failures with exponential backoff until they are delivered or dead (see Schedule), every attempt is logged (webhook_attempts)
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/outbox"
+)
+
+// EventBalanceLow is derived from the transfer events: a debit took an account below the threshold of the endpoint
+// (webhook_endpoints.low_balance_threshold)
+const EventBalanceLow = "balance.low"
+
+// EventTypes lists the events an endpoint can subscribe to
+var EventTypes = []string{
+	db.EventTransferCreated,
+	db.EventTransferReversed,
+	db.EventAccountFrozen,
+	db.EventAccountUnfrozen,
+	db.EventAccountDormant,
+	db.EventAccountReactivated,
+	db.EventAccountClosed,
+	EventBalanceLow,
+}
+
+// ValidEventType reports whether endpoints can subscribe to eventType
+func ValidEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification is the body of every delivery request
+// EventID and Type identify a notification: retries and redeliveries carry the same ones, receivers should dedupe on them
+type Notification struct {
+	EventID   int64           `json:"event_id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"` // TransferData, AccountStatusData or BalanceLowEvent
+}
+
+// TransferData is the data of the transfer.* notifications, db.TransferEvent seen by one owner:
+// only the balances of the accounts the owner holds are set, the payee never learns the balance of the payer
+type TransferData struct {
+	TransferID        int64  `json:"transfer_id"`
+	FromAccountID     int64  `json:"from_account_id"`
+	ToAccountID       int64  `json:"to_account_id"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	ConvertedAmount   int64  `json:"converted_amount,omitempty"`
+	ConvertedCurrency string `json:"converted_currency,omitempty"`
+	ReversalOf        int64  `json:"reversal_of,omitempty"`
+	FromBalance       *int64 `json:"from_balance,omitempty"` // after the transfer, for the owner of the source account
+	ToBalance         *int64 `json:"to_balance,omitempty"`   // after the transfer, for the owner of the destination account
+}
+
+// transferData returns the data of transfer for the owner of the source account (from) and/or the destination account (to)
+func transferData(transfer db.TransferEvent, from, to bool) TransferData {
+	data := TransferData{
+		TransferID:        transfer.TransferID,
+		FromAccountID:     transfer.FromAccountID,
+		ToAccountID:       transfer.ToAccountID,
+		Amount:            transfer.Amount,
+		Currency:          transfer.Currency,
+		ConvertedAmount:   transfer.ConvertedAmount,
+		ConvertedCurrency: transfer.ConvertedCurrency,
+		ReversalOf:        transfer.ReversalOf,
+	}
+	if from {
+		data.FromBalance = &transfer.FromBalance
+	}
+	if to {
+		data.ToBalance = &transfer.ToBalance
+	}
+	return data
+}
+
+// AccountStatusData is the data of the account.* notifications, db.AccountStatusEvent without what is internal to the
+// bank: the owner learns the new status of the account, not the reason of the change nor who made it
+type AccountStatusData struct {
+	AccountID  int64  `json:"account_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Balance    int64  `json:"balance"`
+	Currency   string `json:"currency"`
+}
+
+// BalanceLowEvent is the data of the balance.low notifications
+type BalanceLowEvent struct {
+	AccountID  int64  `json:"account_id"`
+	Balance    int64  `json:"balance"`
+	Threshold  int64  `json:"threshold"`
+	Currency   string `json:"currency"`
+	TransferID int64  `json:"transfer_id"` // the debit that crossed the threshold
+}
+
+// Publisher is an outbox.Publisher that enqueues a delivery for every endpoint subscribed to an event:
+// transfer events go to the owners of both accounts (see TransferData), account events to the owner of the account,
+// balance.low to the owner of the debited account
+// enqueueing is idempotent, an event published twice by the relay is only delivered once per endpoint
+type Publisher struct {
+	store db.Store
+}
+
+var _ outbox.Publisher = (*Publisher)(nil)
+
+func NewPublisher(store db.Store) *Publisher {
+	return &Publisher{store: store}
+}
+
+func (p *Publisher) Publish(ctx context.Context, event db.OutboxEvent) error {
+	switch event.AggregateType {
+	case db.AggregateTypeTransfer:
+		var transfer db.TransferEvent
+		if err := json.Unmarshal(event.Payload, &transfer); err != nil {
+			return fmt.Errorf("event %d: %w", event.ID, err)
+		}
+		return p.publishTransfer(ctx, event, transfer)
+	case db.AggregateTypeAccount:
+		var status db.AccountStatusEvent
+		if err := json.Unmarshal(event.Payload, &status); err != nil {
+			return fmt.Errorf("event %d: %w", event.ID, err)
+		}
+		return p.enqueueData(ctx, event, status.Owner, event.EventType, AccountStatusData{
+			AccountID:  status.AccountID,
+			FromStatus: status.FromStatus,
+			ToStatus:   status.ToStatus,
+			Balance:    status.Balance,
+			Currency:   status.Currency,
+		})
+	}
+	return nil // nothing to notify
+}
+
+func (p *Publisher) publishTransfer(ctx context.Context, event db.OutboxEvent, transfer db.TransferEvent) error {
+	from, err := p.store.GetAccount(ctx, transfer.FromAccountID)
+	if err != nil {
+		return err
+	}
+	to, err := p.store.GetAccount(ctx, transfer.ToAccountID)
+	if err != nil {
+		return err
+	}
+	// each side only gets its own balance
+	sameOwner := to.Owner == from.Owner
+	if err := p.enqueueData(ctx, event, from.Owner, event.EventType, transferData(transfer, true, sameOwner)); err != nil {
+		return err
+	}
+	if !sameOwner {
+		if err := p.enqueueData(ctx, event, to.Owner, event.EventType, transferData(transfer, false, true)); err != nil {
+			return err
+		}
+	}
+
+	// the threshold is per endpoint, so is the decision to notify
+	return p.enqueue(ctx, event, from.Owner, EventBalanceLow, nil, func(endpoint db.WebhookEndpoint) (any, bool) {
+		before := transfer.FromBalance + transfer.Amount
+		if transfer.FromBalance >= endpoint.LowBalanceThreshold || before < endpoint.LowBalanceThreshold {
+			return nil, false
+		}
+		return BalanceLowEvent{
+			AccountID:  transfer.FromAccountID,
+			Balance:    transfer.FromBalance,
+			Threshold:  endpoint.LowBalanceThreshold,
+			Currency:   transfer.Currency,
+			TransferID: transfer.TransferID,
+		}, true
+	})
+}
+
+// enqueueData is enqueue with data marshalled to JSON
+func (p *Publisher) enqueueData(ctx context.Context, event db.OutboxEvent, owner, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(ctx, event, owner, eventType, payload, nil)
+}
+
+// enqueue creates a delivery of eventType for every endpoint of owner subscribed to it
+// the notification data is data, or what dataFor returns for the endpoint (false skips the endpoint)
+func (p *Publisher) enqueue(ctx context.Context, event db.OutboxEvent, owner, eventType string, data json.RawMessage, dataFor func(db.WebhookEndpoint) (any, bool)) error {
+	endpoints, err := p.store.ListWebhookEndpointsForEvent(ctx, db.ListWebhookEndpointsForEventParams{
+		Owner:     owner,
+		EventType: eventType,
+	})
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		data := data
+		if dataFor != nil {
+			value, ok := dataFor(endpoint)
+			if !ok {
+				continue
+			}
+			if data, err = json.Marshal(value); err != nil {
+				return err
+			}
+		}
+		body, err := json.Marshal(Notification{
+			EventID:   event.ID,
+			Type:      eventType,
+			CreatedAt: event.CreatedAt,
+			Data:      data,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = p.store.CreateWebhookDelivery(ctx, db.CreateWebhookDeliveryParams{
+			EndpointID:    endpoint.ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       body,
+			NextAttemptAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	db "github.com/harshaljanjani/cashflow.net/db/sqlc"
+	"github.com/harshaljanjani/cashflow.net/db/util"
+	"github.com/harshaljanjani/cashflow.net/outbox"
+	"github.com/stretchr/testify/require"
+)
+
+func createRandomAccount(t *testing.T, store db.Store, balance int64) db.Account {
+	ctx := context.Background()
+	user, err := store.CreateUser(ctx, db.CreateUserParams{
+		Username:       util.RandomOwner(),
+		HashedPassword: util.RandomString(60),
+		FullName:       util.RandomOwner(),
+		Email:          util.RandomEmail(),
+	})
+	require.NoError(t, err)
+	account, err := store.CreateAccount(ctx, db.CreateAccountParams{
+		Owner:    user.Username,
+		Balance:  balance,
+		Currency: util.USD,
+	})
+	require.NoError(t, err)
+	return account
+}
+
+func createEndpoint(t *testing.T, store db.Store, owner, url string, threshold int64, eventTypes ...string) db.WebhookEndpoint {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	endpoint, err := store.CreateWebhookEndpoint(context.Background(), db.CreateWebhookEndpointParams{
+		Owner:               owner,
+		Url:                 url,
+		Secret:              secret,
+		EventTypes:          eventTypes,
+		LowBalanceThreshold: threshold,
+	})
+	require.NoError(t, err)
+	return endpoint
+}
+
+func transfer(t *testing.T, store db.Store, from, to db.Account, amount int64) db.Transfer {
+	result, err := store.TransferTx(context.Background(), db.TransferTxParams{FromAccountID: from.ID, ToAccountID: to.ID, Amount: amount, Currency: util.USD})
+	require.NoError(t, err)
+	return result.Transfer
+}
+
+func listDeliveries(t *testing.T, store db.Store, endpoint db.WebhookEndpoint) []db.WebhookDelivery {
+	deliveries, err := store.ListWebhookDeliveries(context.Background(), db.ListWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		Limit:      100,
+	})
+	require.NoError(t, err)
+	return deliveries
+}
+
+func requireNotification(t *testing.T, delivery db.WebhookDelivery, eventType string, data any) {
+	var notification Notification
+	require.NoError(t, json.Unmarshal(delivery.Payload, &notification))
+	require.Equal(t, eventType, notification.Type)
+	require.Equal(t, eventType, delivery.EventType)
+	require.Equal(t, delivery.EventID, notification.EventID)
+	require.NoError(t, json.Unmarshal(notification.Data, data))
+}
+
+func TestPublisher(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store, 1000)
+	account2 := createRandomAccount(t, store, 1000)
+
+	all := createEndpoint(t, store, account1.Owner, "https://one.example.com/hooks", 500, EventTypes...)
+	frozen := createEndpoint(t, store, account1.Owner, "https://two.example.com/hooks", 0, db.EventAccountFrozen)
+	receiver := createEndpoint(t, store, account2.Owner, "https://three.example.com/hooks", 2000, db.EventTransferCreated, EventBalanceLow)
+
+	transfer1 := transfer(t, store, account1, account2, 400) // 1000 -> 600
+	transfer2 := transfer(t, store, account1, account2, 200) // 600 -> 400, crosses 500
+	transfer(t, store, account1, account2, 100)              // 400 -> 300, already below
+	_, err := store.FreezeAccountTx(ctx, db.AccountStatusTxParams{AccountID: account1.ID, Reason: "aml review", Actor: "compliance"})
+	require.NoError(t, err)
+
+	relay := outbox.NewRelay(store, NewPublisher(store), outbox.Options{})
+	sent, err := relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 4, sent)
+
+	deliveries := listDeliveries(t, store, all)
+	require.Len(t, deliveries, 5) // 3 transfers, 1 balance.low, 1 freeze
+	var types []string
+	for _, delivery := range deliveries {
+		require.Equal(t, db.WebhookDeliveryPending, delivery.Status)
+		require.Zero(t, delivery.Attempts)
+		types = append(types, delivery.EventType)
+	}
+	require.ElementsMatch(t, []string{db.EventTransferCreated, db.EventTransferCreated, db.EventTransferCreated, EventBalanceLow, db.EventAccountFrozen}, types)
+
+	for _, delivery := range deliveries {
+		switch delivery.EventType {
+		case db.EventTransferCreated:
+			var data TransferData
+			requireNotification(t, delivery, db.EventTransferCreated, &data)
+			require.Equal(t, account1.ID, data.FromAccountID)
+			require.NotNil(t, data.FromBalance)
+			require.Nil(t, data.ToBalance) // the payer doesn't learn the balance of the payee
+		case EventBalanceLow:
+			var data BalanceLowEvent
+			requireNotification(t, delivery, EventBalanceLow, &data)
+			require.Equal(t, BalanceLowEvent{
+				AccountID:  account1.ID,
+				Balance:    400,
+				Threshold:  500,
+				Currency:   util.USD,
+				TransferID: transfer2.ID,
+			}, data)
+		case db.EventAccountFrozen:
+			var data AccountStatusData
+			requireNotification(t, delivery, db.EventAccountFrozen, &data)
+			require.Equal(t, AccountStatusData{
+				AccountID:  account1.ID,
+				FromStatus: db.AccountStatusActive,
+				ToStatus:   db.AccountStatusFrozen,
+				Balance:    300,
+				Currency:   util.USD,
+			}, data)
+			// the reason and the officer of a freeze stay internal
+			require.NotContains(t, string(delivery.Payload), `"reason"`)
+			require.NotContains(t, string(delivery.Payload), `"actor"`)
+			require.NotContains(t, string(delivery.Payload), "aml review")
+			require.NotContains(t, string(delivery.Payload), "compliance")
+		}
+	}
+
+	deliveries = listDeliveries(t, store, frozen)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, db.EventAccountFrozen, deliveries[0].EventType)
+
+	// the receiving owner gets the transfers, balance.low is about the debited account only
+	deliveries = listDeliveries(t, store, receiver)
+	require.Len(t, deliveries, 3)
+	var data TransferData
+	requireNotification(t, deliveries[0], db.EventTransferCreated, &data)
+	require.Equal(t, transfer1.ID, data.TransferID)
+	require.Equal(t, account2.ID, data.ToAccountID)
+	require.Equal(t, account2.Balance+400, *data.ToBalance)
+	require.Nil(t, data.FromBalance) // nor the payee the balance of the payer
+	require.NotContains(t, string(deliveries[0].Payload), "from_balance")
+
+	// other owners' endpoints get nothing
+	stranger := createRandomAccount(t, store, 1000)
+	strangerEndpoint := createEndpoint(t, store, stranger.Owner, "https://four.example.com/hooks", 0, EventTypes...)
+	transfer(t, store, account2, account1, 10)
+	_, err = relay.RunOnce(ctx)
+	require.NoError(t, err)
+	require.Empty(t, listDeliveries(t, store, strangerEndpoint))
+}
+
+func TestPublisherBatchBalanceLow(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	payer := createRandomAccount(t, store, 1000)
+	payee1 := createRandomAccount(t, store, 0)
+	payee2 := createRandomAccount(t, store, 0)
+	endpoint := createEndpoint(t, store, payer.Owner, "https://one.example.com/hooks", 500, EventBalanceLow)
+
+	// only the second leg takes the payer below 500, whatever the final balance
+	result, err := store.BatchTransferTx(ctx, db.BatchTransferTxParams{Currency: util.USD, Legs: []db.TransferLeg{
+		{FromAccountID: payer.ID, ToAccountID: payee1.ID, Amount: 300}, // 1000 -> 700
+		{FromAccountID: payer.ID, ToAccountID: payee2.ID, Amount: 300}, // 700 -> 400
+		{FromAccountID: payer.ID, ToAccountID: payee1.ID, Amount: 100}, // 400 -> 300
+	}})
+	require.NoError(t, err)
+	_, err = outbox.NewRelay(store, NewPublisher(store), outbox.Options{}).RunOnce(ctx)
+	require.NoError(t, err)
+
+	deliveries := listDeliveries(t, store, endpoint)
+	require.Len(t, deliveries, 1)
+	var data BalanceLowEvent
+	requireNotification(t, deliveries[0], EventBalanceLow, &data)
+	require.Equal(t, result.Transfers[1].ID, data.TransferID)
+	require.Equal(t, int64(400), data.Balance)
+}
+
+func TestPublisherIsIdempotent(t *testing.T) {
+	store := db.NewMemStore()
+	ctx := context.Background()
+	account1 := createRandomAccount(t, store, 1000)
+	account2 := createRandomAccount(t, store, 1000)
+	endpoint := createEndpoint(t, store, account1.Owner, "https://one.example.com/hooks", 1000, db.EventTransferCreated, EventBalanceLow)
+	transfer(t, store, account1, account2, 10)
+
+	events, err := store.ClaimOutboxEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	// the relay publishes again when marking the event sent fails
+	publisher := NewPublisher(store)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, publisher.Publish(ctx, events[0]))
+	}
+	require.Len(t, listDeliveries(t, store, endpoint), 2)
+
+	// events the publisher doesn't know about are ignored
+	require.NoError(t, publisher.Publish(ctx, db.OutboxEvent{ID: 42, EventType: "user.created", AggregateType: "user", Payload: []byte(`{}`)}))
+
+	// a payload that can't be decoded is an error, the relay retries it
+	require.Error(t, publisher.Publish(ctx, db.OutboxEvent{ID: 43, EventType: db.EventTransferCreated, AggregateType: db.AggregateTypeTransfer, Payload: []byte(`[`)}))
+
+	deliveries, err := store.ListWebhookDeliveries(ctx, db.ListWebhookDeliveriesParams{
+		EndpointID: endpoint.ID,
+		Status:     sql.NullString{String: db.WebhookDeliveryDelivered, Valid: true},
+		Limit:      10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+}
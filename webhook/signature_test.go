@@ -0,0 +1,41 @@
+package webhook
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, "whsec_"))
+	other, err := NewSecret()
+	require.NoError(t, err)
+	require.NotEqual(t, secret, other)
+
+	body := []byte(`{"event_id":1,"type":"transfer.created"}`)
+	now := time.Now()
+	header := Sign(secret, now, body)
+	require.Regexp(t, `^t=\d+,v1=[0-9a-f]{64}$`, header)
+	require.NoError(t, Verify(secret, header, body, 0, now))
+	require.NoError(t, Verify(secret, header, body, 0, now.Add(DefaultTolerance-time.Second)))
+
+	require.ErrorIs(t, Verify(other, header, body, 0, now), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(secret, header, []byte(`{"event_id":2,"type":"transfer.created"}`), 0, now), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(secret, header, body, 0, now.Add(DefaultTolerance+time.Second)), ErrSignatureExpired)
+	require.NoError(t, Verify(secret, header, body, time.Hour, now.Add(DefaultTolerance+time.Second)))
+
+	// the timestamp is signed too
+	tampered := "t=" + "1" + header[strings.Index(header, ","):]
+	require.ErrorIs(t, Verify(secret, tampered, body, 0, now), ErrInvalidSignature)
+
+	// any of several v1 signatures may match
+	require.NoError(t, Verify(secret, header+",v1="+strings.Repeat("0", 64), body, 0, now))
+
+	for _, header := range []string{"", "t=abc,v1=00", "v1=" + strings.Repeat("0", 64), header[:strings.Index(header, ",")]} {
+		require.ErrorIs(t, Verify(secret, header, body, 0, now), ErrInvalidSignature, header)
+	}
+}
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// endpoints are chosen by the users, so the deliveries must not become a way to reach the internal network
+// (databases, the gRPC server, cloud metadata at 169.254.169.254, ...): an endpoint must be an https URL of a public
+// host when it is registered (CheckURL), and the dispatcher only ever connects to public addresses (NewClient)
+
+// ErrForbiddenURL is returned by CheckURL and by the deliveries to an address that is not public
+var ErrForbiddenURL = errors.New("webhook url not allowed")
+
+// special purpose ranges that are neither loopback, private nor link-local for package net, but not public either
+var reservedNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),      // "this network"
+	mustParseCIDR("100.64.0.0/10"),  // carrier-grade NAT, some cloud metadata services live there
+	mustParseCIDR("192.0.0.0/24"),   // IETF protocol assignments
+	mustParseCIDR("198.18.0.0/15"),  // benchmarking
+	mustParseCIDR("240.0.0.0/4"),    // reserved, and the broadcast address
+	mustParseCIDR("64:ff9b::/96"),   // NAT64, embeds any IPv4 address
+	mustParseCIDR("64:ff9b:1::/48"), // local NAT64
+	mustParseCIDR("2002::/16"),      // 6to4, embeds any IPv4 address
+	mustParseCIDR("fec0::/10"),      // deprecated site-local
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// publicIP reports whether deliveries may be sent to ip
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, ipNet := range reservedNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL returns ErrForbiddenURL unless rawURL is an https URL whose host only resolves to public addresses
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForbiddenURL, err)
+	}
+	if u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("%w: %q is not an https URL", ErrForbiddenURL, rawURL)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForbiddenURL, err)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenURL, u.Hostname(), addr.IP)
+		}
+	}
+	return nil
+}
+
+// NewClient returns the client of the deliveries (the default of Options.Client)
+// the address is checked again when it is dialed, after resolution, so a host that changed its DNS records since
+// its registration can't get around CheckURL; redirects are not followed, a 3xx is a failed attempt
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil // the proxy would be the one dialing
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialControl refuses connections to addresses that are not public, address is the resolved "ip:port"
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenURL, host)
+	}
+	return nil
+}
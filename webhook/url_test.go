@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckURL(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, CheckURL(ctx, "https://203.0.113.10/hooks"))
+	require.NoError(t, CheckURL(ctx, "https://[2606:4700::1111]:8443/hooks"))
+
+	for _, url := range []string{
+		"http://203.0.113.10/hooks", // not https
+		"ftp://203.0.113.10/hooks",
+		"https:///hooks",
+		"https://127.0.0.1/hooks",
+		"https://localhost:9090/hooks",
+		"https://[::1]/hooks",
+		"https://10.0.0.1/hooks",
+		"https://192.168.1.1/hooks",
+		"https://169.254.169.254/latest/meta-data",
+		"https://100.100.100.200/hooks",
+		"https://0.0.0.0/hooks",
+		"https://[::ffff:127.0.0.1]/hooks",
+		"https://[fd00::1]/hooks",
+		"https://[fe80::1]/hooks",
+	} {
+		require.ErrorIs(t, CheckURL(ctx, url), ErrForbiddenURL, url)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer server.Close()
+
+	// loopback is refused when dialing
+	_, err := NewClient().Post(server.URL, "application/json", nil)
+	require.ErrorIs(t, err, ErrForbiddenURL)
+
+	// redirects are not followed, whatever the transport
+	client := NewClient()
+	client.Transport = server.Client().Transport
+	resp, err := client.Post(server.URL, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	require.False(t, redirected)
+}